@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config contiene los límites de un cache; un valor cero desactiva el límite
+type Config struct {
+	MaxEntries int           // entradas como máximo
+	MaxBytes   int64         // suma de los tamaños declarados de las entradas
+	TTL        time.Duration // tiempo de vida de una entrada desde que se guardó
+}
+
+// Cache es un cache LRU con tiempo de vida, seguro para uso concurrente. Cada
+// entrada declara su tamaño aproximado en bytes al guardarse; cuando se excede
+// MaxEntries o MaxBytes se desalojan las entradas usadas hace más tiempo. Las
+// entradas vencidas se eliminan al leerlas y, al guardar, las que quedan al final
+// de la lista LRU.
+type Cache struct {
+	config Config
+	mux    sync.Mutex
+	order  *list.List // frente: usada más recientemente
+	items  map[string]*list.Element
+	bytes  int64
+	now    func() time.Time
+
+	hits        int64
+	misses      int64
+	evictions   int64
+	expirations int64
+	rejected    int64
+}
+
+// entry es una entrada del cache
+type entry struct {
+	key     string
+	value   interface{}
+	size    int64
+	created time.Time
+	hits    int64
+}
+
+// Stats contiene las métricas de un cache
+type Stats struct {
+	Entries     int
+	Bytes       int64
+	MaxEntries  int
+	MaxBytes    int64
+	TTL         time.Duration
+	Hits        int64
+	Misses      int64
+	Evictions   int64 // entradas desalojadas por exceder MaxEntries o MaxBytes
+	Expirations int64 // entradas eliminadas por vencer su TTL
+	Rejected    int64 // entradas no guardadas por ser más grandes que MaxBytes
+	TopEntries  []EntryStats
+}
+
+// EntryStats describe una entrada del cache
+type EntryStats struct {
+	Key  string
+	Hits int64
+	Size int64
+	Age  time.Duration
+}
+
+// topEntries es el número de entradas más usadas que informa Stats
+const topEntries = 10
+
+// New crea un cache con los límites indicados
+func New(config Config) *Cache {
+	return &Cache{
+		config: config,
+		order:  list.New(),
+		items:  make(map[string]*list.Element),
+		now:    time.Now,
+	}
+}
+
+// Get retorna el valor de una clave y cuenta el acierto en la entrada
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	element, exists := c.items[key]
+	if !exists {
+		c.misses++
+		return nil, false
+	}
+
+	e := element.Value.(*entry)
+	if c.expired(e, c.now()) {
+		c.remove(element)
+		c.expirations++
+		c.misses++
+		return nil, false
+	}
+
+	e.hits++
+	c.hits++
+	c.order.MoveToFront(element)
+	return e.value, true
+}
+
+// Set guarda un valor con su tamaño aproximado en bytes, reemplazando el anterior
+// de la misma clave, y desaloja entradas hasta respetar los límites
+func (c *Cache) Set(key string, value interface{}, size int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if element, exists := c.items[key]; exists {
+		c.remove(element)
+	}
+	if c.config.MaxBytes > 0 && size > c.config.MaxBytes {
+		c.rejected++
+		return
+	}
+
+	now := c.now()
+	c.items[key] = c.order.PushFront(&entry{key: key, value: value, size: size, created: now})
+	c.bytes += size
+
+	// Eliminar las entradas vencidas del final de la lista
+	for back := c.order.Back(); back != nil && c.expired(back.Value.(*entry), now); back = c.order.Back() {
+		c.remove(back)
+		c.expirations++
+	}
+
+	// Desalojar las usadas hace más tiempo
+	for (c.config.MaxEntries > 0 && c.order.Len() > c.config.MaxEntries) ||
+		(c.config.MaxBytes > 0 && c.bytes > c.config.MaxBytes) {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Clear elimina todas las entradas; las métricas se conservan
+func (c *Cache) Clear() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+// Len retorna el número de entradas
+func (c *Cache) Len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.order.Len()
+}
+
+// Stats retorna una copia de las métricas, con las entradas más usadas
+func (c *Cache) Stats() Stats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	now := c.now()
+	entries := make([]EntryStats, 0, c.order.Len())
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		e := element.Value.(*entry)
+		entries = append(entries, EntryStats{Key: e.key, Hits: e.hits, Size: e.size, Age: now.Sub(e.created)})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Hits > entries[j].Hits })
+	if len(entries) > topEntries {
+		entries = entries[:topEntries]
+	}
+
+	return Stats{
+		Entries:     c.order.Len(),
+		Bytes:       c.bytes,
+		MaxEntries:  c.config.MaxEntries,
+		MaxBytes:    c.config.MaxBytes,
+		TTL:         c.config.TTL,
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+		Expirations: c.expirations,
+		Rejected:    c.rejected,
+		TopEntries:  entries,
+	}
+}
+
+// expired indica si la entrada superó su tiempo de vida
+func (c *Cache) expired(e *entry, now time.Time) bool {
+	return c.config.TTL > 0 && now.Sub(e.created) > c.config.TTL
+}
+
+// remove elimina una entrada de la lista y del mapa
+func (c *Cache) remove(element *list.Element) {
+	e := c.order.Remove(element).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLRUEviction verifica que se desaloje la entrada usada hace más tiempo y que
+// se cuenten los aciertos por entrada
+func TestLRUEviction(t *testing.T) {
+	lru := New(Config{MaxEntries: 2})
+	lru.Set("a", 1, 1)
+	lru.Set("b", 2, 1)
+	lru.Get("a") // "b" pasa a ser la usada hace más tiempo
+	lru.Set("c", 3, 1)
+
+	_, hasA := lru.Get("a")
+	_, hasB := lru.Get("b")
+	if !hasA || hasB {
+		t.Errorf("se esperaba desalojar b y conservar a (a=%v, b=%v)", hasA, hasB)
+	}
+	stats := lru.Stats()
+	if stats.Evictions != 1 {
+		t.Errorf("%d desalojos, se esperaba 1", stats.Evictions)
+	}
+	if len(stats.TopEntries) == 0 || stats.TopEntries[0].Key != "a" || stats.TopEntries[0].Hits != 2 {
+		t.Errorf("la entrada más usada debería ser a con 2 aciertos: %+v", stats.TopEntries)
+	}
+}
+
+// TestByteLimit verifica el límite y la contabilidad de bytes
+func TestByteLimit(t *testing.T) {
+	sized := New(Config{MaxBytes: 100})
+	sized.Set("a", 1, 60)
+	sized.Set("b", 2, 30)
+	sized.Set("a", 3, 10) // reemplazo: descuenta el tamaño anterior
+	if stats := sized.Stats(); stats.Bytes != 40 || stats.Entries != 2 {
+		t.Errorf("%d bytes en %d entradas, se esperaban 40 en 2", stats.Bytes, stats.Entries)
+	}
+
+	sized.Set("c", 4, 70) // excede: desaloja b (usada hace más tiempo)
+	_, hasB := sized.Get("b")
+	if stats := sized.Stats(); hasB || stats.Bytes != 80 {
+		t.Errorf("se esperaba desalojar b y quedar con 80 bytes (b=%v, %d bytes)", hasB, stats.Bytes)
+	}
+
+	sized.Set("d", 5, 101) // más grande que el límite: no se guarda
+	_, hasD := sized.Get("d")
+	if stats := sized.Stats(); hasD || stats.Rejected != 1 {
+		t.Errorf("una entrada más grande que MaxBytes no debe guardarse (d=%v, %d rechazadas)", hasD, stats.Rejected)
+	}
+}
+
+// TestTTL verifica el vencimiento de las entradas con un reloj controlado
+func TestTTL(t *testing.T) {
+	clock := time.Unix(0, 0)
+	expiring := New(Config{TTL: 20 * time.Millisecond})
+	expiring.now = func() time.Time { return clock }
+
+	expiring.Set("a", 1, 1)
+	clock = clock.Add(20 * time.Millisecond)
+	_, fresh := expiring.Get("a")
+	if age := expiring.Stats().TopEntries[0].Age; age != 20*time.Millisecond {
+		t.Errorf("antigüedad %v, se esperaba 20ms", age)
+	}
+
+	clock = clock.Add(time.Millisecond)
+	_, stale := expiring.Get("a")
+	if !fresh || stale {
+		t.Errorf("la entrada debería vencer después del TTL (al cumplirlo=%v, después=%v)", fresh, stale)
+	}
+	if stats := expiring.Stats(); stats.Expirations != 1 || stats.Entries != 0 {
+		t.Errorf("%d vencimientos y %d entradas, se esperaban 1 y 0", stats.Expirations, stats.Entries)
+	}
+
+	// Al guardar se eliminan las entradas vencidas del final de la lista
+	expiring.Set("b", 2, 1)
+	clock = clock.Add(time.Second)
+	expiring.Set("c", 3, 1)
+	if stats := expiring.Stats(); stats.Expirations != 2 || stats.Entries != 1 || stats.Bytes != 1 {
+		t.Errorf("%d vencimientos, %d entradas y %d bytes, se esperaban 2, 1 y 1", stats.Expirations, stats.Entries, stats.Bytes)
+	}
+}
+
+// TestConcurrentMetrics usa el cache desde varias goroutines y verifica que las
+// métricas cuadren con las operaciones realizadas. Con -race también detecta carreras.
+func TestConcurrentMetrics(t *testing.T) {
+	const goroutines, maxEntries, maxBytes = 16, 64, 2000
+	ops := 20000
+	if testing.Short() {
+		ops = 2000
+	}
+	shared := New(Config{MaxEntries: maxEntries, MaxBytes: maxBytes})
+
+	var wg sync.WaitGroup
+	gets := make([]int64, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < ops; i++ {
+				key := fmt.Sprintf("k%d", rng.Intn(200))
+				if rng.Intn(3) == 0 {
+					shared.Set(key, i, int64(1+rng.Intn(50)))
+				} else {
+					shared.Get(key)
+					gets[g]++
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	var total int64
+	for _, n := range gets {
+		total += n
+	}
+	stats := shared.Stats()
+	if stats.Hits+stats.Misses != total {
+		t.Errorf("%d aciertos + %d fallos != %d lecturas", stats.Hits, stats.Misses, total)
+	}
+	if stats.Entries > maxEntries || stats.Bytes > maxBytes {
+		t.Errorf("%d entradas y %d bytes exceden los límites", stats.Entries, stats.Bytes)
+	}
+	if stats.Entries != shared.Len() {
+		t.Errorf("Stats informa %d entradas y Len %d", stats.Entries, shared.Len())
+	}
+}
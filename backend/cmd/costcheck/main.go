@@ -0,0 +1,223 @@
+// Command costcheck valida el modelo de costos del optimizador: para documentos
+// sintéticos de distintas formas (objetos anchos, rutas profundas, resultados
+// grandes y rutas inexistentes) compara el tiempo estimado por librería con la
+// mediana medida del plan compilado.
+//
+// Uso:
+//
+//	go run ./cmd/costcheck -iterations 100
+//
+// La razón es medido / estimado; el resumen muestra por librería el error relativo
+// medio, útil para recalibrar optimizer.DefaultCostModel. Los tiempos son por
+// ejecución del plan compilado sobre el documento ya parseado por cada librería.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"procesador-consultas/engine"
+	"procesador-consultas/limits"
+	"procesador-consultas/optimizer"
+	"procesador-consultas/parser"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
+)
+
+// batch es el número de ejecuciones que se miden juntas en cada muestra; recorrer
+// una ruta tarda pocos nanosegundos y una sola ejecución queda por debajo de la
+// resolución del reloj
+const batch = 100
+
+// shape es un documento sintético y la consulta que se mide sobre él
+type shape struct {
+	name     string
+	document interface{}
+	query    string
+}
+
+// wideObject crea un objeto con size claves k0..k{size-1}
+func wideObject(size int) map[string]interface{} {
+	object := make(map[string]interface{}, size)
+	for i := 0; i < size; i++ {
+		object[fmt.Sprintf("k%d", i)] = i
+	}
+	return object
+}
+
+// deepObject anida depth objetos bajo la clave "n"
+func deepObject(depth int) interface{} {
+	var current interface{} = "hoja"
+	for i := 0; i < depth; i++ {
+		current = map[string]interface{}{"n": current, "x": i}
+	}
+	return current
+}
+
+// array crea un arreglo de length objetos pequeños
+func array(length int) []interface{} {
+	items := make([]interface{}, length)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": i, "v": "x"}
+	}
+	return items
+}
+
+// shapes retorna los casos que se miden
+func shapes() []shape {
+	return []shape{
+		{"objeto de 10 claves", wideObject(10), "k5"},
+		{"objeto de 1000 claves", wideObject(1000), "k500"},
+		{"clave inexistente en 1000", wideObject(1000), "falta"},
+		{"8 niveles", deepObject(8), strings.TrimSuffix(strings.Repeat("n.", 8), ".")},
+		{"32 niveles", deepObject(32), strings.TrimSuffix(strings.Repeat("n.", 32), ".")},
+		{"índice en arreglo de 1000", map[string]interface{}{"a": array(1000)}, "a[999].id"},
+		{"resultado de 100 elementos", map[string]interface{}{"a": array(100)}, "a"},
+		{"resultado de 1000 elementos", map[string]interface{}{"a": array(1000)}, "a"},
+	}
+}
+
+// runners retorna, por librería, la ejecución del plan compilado sobre el documento
+// parseado por esa librería
+func runners(ctx context.Context, compiled *engine.CompiledPlan, jsonStr string) (map[string]func(), error) {
+	var standardData, iteratorData interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &standardData); err != nil {
+		return nil, err
+	}
+	if err := jsoniter.UnmarshalFromString(jsonStr, &iteratorData); err != nil {
+		return nil, err
+	}
+	fastValue, err := fastjson.Parse(jsonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]func(){
+		"standard":      func() { compiled.Run(ctx, standardData) },
+		"json-iterator": func() { compiled.Run(ctx, iteratorData) },
+		"fastjson": func() {
+			if value, failed, _ := compiled.RunFastJSON(ctx, fastValue); failed < 0 {
+				toInterface(value)
+			}
+		},
+	}, nil
+}
+
+// toInterface convierte un resultado de fastjson a valores genéricos como lo hace el
+// motor al responder; el modelo de costos incluye esa conversión en el perfil de fastjson
+func toInterface(v *fastjson.Value) interface{} {
+	switch v.Type() {
+	case fastjson.TypeNull:
+		return nil
+	case fastjson.TypeTrue:
+		return true
+	case fastjson.TypeFalse:
+		return false
+	case fastjson.TypeNumber:
+		return v.GetFloat64()
+	case fastjson.TypeString:
+		return string(v.GetStringBytes())
+	case fastjson.TypeObject:
+		result := make(map[string]interface{})
+		v.GetObject().Visit(func(key []byte, value *fastjson.Value) {
+			result[string(key)] = toInterface(value)
+		})
+		return result
+	default:
+		items := v.GetArray()
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			result[i] = toInterface(item)
+		}
+		return result
+	}
+}
+
+// median mide warmup + iterations muestras de batch ejecuciones y retorna la
+// mediana del tiempo por ejecución, sin las muestras de calentamiento
+func median(run func(), warmup, iterations int) time.Duration {
+	samples := make([]time.Duration, 0, iterations)
+	for i := 0; i < warmup+iterations; i++ {
+		start := time.Now()
+		for j := 0; j < batch; j++ {
+			run()
+		}
+		if i >= warmup {
+			samples = append(samples, time.Since(start)/batch)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples[len(samples)/2]
+}
+
+func main() {
+	iterations := flag.Int("iterations", 100, "muestras por caso")
+	warmup := flag.Int("warmup", 10, "muestras de calentamiento descartadas")
+	flag.Parse()
+	if *iterations < 1 || *warmup < 0 {
+		fmt.Fprintln(os.Stderr, "-iterations debe ser al menos 1 y -warmup no puede ser negativo")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	relativeErrors := map[string][]float64{}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "caso\tlibrería\testimado\tmedido (mediana)\trazón\t")
+	for _, s := range shapes() {
+		encoded, _ := json.Marshal(s.document)
+		keys, err := parser.ParseQueryString(s.query)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		// Optimizador nuevo por caso: el plan y sus estadísticas corresponden a este documento
+		config := engine.DefaultOptimizationConfig()
+		config.Limits = limits.Default()
+		planner := optimizer.NewOptimizer(config)
+		plan, err := planner.OptimizeQuery(ctx, keys, s.document)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", s.name, err)
+			os.Exit(1)
+		}
+		runs, err := runners(ctx, engine.CompilePlan(plan), string(encoded))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", s.name, err)
+			os.Exit(1)
+		}
+
+		for _, library := range engine.Libraries {
+			estimated := planner.EstimateQueryTime(plan, library)
+			measured := median(runs[library], *warmup, *iterations)
+			ratio := 0.0
+			if estimated > 0 {
+				ratio = float64(measured) / float64(estimated)
+				relativeErrors[library] = append(relativeErrors[library], math.Abs(ratio-1))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%.2f\t\n", s.name, library, estimated, measured, ratio)
+		}
+	}
+	w.Flush()
+
+	fmt.Println()
+	for _, library := range engine.Libraries {
+		errors := relativeErrors[library]
+		var sum float64
+		for _, e := range errors {
+			sum += e
+		}
+		if len(errors) > 0 {
+			fmt.Printf("%s: error relativo medio %.0f%% en %d casos\n", library, 100*sum/float64(len(errors)), len(errors))
+		}
+	}
+}
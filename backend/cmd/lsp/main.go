@@ -0,0 +1,38 @@
+// Command lsp ejecuta el servidor de lenguaje de las consultas sobre stdin/stdout.
+//
+// Uso:
+//
+//	go run ./cmd/lsp -sample ejemplo.json
+//
+// El documento de ejemplo también se puede indicar desde el editor con
+// initializationOptions.sample.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"procesador-consultas/lsp"
+)
+
+func main() {
+	samplePath := flag.String("sample", "", "documento JSON de ejemplo para completion, hover y lint")
+	flag.Parse()
+
+	var options lsp.Options
+	if *samplePath != "" {
+		sample, err := lsp.LoadSample(*samplePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		options.Sample = sample
+	}
+
+	if err := lsp.Serve(context.Background(), os.Stdin, os.Stdout, options); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,88 @@
+// Command plangraph exporta el plan de una consulta o el AST de un documento como
+// grafo de Graphviz (DOT) o de Mermaid, para material de clase y depuración.
+//
+// Uso:
+//
+//	go run ./cmd/plangraph -json documento.json -query 'store.products[0].name' | dot -Tsvg > plan.svg
+//	go run ./cmd/plangraph -json documento.json -graph ast -format mermaid -depth 3 -width 5
+//
+// Sin -json lee el documento de la entrada estándar.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"procesador-consultas/engine"
+	"procesador-consultas/optimizer"
+	"procesador-consultas/parser"
+)
+
+func main() {
+	jsonPath := flag.String("json", "", "archivo JSON; sin él se lee la entrada estándar")
+	query := flag.String("query", "", "consulta cuyo plan se exporta (requerida con -graph plan)")
+	graph := flag.String("graph", "plan", "grafo a exportar: plan o ast")
+	format := flag.String("format", "dot", "formato de salida: dot o mermaid")
+	depth := flag.Int("depth", 4, "niveles de contenedores del AST que se expanden; 0 sin límite")
+	width := flag.Int("width", 10, "hijos por contenedor del AST que se muestran; 0 sin límite")
+	flag.Parse()
+
+	if *format != "dot" && *format != "mermaid" {
+		fail(fmt.Errorf("formato desconocido: %q (se esperaba dot o mermaid)", *format))
+	}
+
+	var data []byte
+	var err error
+	if *jsonPath != "" {
+		data, err = os.ReadFile(*jsonPath)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	ctx := context.Background()
+	eng := engine.NewOptimizedEngine()
+
+	switch *graph {
+	case "plan":
+		keys, err := parser.ParseQueryString(*query)
+		if err != nil {
+			fail(err)
+		}
+		explanation, err := eng.Explain(ctx, string(data), keys, engine.ExplainOptions{Library: "standard"})
+		if err != nil {
+			fail(err)
+		}
+		if *format == "mermaid" {
+			fmt.Print(optimizer.PlanToMermaid(explanation.Plan))
+		} else {
+			fmt.Print(optimizer.PlanToDOT(explanation.Plan))
+		}
+
+	case "ast":
+		ast, err := eng.DocumentAST(ctx, string(data))
+		if err != nil {
+			fail(err)
+		}
+		options := optimizer.GraphOptions{MaxDepth: *depth, MaxWidth: *width}
+		if *format == "mermaid" {
+			fmt.Print(optimizer.ASTToMermaid(ast, options))
+		} else {
+			fmt.Print(optimizer.ASTToDOT(ast, options))
+		}
+
+	default:
+		fail(fmt.Errorf("grafo desconocido: %q (se esperaba plan o ast)", *graph))
+	}
+}
+
+// fail muestra el error y termina con código 1
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,312 @@
+package completion
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"procesador-consultas/lexer"
+	"procesador-consultas/parser"
+	"procesador-consultas/queryerr"
+	"procesador-consultas/suggest"
+)
+
+// MaxCandidates es el número máximo de candidatos que se retornan
+const MaxCandidates = 100
+
+// maxPreview es la longitud máxima de la vista previa de un valor
+const maxPreview = 40
+
+// Contextos en los que puede estar el cursor
+const (
+	ContextStart   = "start"   // inicio de la consulta
+	ContextDot     = "dot"     // después de un punto: a.|
+	ContextBracket = "bracket" // después de un corchete: a[|
+	ContextNext    = "next"    // después de un segmento completo: a|, se sugiere .clave o [i]
+)
+
+// Tipos de candidato
+const (
+	KindKey   = "key"
+	KindIndex = "index"
+)
+
+// Candidate es un posible siguiente segmento
+type Candidate struct {
+	Label      string `json:"label"`
+	Kind       string `json:"kind"`
+	Type       string `json:"type"`
+	Detail     string `json:"detail"`
+	InsertText string `json:"insert_text"`
+}
+
+// Result contiene los candidatos y el fragmento de la consulta que reemplazan
+type Result struct {
+	Context     string                      `json:"context"`
+	Path        []string                    `json:"path"`
+	Partial     string                      `json:"partial"`
+	Replace     queryerr.Span               `json:"replace"`
+	Candidates  []Candidate                 `json:"candidates"`
+	Truncated   bool                        `json:"truncated"`
+	Diagnostics []queryerr.SyntaxDiagnostic `json:"diagnostics,omitempty"`
+}
+
+// Complete propone los segmentos que pueden seguir a la consulta en la posición del
+// cursor, expresada en caracteres (runas) desde el inicio de la consulta.
+//
+// Los tokens del lexer anteriores al cursor determinan el contexto: el token que
+// toca el cursor es el segmento parcial que se reemplaza, y la ruta anterior al
+// último punto o corchete se resuelve sobre el documento (decodificado con
+// encoding/json) para listar sus claves o índices con el tipo de cada valor.
+func Complete(query string, cursor int, document interface{}) Result {
+	cursorByte := byteOffset(query, cursor)
+	prefix := query[:cursorByte]
+	cursorPos := queryerr.PositionAt(query, cursorByte)
+
+	result := Result{
+		Context:    ContextStart,
+		Path:       []string{},
+		Replace:    queryerr.Span{Start: cursorPos, End: cursorPos},
+		Candidates: []Candidate{},
+	}
+
+	tokens := lexer.NewLexer(prefix).Tokenize()
+	tokens = tokens[:len(tokens)-1] // sin EOF
+
+	// Segmento parcial: el último token termina justo en el cursor
+	quoted := false
+	if n := len(tokens); n > 0 {
+		last := tokens[n-1]
+		touches := last.Offset+len(last.Literal) == cursorByte
+		switch {
+		case touches && (last.Type == lexer.TOKEN_IDENTIFIER || last.Type == lexer.TOKEN_NUMBER):
+			result.Partial = last.Literal
+		case touches && last.Type == lexer.TOKEN_STRING:
+			result.Partial, _ = lexer.Unquote(last.Literal)
+			quoted = true
+		case touches && last.Type == lexer.TOKEN_ERROR && strings.HasPrefix(last.Literal, `"`):
+			// Cadena que se está escribiendo: "nom|
+			result.Partial = last.Literal[1:]
+			quoted = true
+		default:
+			last.Type = lexer.TOKEN_EOF
+		}
+		if last.Type != lexer.TOKEN_EOF {
+			result.Replace.Start = queryerr.Position{Offset: last.Offset, Line: last.Line, Column: last.Column}
+			tokens = tokens[:n-1]
+		}
+	}
+
+	// Contexto según el token anterior al segmento parcial
+	pathEnd := result.Replace.Start.Offset
+	if n := len(tokens); n > 0 {
+		switch previous := tokens[n-1]; previous.Type {
+		case lexer.TOKEN_DOT:
+			result.Context = ContextDot
+			pathEnd = previous.Offset
+		case lexer.TOKEN_LBRACKET:
+			result.Context = ContextBracket
+			pathEnd = previous.Offset
+		default:
+			result.Context = ContextNext
+		}
+	}
+
+	if strings.TrimSpace(prefix[:pathEnd]) != "" {
+		parsed, err := parser.Parse(prefix[:pathEnd])
+		if err != nil {
+			result.Diagnostics = queryerr.From(err).Diagnostics
+			return result
+		}
+		result.Path = parsed.Keys()
+	}
+
+	value, ok := Resolve(document, result.Path)
+	if !ok {
+		return result
+	}
+
+	closeBracket := result.Context == ContextBracket && !strings.HasPrefix(query[cursorByte:], "]")
+	result.Candidates, result.Truncated = candidates(value, result.Context, result.Partial, quoted, closeBracket)
+	return result
+}
+
+// candidates lista las claves o índices del valor que coinciden con el segmento parcial
+func candidates(value interface{}, context, partial string, quoted, closeBracket bool) ([]Candidate, bool) {
+	var list []Candidate
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		for _, key := range matchKeys(keys, partial) {
+			list = append(list, Candidate{
+				Label:      key,
+				Kind:       KindKey,
+				Type:       TypeName(v[key]),
+				Detail:     Detail(v[key]),
+				InsertText: insertKey(key, context, quoted, closeBracket),
+			})
+		}
+
+	case []interface{}:
+		for i, item := range v {
+			index := strconv.Itoa(i)
+			if !strings.HasPrefix(index, partial) || quoted {
+				continue
+			}
+			list = append(list, Candidate{
+				Label:      index,
+				Kind:       KindIndex,
+				Type:       TypeName(item),
+				Detail:     Detail(item),
+				InsertText: insertIndex(index, context, closeBracket),
+			})
+			if len(list) > MaxCandidates {
+				break
+			}
+		}
+	}
+
+	if len(list) > MaxCandidates {
+		return list[:MaxCandidates], true
+	}
+	if list == nil {
+		list = []Candidate{}
+	}
+	return list, false
+}
+
+// matchKeys ordena las claves que empiezan por el segmento parcial (sin distinguir
+// mayúsculas); si ninguna empieza así, usa las claves parecidas por distancia de edición
+func matchKeys(keys []string, partial string) []string {
+	sort.Strings(keys)
+	if partial == "" {
+		return keys
+	}
+
+	lowered := strings.ToLower(partial)
+	var matches []string
+	for _, key := range keys {
+		if strings.HasPrefix(strings.ToLower(key), lowered) {
+			matches = append(matches, key)
+		}
+	}
+	if len(matches) == 0 {
+		matches = suggest.Keys(partial, keys)
+	}
+	return matches
+}
+
+// insertKey retorna el texto que inserta una clave según el contexto
+func insertKey(key, context string, quoted, closeBracket bool) string {
+	text := key
+	if quoted || context == ContextBracket || !lexer.IsIdentifier(key) {
+		text = parser.FormatKeys([]string{key})
+		if !strings.HasPrefix(text, `"`) {
+			// Claves numéricas dentro de comillas o corchetes
+			text = strconv.Quote(key)
+		}
+	}
+
+	switch context {
+	case ContextNext:
+		return "." + text
+	case ContextBracket:
+		if closeBracket {
+			return text + "]"
+		}
+	}
+	return text
+}
+
+// insertIndex retorna el texto que inserta un índice según el contexto
+func insertIndex(index, context string, closeBracket bool) string {
+	switch context {
+	case ContextNext, ContextStart:
+		return "[" + index + "]"
+	case ContextBracket:
+		if closeBracket {
+			return index + "]"
+		}
+	}
+	return index
+}
+
+// Resolve recorre la ruta sobre el documento decodificado con encoding/json
+func Resolve(document interface{}, path []string) (interface{}, bool) {
+	current := document
+	for _, key := range path {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			next, exists := v[key]
+			if !exists {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			current = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// TypeName retorna el nombre del tipo JSON de un valor
+func TypeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// Detail resume un valor para mostrarlo junto a un candidato
+func Detail(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return fmt.Sprintf("{%d claves}", len(v))
+	case []interface{}:
+		return fmt.Sprintf("[%d elementos]", len(v))
+	}
+
+	preview, _ := json.Marshal(value)
+	if utf8.RuneCount(preview) > maxPreview {
+		runes := []rune(string(preview))
+		return string(runes[:maxPreview-1]) + "…"
+	}
+	return string(preview)
+}
+
+// byteOffset convierte una posición en caracteres en un offset en bytes
+func byteOffset(text string, cursor int) int {
+	if cursor <= 0 {
+		return 0
+	}
+	for i := range text {
+		if cursor == 0 {
+			return i
+		}
+		cursor--
+	}
+	return len(text)
+}
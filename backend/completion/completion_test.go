@@ -0,0 +1,179 @@
+package completion
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"procesador-consultas/queryerr"
+)
+
+// document es el documento de las pruebas: claves que requieren comillas, una clave
+// numérica, una clave no ASCII y un arreglo de doce elementos
+const document = `{
+	"usuario": {"nombre": "Ana", "nota": null, "año": 2024, "a.b": 1, "0": "cero", "Nivel": true},
+	"items": [{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}, {"id": 5}, {"id": 6},
+	          {"id": 7}, {"id": 8}, {"id": 9}, {"id": 10}, {"id": 11}, {"id": 12}]
+}`
+
+// decode decodifica un documento de prueba
+func decode(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// span construye un fragmento de la primera línea a partir de offsets en bytes y
+// columnas en caracteres
+func span(startOffset, startColumn, endOffset, endColumn int) queryerr.Span {
+	return queryerr.Span{
+		Start: queryerr.Position{Offset: startOffset, Line: 1, Column: startColumn},
+		End:   queryerr.Position{Offset: endOffset, Line: 1, Column: endColumn},
+	}
+}
+
+// indexes retorna los candidatos "i=>texto" de los índices indicados
+func indexes(format string, from, to int) []string {
+	var list []string
+	for i := from; i <= to; i++ {
+		list = append(list, fmt.Sprintf("%d=>"+format, i, i))
+	}
+	return list
+}
+
+// TestComplete verifica el contexto, la ruta, el segmento parcial, el fragmento que
+// se reemplaza y los candidatos con su texto a insertar ("etiqueta=>texto")
+func TestComplete(t *testing.T) {
+	doc := decode(t, document)
+	userKeys := func(prefix string) []string {
+		return []string{`0=>` + prefix + `"0"`, `Nivel=>` + prefix + `Nivel`, `a.b=>` + prefix + `"a.b"`,
+			`año=>` + prefix + `año`, `nombre=>` + prefix + `nombre`, `nota=>` + prefix + `nota`}
+	}
+
+	cases := []struct {
+		name       string
+		query      string
+		cursor     int
+		context    string
+		path       []string
+		partial    string
+		replace    queryerr.Span
+		candidates []string
+	}{
+		{"consulta vacía", "", 0, ContextStart, []string{}, "", span(0, 1, 0, 1), []string{"items=>items", "usuario=>usuario"}},
+		{"inicio con segmento parcial", "usu", 3, ContextStart, []string{}, "usu", span(0, 1, 3, 4), []string{"usuario=>usuario"}},
+		{"después de un punto", "usuario.", 8, ContextDot, []string{"usuario"}, "", span(8, 9, 8, 9), userKeys("")},
+		{"prefijo", "usuario.no", 10, ContextDot, []string{"usuario"}, "no", span(8, 9, 10, 11), []string{"nombre=>nombre", "nota=>nota"}},
+		{"prefijo sin mayúsculas", "usuario.NO", 10, ContextDot, []string{"usuario"}, "NO", span(8, 9, 10, 11), []string{"nombre=>nombre", "nota=>nota"}},
+		{"clave parecida", "usuario.nmbre", 13, ContextDot, []string{"usuario"}, "nmbre", span(8, 9, 13, 14), []string{"nombre=>nombre"}},
+		{"cursor en medio", "usuario.nombre", 10, ContextDot, []string{"usuario"}, "no", span(8, 9, 10, 11), []string{"nombre=>nombre", "nota=>nota"}},
+		{"cursor fuera de la consulta", "usuario.", 99, ContextDot, []string{"usuario"}, "", span(8, 9, 8, 9), userKeys("")},
+
+		{"siguiente segmento de un objeto", "usuario ", 8, ContextNext, []string{"usuario"}, "", span(8, 9, 8, 9), userKeys(".")},
+		{"siguiente segmento de un arreglo", "items ", 6, ContextNext, []string{"items"}, "", span(6, 7, 6, 7), indexes("[%d]", 0, 11)},
+
+		{"corchete en un arreglo", "items[", 6, ContextBracket, []string{"items"}, "", span(6, 7, 6, 7), indexes("%d]", 0, 11)},
+		{"índice parcial", "items[1", 7, ContextBracket, []string{"items"}, "1", span(6, 7, 7, 8), []string{"1=>1]", "10=>10]", "11=>11]"}},
+		{"corchete ya cerrado", "items[1]", 7, ContextBracket, []string{"items"}, "1", span(6, 7, 7, 8), []string{"1=>1", "10=>10", "11=>11"}},
+		{"índice después de un punto", "items.1", 7, ContextDot, []string{"items"}, "1", span(6, 7, 7, 8), []string{"1=>1", "10=>10", "11=>11"}},
+		{"cadena en un arreglo", `items["`, 7, ContextBracket, []string{"items"}, "", span(6, 7, 7, 8), nil},
+
+		{"cadena sin cerrar", `usuario["a`, 10, ContextBracket, []string{"usuario"}, "a", span(8, 9, 10, 11), []string{`a.b=>"a.b"]`, `año=>"año"]`}},
+		{"cadena cerrada antes de ]", `usuario["a"]`, 11, ContextBracket, []string{"usuario"}, "a", span(8, 9, 11, 12), []string{`a.b=>"a.b"`, `año=>"año"`}},
+		{"cadena con escapes", `usuario["a\u00f1"`, 17, ContextBracket, []string{"usuario"}, "añ", span(8, 9, 17, 18), []string{`año=>"año"]`}},
+		{"cadena después de un punto", `usuario."N`, 10, ContextDot, []string{"usuario"}, "N", span(8, 9, 10, 11), []string{`Nivel=>"Nivel"`, `nombre=>"nombre"`, `nota=>"nota"`}},
+
+		// El cursor se cuenta en caracteres: "usuario.añ" son 10 caracteres y 11 bytes
+		{"consulta no ASCII", "usuario.año.x", 10, ContextDot, []string{"usuario"}, "añ", span(8, 9, 11, 11), []string{"año=>año"}},
+		{"ruta no ASCII", "usuario.año.", 12, ContextDot, []string{"usuario", "año"}, "", span(13, 13, 13, 13), nil},
+		{"ruta inexistente", "falta.", 6, ContextDot, []string{"falta"}, "", span(6, 7, 6, 7), nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := Complete(tc.query, tc.cursor, doc)
+
+			var got []string
+			for _, candidate := range result.Candidates {
+				got = append(got, candidate.Label+"=>"+candidate.InsertText)
+			}
+			if result.Context != tc.context || !reflect.DeepEqual(result.Path, tc.path) || result.Partial != tc.partial ||
+				result.Replace != tc.replace || !reflect.DeepEqual(got, tc.candidates) {
+				t.Errorf("se obtuvo   %s %q %q %+v %q\nse esperaba %s %q %q %+v %q",
+					result.Context, result.Path, result.Partial, result.Replace, got,
+					tc.context, tc.path, tc.partial, tc.replace, tc.candidates)
+			}
+			if result.Truncated || len(result.Diagnostics) > 0 {
+				t.Errorf("truncado: %v, diagnósticos: %+v", result.Truncated, result.Diagnostics)
+			}
+			if result.Candidates == nil {
+				t.Error("Candidates debe ser una lista vacía, no nil")
+			}
+		})
+	}
+}
+
+// TestCompleteCandidateDetails verifica el tipo y la vista previa de los candidatos
+func TestCompleteCandidateDetails(t *testing.T) {
+	doc := decode(t, `{"o": {"a": 1}, "l": [1, 2], "s": "`+strings.Repeat("x", 50)+`", "n": null, "b": false}`)
+
+	want := map[string][2]string{
+		"o": {"object", "{1 claves}"},
+		"l": {"array", "[2 elementos]"},
+		"s": {"string", `"` + strings.Repeat("x", 38) + "…"},
+		"n": {"null", "null"},
+		"b": {"boolean", "false"},
+	}
+	for _, candidate := range Complete("", 0, doc).Candidates {
+		if got := [2]string{candidate.Type, candidate.Detail}; got != want[candidate.Label] || candidate.Kind != KindKey {
+			t.Errorf("%s: %s %q (%s), se esperaba %q", candidate.Label, candidate.Type, candidate.Detail, candidate.Kind, want[candidate.Label])
+		}
+	}
+}
+
+// TestCompleteSyntaxError verifica que una ruta inválida retorne sus diagnósticos
+// sin candidatos
+func TestCompleteSyntaxError(t *testing.T) {
+	result := Complete("usuario..x", 10, decode(t, document))
+	if len(result.Diagnostics) == 0 || len(result.Candidates) != 0 {
+		t.Errorf("se esperaban diagnósticos sin candidatos: %+v", result)
+	}
+}
+
+// TestCompleteTruncated verifica que se retornen como máximo MaxCandidates
+// candidatos y que Truncated lo indique
+func TestCompleteTruncated(t *testing.T) {
+	items := make([]interface{}, MaxCandidates+50)
+	keys := make(map[string]interface{}, MaxCandidates+50)
+	for i := range items {
+		items[i] = float64(i)
+		keys[fmt.Sprintf("k%03d", i)] = float64(i)
+	}
+	doc := map[string]interface{}{"arreglo": items, "objeto": keys, "justo": items[:MaxCandidates]}
+
+	cases := []struct {
+		query     string
+		count     int
+		truncated bool
+		last      string
+	}{
+		{"arreglo[", MaxCandidates, true, "99]"},
+		{"objeto.", MaxCandidates, true, "k099"},
+		{"justo[", MaxCandidates, false, "99]"},
+		// 1, 10-19 y 100-149
+		{"arreglo[1", 61, false, "149]"},
+	}
+	for _, tc := range cases {
+		result := Complete(tc.query, len(tc.query), doc)
+		count := len(result.Candidates)
+		if count != tc.count || result.Truncated != tc.truncated || count == 0 || result.Candidates[count-1].InsertText != tc.last {
+			t.Errorf("%q: %d candidatos (truncado: %v), se esperaban %d (truncado: %v) terminando en %q",
+				tc.query, count, result.Truncated, tc.count, tc.truncated, tc.last)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"procesador-consultas/queryerr"
+)
+
+// Libraries lista las librerías soportadas en el orden canónico
+var Libraries = []string{"standard", "json-iterator", "fastjson"}
+
+const (
+	defaultBenchmarkWarmup     = 5
+	defaultBenchmarkIterations = 30
+	defaultBenchmarkConfidence = 0.95
+	maxBenchmarkWarmup         = 100
+	maxBenchmarkIterations     = 1000
+)
+
+// BenchmarkConfig contiene la configuración del modo benchmark
+type BenchmarkConfig struct {
+	Warmup     int     `json:"warmup"`
+	Iterations int     `json:"iterations"`
+	Randomize  *bool   `json:"randomize,omitempty"`
+	Seed       int64   `json:"seed,omitempty"`
+	Confidence float64 `json:"confidence"`
+}
+
+// DefaultBenchmarkConfig retorna la configuración por defecto del benchmark
+func DefaultBenchmarkConfig() BenchmarkConfig {
+	randomize := true
+	return BenchmarkConfig{
+		Warmup:     defaultBenchmarkWarmup,
+		Iterations: defaultBenchmarkIterations,
+		Randomize:  &randomize,
+		Confidence: defaultBenchmarkConfidence,
+	}
+}
+
+// UnmarshalJSON decodifica la configuración sobre DefaultBenchmarkConfig, de modo
+// que los campos ausentes en la solicitud conservan su valor por defecto
+func (c *BenchmarkConfig) UnmarshalJSON(data []byte) error {
+	type plain BenchmarkConfig
+	config := plain(DefaultBenchmarkConfig())
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	*c = BenchmarkConfig(config)
+	return nil
+}
+
+// Validate rechaza los valores que Normalize no puede corregir sin cambiar lo
+// pedido: calentamiento negativo, menos de una iteración o un nivel de confianza
+// fuera de (0, 1). Los valores por encima de los máximos se acotan en Normalize.
+func (c BenchmarkConfig) Validate() error {
+	if c.Warmup < 0 {
+		return queryerr.New(queryerr.CodeInvalidRequest, "benchmark.warmup no puede ser negativo: %d", c.Warmup)
+	}
+	if c.Iterations < 1 {
+		return queryerr.New(queryerr.CodeInvalidRequest, "benchmark.iterations debe ser al menos 1: %d", c.Iterations)
+	}
+	if c.Confidence <= 0 || c.Confidence >= 1 {
+		return queryerr.New(queryerr.CodeInvalidRequest, "benchmark.confidence debe estar entre 0 y 1: %g", c.Confidence)
+	}
+	return nil
+}
+
+// Normalize completa los valores faltantes y acota los valores fuera de rango
+func (c *BenchmarkConfig) Normalize() {
+	defaults := DefaultBenchmarkConfig()
+
+	if c.Warmup < 0 {
+		c.Warmup = 0
+	}
+	if c.Warmup > maxBenchmarkWarmup {
+		c.Warmup = maxBenchmarkWarmup
+	}
+	if c.Iterations <= 0 {
+		c.Iterations = defaults.Iterations
+	}
+	if c.Iterations > maxBenchmarkIterations {
+		c.Iterations = maxBenchmarkIterations
+	}
+	if c.Randomize == nil {
+		c.Randomize = defaults.Randomize
+	}
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+	if c.Confidence <= 0 || c.Confidence >= 1 {
+		c.Confidence = defaults.Confidence
+	}
+}
+
+// BenchmarkStats contiene el resumen estadístico de una serie de mediciones
+type BenchmarkStats struct {
+	Samples int           `json:"samples"`
+	Mean    time.Duration `json:"mean"`
+	Median  time.Duration `json:"median"`
+	P95     time.Duration `json:"p95"`
+	Min     time.Duration `json:"min"`
+	Max     time.Duration `json:"max"`
+	StdDev  time.Duration `json:"stddev"`
+	CILow   time.Duration `json:"ci_low"`
+	CIHigh  time.Duration `json:"ci_high"`
+}
+
+// LibraryBenchmark contiene las mediciones de una librería en modo benchmark
+type LibraryBenchmark struct {
+	Library   string         `json:"library"`
+	Value     interface{}    `json:"value"`
+	Found     bool           `json:"found"`
+	Error     string         `json:"error,omitempty"`
+	ParseTime BenchmarkStats `json:"parse_time"`
+	QueryTime BenchmarkStats `json:"query_time"`
+	TotalTime BenchmarkStats `json:"total_time"`
+}
+
+// ComparisonResponse representa el resultado de una comparación en modo benchmark
+type ComparisonResponse struct {
+	Mode        string                       `json:"mode"`
+	Config      BenchmarkConfig              `json:"config"`
+	Libraries   map[string]*LibraryBenchmark `json:"libraries"`
+	Ranking     []string                     `json:"ranking"`
+	Winner      string                       `json:"winner,omitempty"`
+	Significant bool                         `json:"significant"`
+	Elapsed     time.Duration                `json:"elapsed"`
+}
+
+// queryRunner ejecuta una consulta con una librería concreta
+type queryRunner func(ctx context.Context, jsonStr string, keys []string) QueryResult
+
+// runnerFor retorna la función de consulta de una librería
+func (e *Engine) runnerFor(library string) queryRunner {
+	switch library {
+	case "json-iterator":
+		return e.QueryWithJsonIterator
+	case "fastjson":
+		return e.QueryWithFastJSON
+	default:
+		return e.QueryWithStandardLibrary
+	}
+}
+
+// BenchmarkPerformance compara las librerías ejecutando varias iteraciones medidas.
+// Si el contexto termina antes de completar las iteraciones retorna ErrQueryCanceled,
+// y si el documento excede los límites de recursos retorna el *queryerr.Error correspondiente.
+func (e *Engine) BenchmarkPerformance(ctx context.Context, jsonStr string, keys []string, config BenchmarkConfig) (*ComparisonResponse, error) {
+	start := time.Now()
+	config.Normalize()
+
+	rng := rand.New(rand.NewSource(config.Seed))
+	order := make([]string, len(Libraries))
+	copy(order, Libraries)
+
+	samples := make(map[string]*benchmarkSamples, len(Libraries))
+	response := &ComparisonResponse{
+		Mode:      "benchmark",
+		Config:    config,
+		Libraries: make(map[string]*LibraryBenchmark, len(Libraries)),
+	}
+	for _, library := range Libraries {
+		samples[library] = &benchmarkSamples{}
+		response.Libraries[library] = &LibraryBenchmark{Library: library}
+	}
+
+	total := config.Warmup + config.Iterations
+	for i := 0; i < total; i++ {
+		if ctx.Err() != nil {
+			return nil, canceledError(ctx)
+		}
+
+		// Aleatorizar el orden en cada iteración para repartir efectos de cache y GC
+		if *config.Randomize {
+			rng.Shuffle(len(order), func(a, b int) {
+				order[a], order[b] = order[b], order[a]
+			})
+		}
+
+		for _, library := range order {
+			result := e.runnerFor(library)(ctx, jsonStr, keys)
+			if result.Canceled() {
+				return nil, result.Err
+			}
+			// Los límites de recursos dependen del documento, no de la librería
+			if result.ErrorCode.IsLimit() {
+				return nil, result.Err
+			}
+
+			bench := response.Libraries[library]
+			bench.Value = result.Value
+			bench.Found = result.Found
+			bench.Error = result.Error
+
+			// Una ruta inexistente no invalida la medición
+			if result.ErrorCode == queryerr.CodePathNotFound {
+				bench.Error = ""
+			}
+
+			// Las iteraciones de calentamiento no se registran
+			if i < config.Warmup {
+				continue
+			}
+			samples[library].add(result.Performance)
+		}
+	}
+
+	for _, library := range Libraries {
+		s := samples[library]
+		bench := response.Libraries[library]
+		bench.ParseTime = summarize(s.parse, config.Confidence)
+		bench.QueryTime = summarize(s.query, config.Confidence)
+		bench.TotalTime = summarize(s.total, config.Confidence)
+	}
+
+	response.rank()
+	response.Elapsed = time.Since(start)
+
+	return response, nil
+}
+
+// rank ordena las librerías por mediana del tiempo total y decide el ganador
+func (r *ComparisonResponse) rank() {
+	var ranking []string
+	for _, library := range Libraries {
+		if r.Libraries[library].Error == "" {
+			ranking = append(ranking, library)
+		}
+	}
+
+	sort.SliceStable(ranking, func(a, b int) bool {
+		return r.Libraries[ranking[a]].TotalTime.Median < r.Libraries[ranking[b]].TotalTime.Median
+	})
+	r.Ranking = ranking
+
+	if len(ranking) == 0 {
+		return
+	}
+	r.Winner = ranking[0]
+
+	// El ganador es significativo solo si su intervalo no se solapa con el segundo
+	if len(ranking) > 1 {
+		first := r.Libraries[ranking[0]].TotalTime
+		second := r.Libraries[ranking[1]].TotalTime
+		r.Significant = first.CIHigh < second.CILow
+	}
+}
+
+// benchmarkSamples acumula las mediciones de una librería
+type benchmarkSamples struct {
+	parse []time.Duration
+	query []time.Duration
+	total []time.Duration
+}
+
+// add registra las métricas de una ejecución
+func (s *benchmarkSamples) add(p Performance) {
+	s.parse = append(s.parse, p.ParseTime)
+	s.query = append(s.query, p.QueryTime)
+	s.total = append(s.total, p.TotalTime)
+}
+
+// summarize calcula media, mediana, percentil 95, desviación estándar e intervalo de confianza
+func summarize(samples []time.Duration, confidence float64) BenchmarkStats {
+	n := len(samples)
+	if n == 0 {
+		return BenchmarkStats{}
+	}
+
+	sorted := make([]time.Duration, n)
+	copy(sorted, samples)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+
+	var sum float64
+	for _, d := range sorted {
+		sum += float64(d)
+	}
+	mean := sum / float64(n)
+
+	var variance float64
+	if n > 1 {
+		for _, d := range sorted {
+			diff := float64(d) - mean
+			variance += diff * diff
+		}
+		// Varianza muestral (corrección de Bessel)
+		variance /= float64(n - 1)
+	}
+	stddev := math.Sqrt(variance)
+
+	margin := 0.0
+	if n > 1 {
+		margin = criticalValue(confidence, n-1) * stddev / math.Sqrt(float64(n))
+	}
+
+	low := mean - margin
+	if low < 0 {
+		low = 0
+	}
+
+	return BenchmarkStats{
+		Samples: n,
+		Mean:    time.Duration(mean),
+		Median:  percentile(sorted, 0.50),
+		P95:     percentile(sorted, 0.95),
+		Min:     sorted[0],
+		Max:     sorted[n-1],
+		StdDev:  time.Duration(stddev),
+		CILow:   time.Duration(low),
+		CIHigh:  time.Duration(mean + margin),
+	}
+}
+
+// percentile calcula un percentil por interpolación lineal sobre muestras ordenadas
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+
+	weight := rank - float64(lower)
+	return time.Duration(float64(sorted[lower])*(1-weight) + float64(sorted[upper])*weight)
+}
+
+// criticalValue aproxima el valor crítico t de Student bilateral para el nivel de confianza dado.
+// Parte del cuantil normal y aplica la expansión de Cornish-Fisher, suficiente para df >= 2.
+func criticalValue(confidence float64, df int) float64 {
+	z := math.Sqrt2 * math.Erfinv(confidence)
+	if df <= 0 {
+		return z
+	}
+
+	v := float64(df)
+	z3 := z * z * z
+	z5 := z3 * z * z
+	return z + (z3+z)/(4*v) + (5*z5+16*z3+3*z)/(96*v*v)
+}
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"procesador-consultas/optimizer"
+
+	"github.com/valyala/fastjson"
+)
+
+// compiledStep resuelve un segmento sobre un valor decodificado con encoding/json
+// o json-iterator; retorna false si el segmento no existe
+type compiledStep func(current interface{}) (interface{}, bool)
+
+// compiledFastStep resuelve un segmento sobre un valor de fastjson
+type compiledFastStep func(current *fastjson.Value) (*fastjson.Value, bool)
+
+// CompiledPlan es un plan traducido a una cadena de funciones con las claves y los
+// índices ya resueltos: cada segmento se convierte una sola vez en una búsqueda en
+// el objeto o un acceso por índice, sin interpretar los tipos de paso ni volver a
+// convertir los índices en cada ejecución. Es inmutable y seguro para uso concurrente.
+type CompiledPlan struct {
+	keys  []string
+	steps []compiledStep
+	fast  []compiledFastStep
+	memo  []int // longitudes de los prefijos memorizados, en orden creciente
+}
+
+// CompilePlan compila un plan del optimizador. Los pasos que no navegan no generan
+// funciones; los de memoización registran la longitud del prefijo recorrido hasta
+// ellos.
+func CompilePlan(plan *optimizer.QueryPlan) *CompiledPlan {
+	keys := plan.Path()
+	compiled := &CompiledPlan{
+		keys:  keys,
+		steps: make([]compiledStep, len(keys)),
+		fast:  make([]compiledFastStep, len(keys)),
+	}
+	for i, key := range keys {
+		index, isIndex := parseIndex(key)
+		compiled.steps[i] = compileStep(key, index, isIndex)
+		compiled.fast[i] = compileFastStep(key, index, isIndex)
+	}
+
+	resolved := 0
+	for _, step := range plan.Steps {
+		resolved += len(step.Keys)
+		if step.Type == optimizer.StepMemoization && resolved > 0 &&
+			(len(compiled.memo) == 0 || compiled.memo[len(compiled.memo)-1] < resolved) {
+			compiled.memo = append(compiled.memo, resolved)
+		}
+	}
+	return compiled
+}
+
+// Keys retorna la ruta que recorre el plan compilado
+func (c *CompiledPlan) Keys() []string {
+	return c.keys
+}
+
+// MemoPoints retorna las longitudes de los prefijos que el plan memoriza
+func (c *CompiledPlan) MemoPoints() []int {
+	return c.memo
+}
+
+// memoVisitor recibe el valor resuelto por cada prefijo memorizado
+type memoVisitor func(prefix int, value interface{})
+
+// memoVisitorFastJSON es el equivalente de memoVisitor para fastjson
+type memoVisitorFastJSON func(prefix int, value *fastjson.Value)
+
+// parseIndex convierte la clave en índice con la misma regla que navigateJSON
+func parseIndex(key string) (int, bool) {
+	var index int
+	if _, err := fmt.Sscanf(key, "%d", &index); err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// compileStep crea la función de un segmento; las claves que no son índices no
+// consultan los arreglos
+func compileStep(key string, index int, isIndex bool) compiledStep {
+	if !isIndex {
+		return func(current interface{}) (interface{}, bool) {
+			switch v := current.(type) {
+			case map[string]interface{}:
+				value, exists := v[key]
+				return value, exists
+			case map[interface{}]interface{}:
+				value, exists := v[key]
+				return value, exists
+			}
+			return nil, false
+		}
+	}
+
+	return func(current interface{}) (interface{}, bool) {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			value, exists := v[key]
+			return value, exists
+		case map[interface{}]interface{}:
+			value, exists := v[key]
+			return value, exists
+		case []interface{}:
+			if index < len(v) {
+				return v[index], true
+			}
+		}
+		return nil, false
+	}
+}
+
+// compileFastStep crea la función de un segmento sobre fastjson con la misma
+// semántica que navigateFastJSON: primero como clave de objeto y luego como índice
+func compileFastStep(key string, index int, isIndex bool) compiledFastStep {
+	return func(current *fastjson.Value) (*fastjson.Value, bool) {
+		if obj := current.GetObject(); obj != nil {
+			if value := obj.Get(key); value != nil {
+				return value, true
+			}
+		}
+		if isIndex {
+			if arr := current.GetArray(); arr != nil && index < len(arr) {
+				return arr[index], true
+			}
+		}
+		return nil, false
+	}
+}
+
+// Run ejecuta el plan sobre un documento decodificado. Si un segmento no existe
+// retorna el valor sobre el que falló (para el diagnóstico) y su índice; si la ruta
+// existe retorna el valor encontrado y -1.
+func (c *CompiledPlan) Run(ctx context.Context, data interface{}) (interface{}, int, error) {
+	return c.RunFrom(ctx, data, 0, nil)
+}
+
+// RunFrom ejecuta los segmentos desde start sobre el valor que resolvió ese prefijo,
+// con el mismo contrato que Run (los índices son de la ruta completa). Si visit no
+// es nil, recibe el valor de cada prefijo memorizado que se resuelve.
+func (c *CompiledPlan) RunFrom(ctx context.Context, value interface{}, start int, visit memoVisitor) (interface{}, int, error) {
+	current := value
+	next := c.firstMemoAfter(start)
+	for i := start; i < len(c.steps); i++ {
+		if ctx.Err() != nil {
+			return nil, i, canceledError(ctx)
+		}
+		value, found := c.steps[i](current)
+		if !found {
+			return current, i, nil
+		}
+		current = value
+
+		if visit != nil && next < len(c.memo) && c.memo[next] == i+1 {
+			visit(i+1, current)
+			next++
+		}
+	}
+	return current, -1, nil
+}
+
+// RunFastJSON ejecuta el plan sobre un documento de fastjson con el mismo
+// contrato que Run
+func (c *CompiledPlan) RunFastJSON(ctx context.Context, v *fastjson.Value) (*fastjson.Value, int, error) {
+	return c.RunFastJSONFrom(ctx, v, 0, nil)
+}
+
+// RunFastJSONFrom es el equivalente de RunFrom para fastjson
+func (c *CompiledPlan) RunFastJSONFrom(ctx context.Context, v *fastjson.Value, start int, visit memoVisitorFastJSON) (*fastjson.Value, int, error) {
+	current := v
+	next := c.firstMemoAfter(start)
+	for i := start; i < len(c.fast); i++ {
+		if ctx.Err() != nil {
+			return nil, i, canceledError(ctx)
+		}
+		value, found := c.fast[i](current)
+		if !found {
+			return current, i, nil
+		}
+		current = value
+
+		if visit != nil && next < len(c.memo) && c.memo[next] == i+1 {
+			visit(i+1, current)
+			next++
+		}
+	}
+	return current, -1, nil
+}
+
+// firstMemoAfter retorna la posición del primer prefijo memorizado más largo que start
+func (c *CompiledPlan) firstMemoAfter(start int) int {
+	next := 0
+	for next < len(c.memo) && c.memo[next] <= start {
+		next++
+	}
+	return next
+}
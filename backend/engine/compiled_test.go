@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"procesador-consultas/limits"
+	"procesador-consultas/optimizer"
+	"procesador-consultas/parser"
+)
+
+// interpretPlan ejecuta el plan paso a paso según el tipo de cada uno, convirtiendo
+// los índices en cada acceso. Tiene el mismo contrato que (*CompiledPlan).Run y es la
+// referencia de las pruebas diferenciales y de los benchmarks.
+func interpretPlan(ctx context.Context, plan *optimizer.QueryPlan, data interface{}) (interface{}, int, error) {
+	current := data
+	resolved := 0
+	for _, step := range plan.Steps {
+		if ctx.Err() != nil {
+			return nil, resolved, canceledError(ctx)
+		}
+
+		switch step.Type {
+		case optimizer.StepNavigation, optimizer.StepDirectAccess, optimizer.StepCombined:
+			for _, key := range step.Keys {
+				value, found := navigateInterpreted(current, key)
+				if !found {
+					return current, resolved, nil
+				}
+				current = value
+				resolved++
+			}
+		case optimizer.StepMemoization:
+			// La ejecución de referencia no usa el cache de prefijos
+			continue
+		}
+	}
+	return current, -1, nil
+}
+
+// navigateInterpreted accede a una clave o a un índice de un valor genérico
+func navigateInterpreted(data interface{}, key string) (interface{}, bool) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if value, exists := v[key]; exists {
+			return value, true
+		}
+	case map[interface{}]interface{}:
+		if value, exists := v[key]; exists {
+			return value, true
+		}
+	case []interface{}:
+		// Intentar convertir la clave a índice
+		var index int
+		if _, err := fmt.Sscanf(key, "%d", &index); err == nil && index >= 0 && index < len(v) {
+			return v[index], true
+		}
+	}
+	return nil, false
+}
+
+// benchmarkQuery es la consulta que miden los benchmarks de planes
+const benchmarkQuery = "store.products[500].stock.units"
+
+// sampleDocument genera un catálogo con la cantidad de productos indicada
+func sampleDocument(items int) string {
+	products := make([]interface{}, items)
+	for i := range products {
+		products[i] = map[string]interface{}{
+			"id":    i,
+			"name":  fmt.Sprintf("producto %d", i),
+			"price": float64(i) * 1.5,
+			"tags":  []string{"a", "b", "c"},
+			"stock": map[string]interface{}{"warehouse": "norte", "units": i % 17},
+		}
+	}
+	document := map[string]interface{}{
+		"store": map[string]interface{}{
+			"name":     "tienda",
+			"products": products,
+		},
+	}
+	encoded, _ := json.Marshal(document)
+	return string(encoded)
+}
+
+// planRun ejecuta la ruta una vez; retorna el valor encontrado y el índice del
+// segmento que falló, o -1
+type planRun func() (interface{}, int, error)
+
+// planRuns contiene, por librería, la ejecución interpretada y la compilada de un
+// plan sobre el documento ya parseado por esa librería. Ambas retornan el valor solo
+// si la ruta existe; con fastjson lo convierten a valores genéricos, como el motor.
+type planRuns map[string]struct{ interpreted, compiled planRun }
+
+// newPlanRuns parsea el documento con cada librería y prepara las ejecuciones del
+// plan de la consulta. Falla si las dos ejecuciones no producen el mismo resultado.
+func newPlanRuns(tb testing.TB, jsonStr string, query string) planRuns {
+	tb.Helper()
+	ctx := context.Background()
+
+	keys, err := parser.ParseQueryString(query)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var standardData, iteratorData interface{}
+	if err := decodeStandard(ctx, jsonStr, &standardData); err != nil {
+		tb.Fatal(err)
+	}
+	if err := decodeJsonIterator(ctx, jsonStr, &iteratorData); err != nil {
+		tb.Fatal(err)
+	}
+	fastValue, err := parseFastJSON(ctx, jsonStr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	config := DefaultOptimizationConfig()
+	config.Limits = limits.Default()
+	plan, err := optimizer.NewOptimizer(config).OptimizeQuery(ctx, keys, standardData)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	compiled := CompilePlan(plan)
+	reference := NewEngine()
+
+	found := func(value interface{}, failed int, err error) (interface{}, int, error) {
+		if failed >= 0 {
+			value = nil
+		}
+		return value, failed, err
+	}
+	runs := planRuns{
+		"standard": {
+			interpreted: func() (interface{}, int, error) { return found(interpretPlan(ctx, plan, standardData)) },
+			compiled:    func() (interface{}, int, error) { return found(compiled.Run(ctx, standardData)) },
+		},
+		"json-iterator": {
+			interpreted: func() (interface{}, int, error) { return found(interpretPlan(ctx, plan, iteratorData)) },
+			compiled:    func() (interface{}, int, error) { return found(compiled.Run(ctx, iteratorData)) },
+		},
+		"fastjson": {
+			interpreted: func() (interface{}, int, error) { return reference.navigateFastJSON(ctx, fastValue, keys) },
+			compiled: func() (interface{}, int, error) {
+				value, failed, err := compiled.RunFastJSON(ctx, fastValue)
+				if err != nil || failed >= 0 {
+					return nil, failed, err
+				}
+				return reference.fastJSONToInterface(value), -1, nil
+			},
+		},
+	}
+
+	for _, library := range Libraries {
+		wantValue, wantFailed, err := runs[library].interpreted()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		gotValue, gotFailed, err := runs[library].compiled()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if wantFailed != gotFailed || !reflect.DeepEqual(wantValue, gotValue) {
+			tb.Fatalf("el plan compilado difiere del interpretado con %s: %v (segmento %d) frente a %v (segmento %d)",
+				library, gotValue, gotFailed, wantValue, wantFailed)
+		}
+	}
+	return runs
+}
+
+// benchmarkRuns ejecuta un benchmark por librería con la ejecución que elige variant
+func benchmarkRuns(b *testing.B, variant func(planRuns, string) planRun) {
+	runs := newPlanRuns(b, sampleDocument(1000), benchmarkQuery)
+	for _, library := range Libraries {
+		run := variant(runs, library)
+		b.Run(library, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				run()
+			}
+		})
+	}
+}
+
+// BenchmarkInterpretedPlan mide la ejecución interpretada del plan (interpretPlan, o
+// navigateFastJSON con fastjson) sobre el documento ya parseado; no incluye el parseo
+func BenchmarkInterpretedPlan(b *testing.B) {
+	benchmarkRuns(b, func(runs planRuns, library string) planRun { return runs[library].interpreted })
+}
+
+// BenchmarkCompiledPlan mide la cadena compilada del plan (CompilePlan) sobre el
+// documento ya parseado; no incluye el parseo. Para comparar ambas variantes:
+//
+//	go test ./engine -run '^$' -bench 'Plan$' -count 10
+func BenchmarkCompiledPlan(b *testing.B) {
+	benchmarkRuns(b, func(runs planRuns, library string) planRun { return runs[library].compiled })
+}
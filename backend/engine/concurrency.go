@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"procesador-consultas/queryerr"
+)
+
+const (
+	// ExecutionSequential ejecuta las librerías una detrás de otra (mediciones limpias)
+	ExecutionSequential = "sequential"
+	// ExecutionConcurrent ejecuta las librerías en un pool acotado de workers
+	ExecutionConcurrent = "concurrent"
+)
+
+// ExecutionOptions configura cómo se ejecutan las librerías en una comparación
+type ExecutionOptions struct {
+	Mode    string `json:"mode"`
+	Workers int    `json:"workers"`
+}
+
+// Normalize completa los valores por defecto y acota el número de workers
+func (o *ExecutionOptions) Normalize(tasks int) {
+	if o.Mode != ExecutionConcurrent {
+		o.Mode = ExecutionSequential
+		o.Workers = 1
+		return
+	}
+
+	maxWorkers := runtime.GOMAXPROCS(0)
+	if tasks < maxWorkers {
+		maxWorkers = tasks
+	}
+	if o.Workers <= 0 || o.Workers > maxWorkers {
+		o.Workers = maxWorkers
+	}
+	if o.Workers < 1 {
+		o.Workers = 1
+	}
+}
+
+// comparisonTask representa la ejecución de una librería dentro de una comparación
+type comparisonTask struct {
+	name string
+	keys []string
+	run  func() QueryResult
+}
+
+// runComparisonTasks ejecuta las tareas según las opciones y respeta la cancelación del contexto.
+// Las tareas que no llegan a ejecutarse se reportan con un error de cancelación.
+func runComparisonTasks(ctx context.Context, tasks []comparisonTask, options ExecutionOptions) map[string]QueryResult {
+	results := make(map[string]QueryResult, len(tasks))
+
+	if options.Mode != ExecutionConcurrent {
+		for _, task := range tasks {
+			if ctx.Err() != nil {
+				results[task.name] = canceledResult(task.keys)
+				continue
+			}
+			results[task.name] = task.run()
+		}
+		return results
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mux sync.Mutex
+	)
+	queue := make(chan comparisonTask)
+
+	for i := 0; i < options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				result := task.run()
+				mux.Lock()
+				results[task.name] = result
+				mux.Unlock()
+			}
+		}()
+	}
+
+	for i, task := range tasks {
+		select {
+		case queue <- task:
+			continue
+		case <-ctx.Done():
+		}
+
+		// Contexto cancelado: marcar las tareas pendientes y dejar de encolar
+		mux.Lock()
+		for _, pending := range tasks[i:] {
+			results[pending.name] = canceledResult(pending.keys)
+		}
+		mux.Unlock()
+		break
+	}
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+// canceledResult construye el resultado de una tarea que no llegó a ejecutarse
+func canceledResult(keys []string) QueryResult {
+	result := QueryResult{Keys: keys}
+	result.setError(&queryerr.Error{
+		Code:    queryerr.CodeCanceled,
+		Message: "comparación cancelada antes de ejecutar la librería",
+		Cause:   ErrQueryCanceled,
+	})
+	return result
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"procesador-consultas/limits"
+	"procesador-consultas/optimizer"
+	"procesador-consultas/parser"
+	"procesador-consultas/queryerr"
+)
+
+// concurrencyCase es una consulta sobre un documento con su valor esperado
+type concurrencyCase struct {
+	document string
+	query    string
+	expected interface{}
+}
+
+// concurrencyCases crea documentos de distintas formas con consultas y valores
+// esperados (los números se comparan como float64, igual que los decodifica encoding/json)
+func concurrencyCases(t *testing.T) []concurrencyCase {
+	t.Helper()
+
+	var cases []concurrencyCase
+	for n := 0; n < 4; n++ {
+		users := make([]map[string]interface{}, 0, 5+n)
+		for i := 0; i < 5+n; i++ {
+			language := "en"
+			if i%2 == 1 {
+				language = "es"
+			}
+			users = append(users, map[string]interface{}{
+				"id":      i,
+				"name":    fmt.Sprintf("Usuario %d", i),
+				"profile": map[string]interface{}{"email": fmt.Sprintf("user%d@example.com", i), "preferences": map[string]interface{}{"language": language}},
+				"tags":    []string{"a", "b", "c"}[:1+(i+n)%3],
+			})
+		}
+		document := map[string]interface{}{"users": users, "version": n}
+		if n%2 == 1 {
+			document["extra"] = map[string]interface{}{"nested": map[string]interface{}{"deep": []int{n, n + 1}}}
+		}
+
+		raw, err := json.Marshal(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		add := func(query string, expected interface{}) {
+			cases = append(cases, concurrencyCase{document: string(raw), query: query, expected: expected})
+		}
+
+		add("version", float64(n))
+		for i, user := range users {
+			add(fmt.Sprintf("users.%d.name", i), user["name"])
+			add(fmt.Sprintf("users[%d].profile.preferences.language", i), user["profile"].(map[string]interface{})["preferences"].(map[string]interface{})["language"])
+			add(fmt.Sprintf("users.%d.profile.email", i), user["profile"].(map[string]interface{})["email"])
+			add(fmt.Sprintf("users.%d.tags.0", i), "a")
+		}
+		if n%2 == 1 {
+			add("extra.nested.deep.1", float64(n+1))
+		}
+	}
+	return cases
+}
+
+// TestQueryWithOptimizationConcurrent ejecuta consultas simultáneas con las tres
+// librerías sobre un mismo motor mientras otras goroutines leen las estadísticas.
+// Verifica cada valor y que las estadísticas finales cuadren con las consultas
+// enviadas (sin actualizaciones perdidas). Con -race también detecta carreras.
+func TestQueryWithOptimizationConcurrent(t *testing.T) {
+	cases := concurrencyCases(t)
+
+	for _, policy := range []optimizer.PlanCachePolicy{optimizer.PlanCacheByQuery, optimizer.PlanCacheByShape} {
+		t.Run(string(policy), func(t *testing.T) {
+			config := DefaultOptimizationConfig()
+			config.PlanCache = policy
+			eng := NewOptimizedEngineWithConfig(limits.Default(), config)
+
+			const workers = 16
+			queries := 2000
+			if testing.Short() {
+				queries = 200
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, queries+2) // una por consulta y una por lector
+			next := make(chan int)
+
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range next {
+						if err := runConcurrencyCase(eng, cases, i); err != nil {
+							errs <- err
+						}
+					}
+				}()
+			}
+
+			// Lectores de estadísticas en paralelo con las consultas. Los contadores se
+			// leen por separado, así que la suma solo cuadra al final; durante las
+			// consultas cada uno solo puede crecer.
+			done := make(chan struct{})
+			var readers sync.WaitGroup
+			for r := 0; r < 2; r++ {
+				readers.Add(1)
+				go func() {
+					defer readers.Done()
+					previous := &OptimizedEngineStats{}
+					for {
+						select {
+						case <-done:
+							return
+						default:
+							stats := eng.GetOptimizationStats()
+							if stats.TotalQueries < previous.TotalQueries || stats.CacheHits < previous.CacheHits ||
+								stats.OptimizedQueries < previous.OptimizedQueries {
+								errs <- fmt.Errorf("las estadísticas retrocedieron: %+v después de %+v", stats, previous)
+								return
+							}
+							previous = stats
+							eng.GetOptimizerStats()
+						}
+					}
+				}()
+			}
+
+			for i := 0; i < queries; i++ {
+				next <- i
+			}
+			close(next)
+			wg.Wait()
+			close(done)
+			readers.Wait()
+			close(errs)
+
+			failures := 0
+			for err := range errs {
+				if failures++; failures <= 10 {
+					t.Error(err)
+				}
+			}
+			if failures > 10 {
+				t.Errorf("... y %d errores más", failures-10)
+			}
+
+			stats := eng.GetOptimizationStats()
+			if stats.TotalQueries != int64(queries) {
+				t.Errorf("TotalQueries = %d, se enviaron %d", stats.TotalQueries, queries)
+			}
+			if stats.CacheHits+stats.OptimizedQueries != stats.TotalQueries {
+				t.Errorf("CacheHits (%d) + OptimizedQueries (%d) != TotalQueries (%d)",
+					stats.CacheHits, stats.OptimizedQueries, stats.TotalQueries)
+			}
+			optimizerStats := eng.GetOptimizerStats()
+			pool := optimizerStats.Caches["query_pool"]
+			if pool.Hits+pool.Misses != stats.TotalQueries {
+				t.Errorf("pool: Hits (%d) + Misses (%d) != TotalQueries (%d)", pool.Hits, pool.Misses, stats.TotalQueries)
+			}
+			if optimizerStats.TotalQueries > stats.OptimizedQueries {
+				t.Errorf("el optimizador creó %d planes para %d consultas optimizadas", optimizerStats.TotalQueries, stats.OptimizedQueries)
+			}
+		})
+	}
+}
+
+// runConcurrencyCase ejecuta la consulta i, elegida con una semilla fija; una de
+// cada diez consulta una ruta inexistente
+func runConcurrencyCase(eng *OptimizedEngine, cases []concurrencyCase, i int) error {
+	rng := rand.New(rand.NewSource(int64(i)))
+	c := cases[rng.Intn(len(cases))]
+	library := Libraries[rng.Intn(len(Libraries))]
+	missing := rng.Intn(10) == 0
+
+	query := c.query
+	if missing {
+		query += ".falta"
+	}
+	keys, err := parser.ParseQueryString(query)
+	if err != nil {
+		return fmt.Errorf("%s: %v", query, err)
+	}
+
+	result := eng.QueryWithOptimization(context.Background(), c.document, keys, library)
+	switch {
+	case missing:
+		if result.ErrorCode != queryerr.CodePathNotFound {
+			return fmt.Errorf("%s %s: se esperaba %s, se obtuvo %q (%s)", library, query, queryerr.CodePathNotFound, result.ErrorCode, result.Error)
+		}
+	case result.Err != nil:
+		return fmt.Errorf("%s %s: %v", library, query, result.Err)
+	case result.Value != c.expected:
+		return fmt.Errorf("%s %s: %#v != %#v", library, query, result.Value, c.expected)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"procesador-consultas/queryerr"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ErrQueryCanceled indica que la consulta se abandonó porque su contexto terminó
+// (cliente desconectado o plazo vencido). La causa original se conserva envuelta.
+var ErrQueryCanceled = errors.New("consulta cancelada")
+
+// contextChunkSize limita cuántos bytes se leen entre comprobaciones del contexto
+const contextChunkSize = 64 * 1024
+
+// canceledError construye el error de cancelación a partir del contexto
+func canceledError(ctx context.Context) error {
+	cause := fmt.Errorf("%w: %w", ErrQueryCanceled, ctx.Err())
+	return &queryerr.Error{Code: queryerr.CodeCanceled, Message: cause.Error(), Cause: cause}
+}
+
+// IsCanceled indica si un error proviene de la cancelación de la consulta
+func IsCanceled(err error) bool {
+	return errors.Is(err, ErrQueryCanceled) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// contextReader interrumpe la lectura cuando el contexto termina
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read lee como máximo contextChunkSize bytes tras comprobar el contexto
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(p) > contextChunkSize {
+		p = p[:contextChunkSize]
+	}
+	return cr.r.Read(p)
+}
+
+// newContextReader crea un lector de la cadena JSON sensible al contexto
+func newContextReader(ctx context.Context, jsonStr string) io.Reader {
+	return &contextReader{ctx: ctx, r: strings.NewReader(jsonStr)}
+}
+
+// decodeStandard parsea JSON con la librería estándar comprobando el contexto entre bloques
+func decodeStandard(ctx context.Context, jsonStr string, v interface{}) error {
+	dec := json.NewDecoder(newContextReader(ctx, jsonStr))
+	if err := dec.Decode(v); err != nil {
+		if ctx.Err() != nil {
+			return canceledError(ctx)
+		}
+		return err
+	}
+
+	// Igual que json.Unmarshal, rechazar datos adicionales tras el valor
+	if _, err := dec.Token(); err != io.EOF {
+		if ctx.Err() != nil {
+			return canceledError(ctx)
+		}
+		return errors.New("datos adicionales después del valor JSON")
+	}
+	return nil
+}
+
+// decodeJsonIterator parsea JSON con json-iterator comprobando el contexto entre bloques
+func decodeJsonIterator(ctx context.Context, jsonStr string, v interface{}) error {
+	iter := jsoniter.Parse(jsoniter.ConfigDefault, newContextReader(ctx, jsonStr), 4096)
+	iter.ReadVal(v)
+	if iter.Error != nil && iter.Error != io.EOF {
+		if ctx.Err() != nil {
+			return canceledError(ctx)
+		}
+		return iter.Error
+	}
+
+	// Igual que jsoniter.Unmarshal, rechazar datos adicionales tras el valor
+	iter.WhatIsNext()
+	if iter.Error != io.EOF {
+		if ctx.Err() != nil {
+			return canceledError(ctx)
+		}
+		return errors.New("datos adicionales después del valor JSON")
+	}
+	return nil
+}
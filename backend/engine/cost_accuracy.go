@@ -0,0 +1,62 @@
+package engine
+
+import "time"
+
+// CostAccuracy compara, para una librería, el tiempo de consulta estimado por el
+// modelo de costos del optimizador con el medido al ejecutar el plan compilado
+type CostAccuracy struct {
+	Samples           int64
+	MeanEstimated     time.Duration
+	MeanMeasured      time.Duration
+	MeanAbsoluteError time.Duration
+	Ratio             float64 // tiempo medido total / tiempo estimado total
+}
+
+// costSamples acumula las muestras de una librería
+type costSamples struct {
+	count         int64
+	estimated     time.Duration
+	measured      time.Duration
+	absoluteError time.Duration
+}
+
+// add registra una ejecución
+func (s *costSamples) add(estimated, measured time.Duration) {
+	s.count++
+	s.estimated += estimated
+	s.measured += measured
+	if diff := measured - estimated; diff >= 0 {
+		s.absoluteError += diff
+	} else {
+		s.absoluteError -= diff
+	}
+}
+
+// accuracy resume las muestras acumuladas
+func (s *costSamples) accuracy() CostAccuracy {
+	accuracy := CostAccuracy{Samples: s.count}
+	if s.count == 0 {
+		return accuracy
+	}
+	n := time.Duration(s.count)
+	accuracy.MeanEstimated = s.estimated / n
+	accuracy.MeanMeasured = s.measured / n
+	accuracy.MeanAbsoluteError = s.absoluteError / n
+	if s.estimated > 0 {
+		accuracy.Ratio = float64(s.measured) / float64(s.estimated)
+	}
+	return accuracy
+}
+
+// recordCost registra el tiempo estimado y el medido de una ejecución del plan
+func (oe *OptimizedEngine) recordCost(library string, estimated, measured time.Duration) {
+	oe.stats.costMux.Lock()
+	defer oe.stats.costMux.Unlock()
+
+	samples, ok := oe.stats.cost[library]
+	if !ok {
+		samples = &costSamples{}
+		oe.stats.cost[library] = samples
+	}
+	samples.add(estimated, measured)
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"procesador-consultas/limits"
+	"procesador-consultas/optimizer"
+	"procesador-consultas/parser"
+)
+
+// TestCostAccuracyMatchesShape verifica que la precisión del modelo de costos solo
+// acumule ejecuciones de planes construidos para un documento con la misma forma
+func TestCostAccuracyMatchesShape(t *testing.T) {
+	documents := []string{
+		`{"a":{"b":[1,2,3]}}`,
+		`{"a":{"b":[4]}}`,             // misma forma que el primero
+		`{"a":{"b":"x","c":{"d":1}}}`, // otra forma
+	}
+	keys, err := parser.ParseQueryString("a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		policy optimizer.PlanCachePolicy
+		want   int64
+	}{
+		// Solo la primera consulta crea el plan y calcula la forma del documento
+		{optimizer.PlanCacheByQuery, 1},
+		// Cada consulta calcula la forma y usa el plan de esa forma
+		{optimizer.PlanCacheByShape, 3},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			config := DefaultOptimizationConfig()
+			config.PlanCache = tc.policy
+			eng := NewOptimizedEngineWithConfig(limits.Default(), config)
+
+			for _, library := range Libraries {
+				for _, document := range documents {
+					if result := eng.QueryWithOptimization(context.Background(), document, keys, library); result.Err != nil {
+						t.Fatalf("%s %s: %v", library, document, result.Err)
+					}
+				}
+				if got := eng.GetOptimizationStats().CostModel[library].Samples; got != tc.want {
+					t.Errorf("%s: %d muestras, se esperaban %d", library, got, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"procesador-consultas/queryerr"
+	"procesador-consultas/suggest"
+
+	"github.com/valyala/fastjson"
+)
+
+// pathNotFound construye el error de ruta inexistente con su diagnóstico sobre datos genéricos
+func pathNotFound(data interface{}, keys []string, failed int) *queryerr.Error {
+	return queryerr.PathNotFound(keys, failed).WithDiagnostic(diagnosePath(data, keys, failed))
+}
+
+// pathNotFoundAt construye el error de ruta inexistente cuando ya se conoce el contenedor
+// alcanzado por el prefijo resuelto
+func pathNotFoundAt(container interface{}, keys []string, failed int) *queryerr.Error {
+	return queryerr.PathNotFound(keys, failed).WithDiagnostic(describeFailure(container, keys, failed))
+}
+
+// pathNotFoundFastJSON construye el error de ruta inexistente con su diagnóstico sobre fastjson
+func pathNotFoundFastJSON(v *fastjson.Value, keys []string, failed int) *queryerr.Error {
+	return queryerr.PathNotFound(keys, failed).WithDiagnostic(diagnoseFastJSONPath(v, keys, failed))
+}
+
+// diagnosePath recorre el prefijo resuelto y describe por qué falló el segmento siguiente
+func diagnosePath(data interface{}, keys []string, failed int) *queryerr.PathDiagnostic {
+	current := data
+	for _, key := range keys[:failed] {
+		next, ok := lookupValue(current, key)
+		if !ok {
+			// El prefijo ya no se resuelve (no debería ocurrir con el mismo documento)
+			return &queryerr.PathDiagnostic{
+				ResolvedPrefix: []string{},
+				FailedSegment:  failed,
+				Segment:        keys[failed],
+				FoundType:      jsonTypeName(data),
+				Reason:         queryerr.ReasonUnknownStructure,
+			}
+		}
+		current = next
+	}
+
+	return describeFailure(current, keys, failed)
+}
+
+// describeFailure describe por qué el segmento keys[failed] no se resuelve sobre el
+// contenedor alcanzado por el prefijo keys[:failed]
+func describeFailure(current interface{}, keys []string, failed int) *queryerr.PathDiagnostic {
+	diagnostic := newDiagnostic(keys, failed, jsonTypeName(current))
+	switch v := current.(type) {
+	case map[string]interface{}:
+		siblings := make([]string, 0, len(v))
+		for key := range v {
+			siblings = append(siblings, key)
+		}
+		diagnoseObject(diagnostic, siblings)
+	case []interface{}:
+		diagnoseArray(diagnostic, len(v))
+	default:
+		diagnostic.Reason = queryerr.ReasonNotAContainer
+	}
+
+	return diagnostic
+}
+
+// diagnoseFastJSONPath es el equivalente de diagnosePath para valores de fastjson
+func diagnoseFastJSONPath(v *fastjson.Value, keys []string, failed int) *queryerr.PathDiagnostic {
+	current := v
+	for _, key := range keys[:failed] {
+		next := current.Get(key)
+		if next == nil {
+			return &queryerr.PathDiagnostic{
+				ResolvedPrefix: []string{},
+				FailedSegment:  failed,
+				Segment:        keys[failed],
+				FoundType:      fastJSONTypeName(v),
+				Reason:         queryerr.ReasonUnknownStructure,
+			}
+		}
+		current = next
+	}
+
+	diagnostic := newDiagnostic(keys, failed, fastJSONTypeName(current))
+	switch current.Type() {
+	case fastjson.TypeObject:
+		var siblings []string
+		current.GetObject().Visit(func(key []byte, _ *fastjson.Value) {
+			siblings = append(siblings, string(key))
+		})
+		diagnoseObject(diagnostic, siblings)
+	case fastjson.TypeArray:
+		diagnoseArray(diagnostic, len(current.GetArray()))
+	default:
+		diagnostic.Reason = queryerr.ReasonNotAContainer
+	}
+
+	return diagnostic
+}
+
+// newDiagnostic crea el diagnóstico base para el segmento que falló
+func newDiagnostic(keys []string, failed int, foundType string) *queryerr.PathDiagnostic {
+	prefix := make([]string, failed)
+	copy(prefix, keys[:failed])
+
+	return &queryerr.PathDiagnostic{
+		ResolvedPrefix: prefix,
+		FailedSegment:  failed,
+		Segment:        keys[failed],
+		FoundType:      foundType,
+	}
+}
+
+// diagnoseObject completa el diagnóstico de una clave ausente con claves parecidas
+func diagnoseObject(diagnostic *queryerr.PathDiagnostic, siblings []string) {
+	diagnostic.Reason = queryerr.ReasonMissingKey
+	diagnostic.Suggestions = suggest.Keys(diagnostic.Segment, siblings)
+}
+
+// diagnoseArray completa el diagnóstico de un índice inválido
+func diagnoseArray(diagnostic *queryerr.PathDiagnostic, length int) {
+	diagnostic.ArrayLength = &length
+
+	index, err := strconv.Atoi(diagnostic.Segment)
+	if err != nil {
+		diagnostic.Reason = queryerr.ReasonNotAnIndex
+		return
+	}
+
+	diagnostic.Reason = queryerr.ReasonIndexOutOfRange
+	if index >= length && length > 0 {
+		diagnostic.Suggestions = []string{strconv.Itoa(length - 1)}
+	}
+}
+
+// lookupValue resuelve un único segmento sobre datos genéricos
+func lookupValue(data interface{}, key string) (interface{}, bool) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		value, exists := v[key]
+		return value, exists
+	case []interface{}:
+		var index int
+		if _, err := fmt.Sscanf(key, "%d", &index); err == nil && index >= 0 && index < len(v) {
+			return v[index], true
+		}
+	}
+	return nil, false
+}
+
+// jsonTypeName retorna el nombre del tipo JSON de un valor genérico
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, int, int64, json.Number:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// fastJSONTypeName retorna el nombre del tipo JSON de un valor de fastjson
+func fastJSONTypeName(v *fastjson.Value) string {
+	switch v.Type() {
+	case fastjson.TypeTrue, fastjson.TypeFalse:
+		return "boolean"
+	default:
+		return v.Type().String()
+	}
+}
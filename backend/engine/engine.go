@@ -1,22 +1,72 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
-	jsoniter "github.com/json-iterator/go"
+	"procesador-consultas/limits"
+	"procesador-consultas/queryerr"
+
 	"github.com/valyala/fastjson"
 )
 
 // QueryResult representa el resultado de una consulta
 type QueryResult struct {
-	Value       interface{} `json:"value"`
-	Found       bool        `json:"found"`
-	Path        []string    `json:"path"`
-	Keys        []string    `json:"keys"`
-	Error       string      `json:"error,omitempty"`
-	Performance Performance `json:"performance"`
+	Value       interface{}   `json:"value"`
+	Found       bool          `json:"found"`
+	Path        []string      `json:"path"`
+	Keys        []string      `json:"keys"`
+	Error       string        `json:"error,omitempty"`
+	ErrorCode   queryerr.Code `json:"error_code,omitempty"`
+	Err         error         `json:"-"`
+	Performance Performance   `json:"performance"`
+}
+
+// setError registra un error en el resultado; Err siempre es un *queryerr.Error
+func (r *QueryResult) setError(err error) {
+	queryErr := queryerr.From(err)
+	r.Err = queryErr
+	r.Error = queryErr.Message
+	r.ErrorCode = queryErr.Code
+}
+
+// setParseError registra un error de parseo del JSON, conservando la cancelación
+func (r *QueryResult) setParseError(jsonStr string, err error) {
+	if IsCanceled(err) {
+		r.setError(err)
+		return
+	}
+	r.setError(invalidDocument(jsonStr, err))
+}
+
+// parseError convierte el error de parseo de una operación que no produce un
+// QueryResult, con el mismo criterio que setParseError: la cancelación se conserva
+// como tal y el resto es un documento inválido
+func parseError(ctx context.Context, jsonStr string, err error) error {
+	if IsCanceled(err) {
+		return canceledError(ctx)
+	}
+	return invalidDocument(jsonStr, err)
+}
+
+// invalidDocument construye el error de documento inválido con su posición cuando se conoce
+func invalidDocument(jsonStr string, err error) *queryerr.Error {
+	queryErr := queryerr.InvalidDocument(err)
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		pos := queryerr.PositionAt(jsonStr, int(syntaxErr.Offset))
+		queryErr.Position = &pos
+	}
+	return queryErr
+}
+
+// Canceled indica si la consulta se abandonó por cancelación del contexto
+func (r QueryResult) Canceled() bool {
+	return r.Err != nil && IsCanceled(r.Err)
 }
 
 // Performance contiene métricas de rendimiento
@@ -26,17 +76,36 @@ type Performance struct {
 	TotalTime   time.Duration `json:"total_time"`
 	MemoryUsage int64         `json:"memory_usage"`
 	LibraryType string        `json:"library_type"`
+
+	// EstimatedQueryTime es el QueryTime que predice el modelo de costos del
+	// optimizador; solo lo informan las consultas optimizadas
+	EstimatedQueryTime time.Duration `json:"estimated_query_time,omitempty"`
+
+	// MemoizedSegments son los segmentos de la ruta que se tomaron del cache de
+	// prefijos; si es mayor que cero el documento no se parseó
+	MemoizedSegments int `json:"memoized_segments,omitempty"`
 }
 
 // Engine representa el motor de consultas
 type Engine struct {
 	jsonData interface{}
 	keys     []string
+	limits   limits.Config
 }
 
-// NewEngine crea un nuevo motor de consultas
+// NewEngine crea un nuevo motor de consultas con los límites por defecto
 func NewEngine() *Engine {
-	return &Engine{}
+	return NewEngineWithLimits(limits.Default())
+}
+
+// NewEngineWithLimits crea un nuevo motor de consultas con límites de recursos propios
+func NewEngineWithLimits(config limits.Config) *Engine {
+	return &Engine{limits: config}
+}
+
+// Limits retorna los límites de recursos del motor
+func (e *Engine) Limits() limits.Config {
+	return e.limits
 }
 
 // EnsureMinimumTimes asegura que haya tiempos mínimos para mostrar diferencias
@@ -53,7 +122,7 @@ func (e *Engine) EnsureMinimumTimes(result *QueryResult) {
 }
 
 // QueryWithStandardLibrary ejecuta una consulta usando la librería estándar
-func (e *Engine) QueryWithStandardLibrary(jsonStr string, keys []string) QueryResult {
+func (e *Engine) QueryWithStandardLibrary(ctx context.Context, jsonStr string, keys []string) QueryResult {
 	start := time.Now()
 
 	var result QueryResult
@@ -62,13 +131,20 @@ func (e *Engine) QueryWithStandardLibrary(jsonStr string, keys []string) QueryRe
 
 	// Validar entrada
 	if jsonStr == "" {
-		result.Error = "JSON de entrada está vacío"
+		result.setError(queryerr.New(queryerr.CodeInvalidDocument, "JSON de entrada está vacío"))
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
 
 	if len(keys) == 0 {
-		result.Error = "No hay claves para consultar"
+		result.setError(queryerr.New(queryerr.CodeInvalidRequest, "No hay claves para consultar"))
+		result.Performance.TotalTime = time.Since(start)
+		return result
+	}
+
+	// Verificar límites de recursos antes de parsear
+	if err := limits.CheckDocument(jsonStr, e.limits); err != nil {
+		result.setError(err)
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
@@ -76,8 +152,8 @@ func (e *Engine) QueryWithStandardLibrary(jsonStr string, keys []string) QueryRe
 	// Parsear JSON con librería estándar
 	parseStart := time.Now()
 	var data interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
-		result.Error = fmt.Sprintf("error parseando JSON: %v", err)
+	if err := decodeStandard(ctx, jsonStr, &data); err != nil {
+		result.setParseError(jsonStr, err)
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
@@ -85,23 +161,37 @@ func (e *Engine) QueryWithStandardLibrary(jsonStr string, keys []string) QueryRe
 
 	// Ejecutar consulta
 	queryStart := time.Now()
-	value, found := e.navigateJSON(data, keys)
+	value, failed, err := e.navigateJSON(ctx, data, keys)
 	result.Performance.QueryTime = time.Since(queryStart)
+	if err != nil {
+		result.setError(err)
+		result.Performance.TotalTime = time.Since(start)
+		return result
+	}
+
+	found := failed < 0
+	if found {
+		if err := limits.CheckResult(value, e.limits); err != nil {
+			result.setError(err)
+			result.Performance.TotalTime = time.Since(start)
+			return result
+		}
+	}
 
 	result.Value = value
 	result.Found = found
 	result.Performance.TotalTime = time.Since(start)
 
-	// Si no se encontró el valor, agregar información de debug
+	// Si no se encontró el valor, diagnosticar el segmento que falló
 	if !found {
-		result.Error = fmt.Sprintf("no se encontró el valor para la ruta: %v", keys)
+		result.setError(pathNotFound(data, keys, failed))
 	}
 
 	return result
 }
 
 // QueryWithJsonIterator ejecuta una consulta usando json-iterator
-func (e *Engine) QueryWithJsonIterator(jsonStr string, keys []string) QueryResult {
+func (e *Engine) QueryWithJsonIterator(ctx context.Context, jsonStr string, keys []string) QueryResult {
 	start := time.Now()
 
 	var result QueryResult
@@ -110,13 +200,20 @@ func (e *Engine) QueryWithJsonIterator(jsonStr string, keys []string) QueryResul
 
 	// Validar entrada
 	if jsonStr == "" {
-		result.Error = "JSON de entrada está vacío"
+		result.setError(queryerr.New(queryerr.CodeInvalidDocument, "JSON de entrada está vacío"))
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
 
 	if len(keys) == 0 {
-		result.Error = "No hay claves para consultar"
+		result.setError(queryerr.New(queryerr.CodeInvalidRequest, "No hay claves para consultar"))
+		result.Performance.TotalTime = time.Since(start)
+		return result
+	}
+
+	// Verificar límites de recursos antes de parsear
+	if err := limits.CheckDocument(jsonStr, e.limits); err != nil {
+		result.setError(err)
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
@@ -124,8 +221,8 @@ func (e *Engine) QueryWithJsonIterator(jsonStr string, keys []string) QueryResul
 	// Parsear JSON con json-iterator
 	parseStart := time.Now()
 	var data interface{}
-	if err := jsoniter.Unmarshal([]byte(jsonStr), &data); err != nil {
-		result.Error = fmt.Sprintf("error parseando JSON: %v", err)
+	if err := decodeJsonIterator(ctx, jsonStr, &data); err != nil {
+		result.setParseError(jsonStr, err)
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
@@ -133,23 +230,37 @@ func (e *Engine) QueryWithJsonIterator(jsonStr string, keys []string) QueryResul
 
 	// Ejecutar consulta
 	queryStart := time.Now()
-	value, found := e.navigateJSON(data, keys)
+	value, failed, err := e.navigateJSON(ctx, data, keys)
 	result.Performance.QueryTime = time.Since(queryStart)
+	if err != nil {
+		result.setError(err)
+		result.Performance.TotalTime = time.Since(start)
+		return result
+	}
+
+	found := failed < 0
+	if found {
+		if err := limits.CheckResult(value, e.limits); err != nil {
+			result.setError(err)
+			result.Performance.TotalTime = time.Since(start)
+			return result
+		}
+	}
 
 	result.Value = value
 	result.Found = found
 	result.Performance.TotalTime = time.Since(start)
 
-	// Si no se encontró el valor, agregar información de debug
+	// Si no se encontró el valor, diagnosticar el segmento que falló
 	if !found {
-		result.Error = fmt.Sprintf("no se encontró el valor para la ruta: %v", keys)
+		result.setError(pathNotFound(data, keys, failed))
 	}
 
 	return result
 }
 
 // QueryWithFastJSON ejecuta una consulta usando fastjson
-func (e *Engine) QueryWithFastJSON(jsonStr string, keys []string) QueryResult {
+func (e *Engine) QueryWithFastJSON(ctx context.Context, jsonStr string, keys []string) QueryResult {
 	start := time.Now()
 
 	var result QueryResult
@@ -158,23 +269,29 @@ func (e *Engine) QueryWithFastJSON(jsonStr string, keys []string) QueryResult {
 
 	// Validar entrada
 	if jsonStr == "" {
-		result.Error = "JSON de entrada está vacío"
+		result.setError(queryerr.New(queryerr.CodeInvalidDocument, "JSON de entrada está vacío"))
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
 
 	if len(keys) == 0 {
-		result.Error = "No hay claves para consultar"
+		result.setError(queryerr.New(queryerr.CodeInvalidRequest, "No hay claves para consultar"))
+		result.Performance.TotalTime = time.Since(start)
+		return result
+	}
+
+	// Verificar límites de recursos antes de parsear
+	if err := limits.CheckDocument(jsonStr, e.limits); err != nil {
+		result.setError(err)
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
 
 	// Parsear JSON con fastjson
 	parseStart := time.Now()
-	var p fastjson.Parser
-	v, err := p.Parse(jsonStr)
+	v, err := parseFastJSON(ctx, jsonStr)
 	if err != nil {
-		result.Error = fmt.Sprintf("error parseando JSON: %v", err)
+		result.setParseError(jsonStr, err)
 		result.Performance.TotalTime = time.Since(start)
 		return result
 	}
@@ -182,38 +299,71 @@ func (e *Engine) QueryWithFastJSON(jsonStr string, keys []string) QueryResult {
 
 	// Ejecutar consulta
 	queryStart := time.Now()
-	value, found := e.navigateFastJSON(v, keys)
+	value, failed, err := e.navigateFastJSON(ctx, v, keys)
 	result.Performance.QueryTime = time.Since(queryStart)
+	if err != nil {
+		result.setError(err)
+		result.Performance.TotalTime = time.Since(start)
+		return result
+	}
+
+	found := failed < 0
+	if found {
+		if err := limits.CheckResult(value, e.limits); err != nil {
+			result.setError(err)
+			result.Performance.TotalTime = time.Since(start)
+			return result
+		}
+	}
 
 	result.Value = value
 	result.Found = found
 	result.Performance.TotalTime = time.Since(start)
 
-	// Si no se encontró el valor, agregar información de debug
+	// Si no se encontró el valor, diagnosticar el segmento que falló
 	if !found {
-		result.Error = fmt.Sprintf("no se encontró el valor para la ruta: %v", keys)
+		result.setError(pathNotFoundFastJSON(v, keys, failed))
 	}
 
 	return result
 }
 
-// navigateJSON navega por la estructura JSON usando la librería estándar
-func (e *Engine) navigateJSON(data interface{}, keys []string) (interface{}, bool) {
+// parseFastJSON parsea con fastjson, que lo hace de una sola vez: el contexto se
+// comprueba antes y después
+func parseFastJSON(ctx context.Context, jsonStr string) (*fastjson.Value, error) {
+	if ctx.Err() != nil {
+		return nil, canceledError(ctx)
+	}
+	var p fastjson.Parser
+	v, err := p.Parse(jsonStr)
+	if err == nil && ctx.Err() != nil {
+		err = canceledError(ctx)
+	}
+	return v, err
+}
+
+// navigateJSON navega por la estructura JSON usando la librería estándar.
+// Retorna el índice del segmento que no se pudo resolver, o -1 si la ruta existe.
+func (e *Engine) navigateJSON(ctx context.Context, data interface{}, keys []string) (interface{}, int, error) {
 	current := data
 
-	for _, key := range keys {
+	for i, key := range keys {
+		if ctx.Err() != nil {
+			return nil, i, canceledError(ctx)
+		}
+
 		switch v := current.(type) {
 		case map[string]interface{}:
 			if value, exists := v[key]; exists {
 				current = value
 			} else {
-				return nil, false
+				return nil, i, nil
 			}
 		case map[interface{}]interface{}:
 			if value, exists := v[key]; exists {
 				current = value
 			} else {
-				return nil, false
+				return nil, i, nil
 			}
 		case []interface{}:
 			// Intentar convertir la clave a índice
@@ -221,21 +371,26 @@ func (e *Engine) navigateJSON(data interface{}, keys []string) (interface{}, boo
 			if _, err := fmt.Sscanf(key, "%d", &index); err == nil && index >= 0 && index < len(v) {
 				current = v[index]
 			} else {
-				return nil, false
+				return nil, i, nil
 			}
 		default:
-			return nil, false
+			return nil, i, nil
 		}
 	}
 
-	return current, true
+	return current, -1, nil
 }
 
-// navigateFastJSON navega por la estructura JSON usando fastjson
-func (e *Engine) navigateFastJSON(v *fastjson.Value, keys []string) (interface{}, bool) {
+// navigateFastJSON navega por la estructura JSON usando fastjson.
+// Retorna el índice del segmento que no se pudo resolver, o -1 si la ruta existe.
+func (e *Engine) navigateFastJSON(ctx context.Context, v *fastjson.Value, keys []string) (interface{}, int, error) {
 	current := v
 
-	for _, key := range keys {
+	for i, key := range keys {
+		if ctx.Err() != nil {
+			return nil, i, canceledError(ctx)
+		}
+
 		// Intentar obtener como objeto primero
 		obj := current.GetObject()
 		if obj != nil {
@@ -258,11 +413,11 @@ func (e *Engine) navigateFastJSON(v *fastjson.Value, keys []string) (interface{}
 		}
 
 		// Si no se puede navegar, retornar error con información de debug
-		return nil, false
+		return nil, i, nil
 	}
 
 	// Convertir fastjson.Value a interface{}
-	return e.fastJSONToInterface(current), true
+	return e.fastJSONToInterface(current), -1, nil
 }
 
 // fastJSONToInterface convierte un fastjson.Value a interface{}
@@ -304,40 +459,49 @@ func (e *Engine) fastJSONToInterface(v *fastjson.Value) interface{} {
 }
 
 // ComparePerformance compara el rendimiento de diferentes librerías
-func (e *Engine) ComparePerformance(jsonStr string, keys []string) map[string]QueryResult {
+func (e *Engine) ComparePerformance(ctx context.Context, jsonStr string, keys []string) map[string]QueryResult {
+	results, _ := e.ComparePerformanceWithOptions(ctx, jsonStr, keys, ExecutionOptions{Mode: ExecutionSequential})
+	return results
+}
+
+// ComparePerformanceWithOptions compara el rendimiento de diferentes librerías
+// ejecutándolas de forma secuencial o concurrente según las opciones.
+// Retorna también las opciones efectivas con las que se obtuvieron las mediciones.
+func (e *Engine) ComparePerformanceWithOptions(ctx context.Context, jsonStr string, keys []string, options ExecutionOptions) (map[string]QueryResult, ExecutionOptions) {
 	results := make(map[string]QueryResult)
+	options.Normalize(len(Libraries))
 
 	// Validar entrada
 	if jsonStr == "" {
-		errorResult := QueryResult{
-			Error: "JSON de entrada está vacío",
-			Keys:  keys,
-		}
+		errorResult := QueryResult{Keys: keys}
+		errorResult.setError(queryerr.New(queryerr.CodeInvalidDocument, "JSON de entrada está vacío"))
 		results["standard"] = errorResult
 		results["json-iterator"] = errorResult
 		results["fastjson"] = errorResult
-		return results
+		return results, options
 	}
 
 	if len(keys) == 0 {
-		errorResult := QueryResult{
-			Error: "No hay claves para consultar",
-			Keys:  keys,
-		}
+		errorResult := QueryResult{Keys: keys}
+		errorResult.setError(queryerr.New(queryerr.CodeInvalidRequest, "No hay claves para consultar"))
 		results["standard"] = errorResult
 		results["json-iterator"] = errorResult
 		results["fastjson"] = errorResult
-		return results
+		return results, options
 	}
 
-	// Ejecutar con librería estándar
-	results["standard"] = e.QueryWithStandardLibrary(jsonStr, keys)
-
-	// Ejecutar con json-iterator
-	results["json-iterator"] = e.QueryWithJsonIterator(jsonStr, keys)
+	// Ejecutar cada librería
+	tasks := make([]comparisonTask, 0, len(Libraries))
+	for _, library := range Libraries {
+		run := e.runnerFor(library)
+		tasks = append(tasks, comparisonTask{
+			name: library,
+			keys: keys,
+			run:  func() QueryResult { return run(ctx, jsonStr, keys) },
+		})
+	}
 
-	// Ejecutar con fastjson
-	results["fastjson"] = e.QueryWithFastJSON(jsonStr, keys)
+	results = runComparisonTasks(ctx, tasks, options)
 
 	// Asegurar tiempos mínimos para todos los resultados
 	for key, result := range results {
@@ -345,5 +509,5 @@ func (e *Engine) ComparePerformance(jsonStr string, keys []string) map[string]Qu
 		results[key] = result
 	}
 
-	return results
+	return results, options
 }
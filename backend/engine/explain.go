@@ -0,0 +1,294 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"procesador-consultas/limits"
+	"procesador-consultas/optimizer"
+	"procesador-consultas/queryerr"
+
+	"github.com/valyala/fastjson"
+)
+
+// LibraryAuto indica que Explain elija la librería con menor tiempo estimado
+const LibraryAuto = "auto"
+
+// ExplainOptions configura Explain
+type ExplainOptions struct {
+	Library  string              // librería; vacío o LibraryAuto la elige el modelo de costos
+	Analyze  bool                // ejecutar el plan final paso a paso
+	Pipeline *optimizer.Pipeline // pipeline de pases en lugar del configurado
+}
+
+// ExplainResponse describe el plan de una consulta: los pases que lo construyeron,
+// la librería elegida y, en modo análisis, lo que ocurrió al ejecutarlo
+type ExplainResponse struct {
+	Keys               []string                  `json:"keys"`
+	Library            string                    `json:"library"`
+	LibrarySelection   string                    `json:"library_selection"` // "requested" o "cost_model"
+	Estimates          map[string]time.Duration  `json:"estimates"`         // tiempo estimado por librería
+	EstimatedCostNs    int64                     `json:"estimated_cost_ns"` // nanosegundos con el perfil "standard"
+	EstimatedQueryTime time.Duration             `json:"estimated_query_time"`
+	OptimizationLevel  int                       `json:"optimization_level"`
+	Pipeline           optimizer.Pipeline        `json:"pipeline"` // pases aplicados, en orden
+	PlanCache          optimizer.PlanCachePolicy `json:"plan_cache"`
+	Initial            *optimizer.QueryPlan      `json:"initial_plan"`
+	Passes             []optimizer.PassTrace     `json:"passes"`
+	Plan               *optimizer.QueryPlan      `json:"plan"`
+	Analysis           *PlanAnalysis             `json:"analysis,omitempty"`
+}
+
+// PlanAnalysis contiene la ejecución paso a paso del plan final con la librería elegida
+type PlanAnalysis struct {
+	ParseTime time.Duration   `json:"parse_time"`
+	QueryTime time.Duration   `json:"query_time"` // suma de los tiempos de los pasos ejecutados
+	Batch     int             `json:"batch"`      // ejecuciones promediadas en cada tiempo
+	Steps     []StepAnalysis  `json:"steps"`
+	Found     bool            `json:"found"`
+	Value     interface{}     `json:"value,omitempty"`
+	Error     *queryerr.Error `json:"error,omitempty"`
+}
+
+// StepAnalysis es la ejecución de un paso del plan. Los pasos de memoización no
+// navegan: el análisis no consulta el cache de prefijos y su tiempo es cero.
+type StepAnalysis struct {
+	Index     int           `json:"index"`
+	Type      string        `json:"type"`
+	Target    string        `json:"target"`
+	Estimated time.Duration `json:"estimated"`
+	Actual    time.Duration `json:"actual"`               // tiempo medio por ejecución del paso
+	ValueType string        `json:"value_type,omitempty"` // tipo JSON del valor después del paso, o del valor sobre el que falló
+	Executed  bool          `json:"executed"`             // false si un paso anterior falló
+	Found     bool          `json:"found"`
+}
+
+// Explain construye el plan de una consulta registrando cada pase del optimizador,
+// sin usar el cache de planes ni el pool. Sin librería (o con LibraryAuto) elige la
+// de menor tiempo estimado por el modelo de costos. Con Analyze ejecuta el plan
+// final paso a paso con esa librería, midiendo cada paso y registrando el tipo del
+// valor intermedio; una ruta inexistente se informa en el análisis, no como error.
+// Con Pipeline construye el plan con esos pases, sin cambiar los del motor.
+func (oe *OptimizedEngine) Explain(ctx context.Context, jsonStr string, keys []string, options ExplainOptions) (*ExplainResponse, error) {
+	if err := limits.CheckDocument(jsonStr, oe.limits); err != nil {
+		return nil, err
+	}
+
+	planner := oe.optimizer
+	if options.Pipeline != nil {
+		if err := options.Pipeline.Validate(); err != nil {
+			return nil, queryerr.New(queryerr.CodeInvalidRequest, "pipeline inválido: %v", err)
+		}
+		planner = oe.optimizer.WithPipeline(*options.Pipeline)
+	}
+
+	library := options.Library
+
+	selection := "requested"
+	if library == "" || library == LibraryAuto {
+		library, selection = "", "cost_model"
+	} else if !isLibrary(library) {
+		return nil, queryerr.New(queryerr.CodeInvalidRequest, "librería desconocida: %q", library)
+	}
+
+	// El AST no depende de la librería; sin librería elegida se parsea con encoding/json
+	parseLibrary := library
+	if parseLibrary == "" {
+		parseLibrary = "standard"
+	}
+	data, err := oe.parseForOptimizer(ctx, jsonStr, parseLibrary)
+	if err != nil {
+		return nil, parseError(ctx, jsonStr, err)
+	}
+
+	explanation, err := planner.Explain(ctx, keys, data)
+	if err != nil {
+		if IsCanceled(err) {
+			err = canceledError(ctx)
+		}
+		return nil, err
+	}
+
+	plan := explanation.Plan
+	estimates := make(map[string]time.Duration, len(Libraries))
+	for _, candidate := range Libraries {
+		estimates[candidate] = oe.optimizer.EstimateQueryTime(plan, candidate)
+		if selection == "cost_model" && (library == "" || estimates[candidate] < estimates[library]) {
+			library = candidate
+		}
+	}
+
+	response := &ExplainResponse{
+		Keys:               plan.Path(),
+		Library:            library,
+		LibrarySelection:   selection,
+		Estimates:          estimates,
+		EstimatedCostNs:    plan.EstimatedCostNs,
+		EstimatedQueryTime: estimates[library],
+		OptimizationLevel:  planner.OptimizationLevel(),
+		Pipeline:           planner.Pipeline(),
+		PlanCache:          planner.PlanCachePolicy(),
+		Initial:            explanation.Initial,
+		Passes:             explanation.Passes,
+		Plan:               plan,
+	}
+
+	if options.Analyze {
+		if response.Analysis, err = oe.analyzePlan(ctx, jsonStr, plan, library); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// isLibrary indica si el nombre corresponde a una de las librerías del motor
+func isLibrary(name string) bool {
+	for _, library := range Libraries {
+		if library == name {
+			return true
+		}
+	}
+	return false
+}
+
+// analysisBatch es el número de ejecuciones de un paso que se miden juntas en el
+// análisis; recorrer un segmento tarda pocos nanosegundos y una sola ejecución
+// queda por debajo de la resolución del reloj
+const analysisBatch = 100
+
+// analyzePlan ejecuta el plan paso a paso con la librería indicada. Cada paso se
+// mide sobre analysisBatch ejecuciones a partir del valor que produjo el anterior.
+func (oe *OptimizedEngine) analyzePlan(ctx context.Context, jsonStr string, plan *optimizer.QueryPlan, library string) (*PlanAnalysis, error) {
+	compiled := CompilePlan(plan)
+	analysis := &PlanAnalysis{Batch: analysisBatch, Steps: make([]StepAnalysis, 0, len(plan.Steps))}
+
+	// Parsear con la librería; el valor actual y su tipo dependen de ella
+	var data interface{}
+	var root *fastjson.Value
+	var err error
+	parseStart := time.Now()
+	switch library {
+	case "fastjson":
+		root, err = parseFastJSON(ctx, jsonStr)
+		data = root
+	case "json-iterator":
+		err = decodeJsonIterator(ctx, jsonStr, &data)
+	default:
+		err = decodeStandard(ctx, jsonStr, &data)
+	}
+	if err != nil {
+		return nil, parseError(ctx, jsonStr, err)
+	}
+	analysis.ParseTime = time.Since(parseStart)
+
+	current := data
+	resolved := 0
+	failed := -1
+	var container interface{} // valor sobre el que falló el segmento failed
+	for i, step := range plan.Steps {
+		if ctx.Err() != nil {
+			return nil, canceledError(ctx)
+		}
+
+		stepAnalysis := StepAnalysis{
+			Index:     i,
+			Type:      step.Type,
+			Target:    step.Target,
+			Estimated: step.EstimatedTime,
+			Executed:  failed < 0,
+		}
+		if failed >= 0 {
+			analysis.Steps = append(analysis.Steps, stepAnalysis)
+			continue
+		}
+
+		first, last := resolved, resolved+len(step.Keys)
+		run := func() (interface{}, int) {
+			if library == "fastjson" {
+				return runFastSegments(compiled.fast[first:last], current.(*fastjson.Value))
+			}
+			return runSegments(compiled.steps[first:last], current)
+		}
+
+		value, missing := run()
+		if len(step.Keys) > 0 {
+			stepAnalysis.Actual = measureBatch(func() { run() })
+			analysis.QueryTime += stepAnalysis.Actual
+		}
+
+		if missing >= 0 {
+			failed = first + missing
+			container = value
+			stepAnalysis.ValueType = valueTypeName(value)
+		} else {
+			current = value
+			resolved = last
+			stepAnalysis.Found = true
+			stepAnalysis.ValueType = valueTypeName(current)
+		}
+		analysis.Steps = append(analysis.Steps, stepAnalysis)
+	}
+
+	keys := compiled.Keys()
+	switch {
+	case failed >= 0 && root != nil:
+		analysis.Error = pathNotFoundFastJSON(root, keys, failed)
+		return analysis, nil
+	case failed >= 0:
+		analysis.Error = pathNotFoundAt(container, keys, failed)
+		return analysis, nil
+	}
+
+	value := current
+	if root != nil {
+		value = oe.fastJSONToInterface(current.(*fastjson.Value))
+	}
+	if err := limits.CheckResult(value, oe.limits); err != nil {
+		return nil, err
+	}
+	analysis.Found = true
+	analysis.Value = value
+	return analysis, nil
+}
+
+// measureBatch mide analysisBatch ejecuciones y retorna el tiempo por ejecución
+func measureBatch(run func()) time.Duration {
+	start := time.Now()
+	for i := 0; i < analysisBatch; i++ {
+		run()
+	}
+	return time.Since(start) / analysisBatch
+}
+
+// runSegments aplica una secuencia de segmentos compilados; retorna el valor
+// alcanzado y la posición del segmento que no existe, o -1
+func runSegments(steps []compiledStep, current interface{}) (interface{}, int) {
+	for i, step := range steps {
+		value, found := step(current)
+		if !found {
+			return current, i
+		}
+		current = value
+	}
+	return current, -1
+}
+
+// runFastSegments es el equivalente de runSegments para fastjson
+func runFastSegments(steps []compiledFastStep, current *fastjson.Value) (*fastjson.Value, int) {
+	for i, step := range steps {
+		value, found := step(current)
+		if !found {
+			return current, i
+		}
+		current = value
+	}
+	return current, -1
+}
+
+// valueTypeName retorna el tipo JSON de un valor genérico o de fastjson
+func valueTypeName(value interface{}) string {
+	if v, ok := value.(*fastjson.Value); ok {
+		return fastJSONTypeName(v)
+	}
+	return jsonTypeName(value)
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"procesador-consultas/limits"
+	"procesador-consultas/optimizer"
+	"procesador-consultas/queryerr"
+)
+
+// TestAnalyzeCombinedStepFailure verifica el diagnóstico del análisis cuando un paso
+// combinado falla después de su primera clave: las sugerencias son claves del
+// contenedor alcanzado por el prefijo resuelto, no de la raíz
+func TestAnalyzeCombinedStepFailure(t *testing.T) {
+	pipeline, err := optimizer.ParsePipeline(optimizer.PassStepCombination, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng := NewOptimizedEngineWithLimits(limits.Default())
+	document := `{"a":{"x":1,"bb":2},"zz":5}`
+
+	for _, library := range Libraries {
+		response, err := eng.Explain(context.Background(), document, []string{"a", "b"},
+			ExplainOptions{Library: library, Analyze: true, Pipeline: &pipeline})
+		if err != nil {
+			t.Fatalf("%s: %v", library, err)
+		}
+
+		var combined bool
+		for _, step := range response.Plan.Steps {
+			combined = combined || reflect.DeepEqual(step.Keys, []string{"a", "b"})
+		}
+		if !combined {
+			t.Fatalf("%s: el plan no combina a y b en un paso: %+v", library, response.Plan.Steps)
+		}
+
+		analysis := response.Analysis
+		if analysis == nil || analysis.Error == nil || analysis.Error.Diagnostic == nil {
+			t.Fatalf("%s: se esperaba un error con diagnóstico, se obtuvo %+v", library, analysis)
+		}
+		diagnostic := analysis.Error.Diagnostic
+		if analysis.Error.Code != queryerr.CodePathNotFound || diagnostic.FailedSegment != 1 ||
+			!reflect.DeepEqual(diagnostic.ResolvedPrefix, []string{"a"}) || diagnostic.FoundType != "object" ||
+			!reflect.DeepEqual(diagnostic.Suggestions, []string{"bb", "x"}) {
+			t.Errorf("%s: diagnóstico %+v; se esperaba el segmento 1 sobre el objeto de a con las claves de a como sugerencias", library, diagnostic)
+		}
+	}
+}
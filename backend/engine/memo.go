@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"procesador-consultas/optimizer"
+
+	"github.com/valyala/fastjson"
+)
+
+// memoRun acompaña una ejecución que usa el cache de prefijos del optimizador:
+// busca el prefijo memorizado más largo del documento y reúne los valores de los
+// prefijos que resuelve para guardarlos al terminar, fuera de la medición
+type memoRun struct {
+	oe          *OptimizedEngine
+	library     string
+	fingerprint string
+	keys        []string
+	points      []int
+	pending     []memoValue
+}
+
+// memoValue es el valor resuelto por un prefijo, pendiente de guardar
+type memoValue struct {
+	prefix int
+	value  interface{}
+}
+
+// newMemoRun prepara el uso del cache de prefijos para una ejecución
+func (oe *OptimizedEngine) newMemoRun(jsonStr string, entry *QueryPlan, library string) *memoRun {
+	return &memoRun{
+		oe:          oe,
+		library:     library,
+		fingerprint: optimizer.ContentFingerprint(jsonStr),
+		keys:        entry.Compiled.Keys(),
+		points:      entry.Compiled.MemoPoints(),
+	}
+}
+
+// lookup retorna el valor del prefijo memorizado más largo y su longitud
+func (m *memoRun) lookup() (interface{}, int, bool) {
+	return m.oe.optimizer.MemoLookup(m.library, m.fingerprint, m.keys, m.points)
+}
+
+// visitor retorna la función que reúne los valores de los prefijos memorizados,
+// o nil si la ejecución no usa el cache
+func (m *memoRun) visitor() memoVisitor {
+	if m == nil {
+		return nil
+	}
+	return func(prefix int, value interface{}) {
+		m.pending = append(m.pending, memoValue{prefix: prefix, value: value})
+	}
+}
+
+// fastJSONVisitor es el equivalente de visitor para fastjson
+func (m *memoRun) fastJSONVisitor() memoVisitorFastJSON {
+	if m == nil {
+		return nil
+	}
+	return func(prefix int, value *fastjson.Value) {
+		m.pending = append(m.pending, memoValue{prefix: prefix, value: value})
+	}
+}
+
+// store guarda los valores reunidos. Los nodos de fastjson se copian y se congelan
+// antes de compartirlos entre consultas concurrentes (ver detachFastJSON).
+func (m *memoRun) store() {
+	if m == nil {
+		return
+	}
+	for _, pending := range m.pending {
+		value := pending.value
+		var size int64
+		if v, ok := value.(*fastjson.Value); ok {
+			detached, detachedSize, err := detachFastJSON(v)
+			if err != nil {
+				continue
+			}
+			value, size = detached, detachedSize
+		} else {
+			size = valueSize(value)
+		}
+		m.oe.optimizer.MemoStore(m.library, m.fingerprint, m.keys[:pending.prefix], value, size)
+	}
+	m.pending = nil
+}
+
+// detachFastJSON copia un subárbol de fastjson con un parser propio. Un nodo del
+// documento referencia el buffer y los nodos de todo el documento, así que guardarlo
+// mantendría vivo el documento completo mientras la entrada siga en el cache; la copia
+// solo retiene la serialización del subárbol. Retorna la copia congelada y su tamaño
+// aproximado: la serialización más los nodos.
+func detachFastJSON(v *fastjson.Value) (*fastjson.Value, int64, error) {
+	raw := v.MarshalTo(nil)
+	var parser fastjson.Parser
+	detached, err := parser.ParseBytes(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	return detached, int64(len(raw)) + freezeFastJSON(detached), nil
+}
+
+// freezeFastJSON completa la decodificación perezosa del subárbol: fastjson convierte
+// las cadenas (Type) y las claves de los objetos (Visit, Get) la primera vez que se
+// leen, modificando el valor. Una vez recorrido, leerlo ya no lo modifica y se puede
+// compartir entre goroutines. Retorna el tamaño aproximado del subárbol en bytes.
+func freezeFastJSON(v *fastjson.Value) int64 {
+	size := int64(48)
+	switch v.Type() {
+	case fastjson.TypeObject:
+		v.GetObject().Visit(func(key []byte, value *fastjson.Value) {
+			size += 32 + int64(len(key)) + freezeFastJSON(value)
+		})
+	case fastjson.TypeArray:
+		for _, item := range v.GetArray() {
+			size += 8 + freezeFastJSON(item)
+		}
+	case fastjson.TypeString:
+		size += int64(len(v.GetStringBytes()))
+	}
+	return size
+}
+
+// valueSize retorna el tamaño aproximado en bytes de un valor decodificado
+func valueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		size := int64(48)
+		for key, item := range v {
+			size += 32 + int64(len(key)) + valueSize(item)
+		}
+		return size
+	case []interface{}:
+		size := int64(24)
+		for _, item := range v {
+			size += 16 + valueSize(item)
+		}
+		return size
+	case string:
+		return 16 + int64(len(v))
+	}
+	return 16
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"procesador-consultas/parser"
+)
+
+// TestMemoFastJSONDetached verifica que los prefijos memorizados con fastjson no
+// retengan el documento del que salieron: después de consultar documentos grandes que
+// solo comparten la forma, el heap vivo crece con el tamaño de los subárboles guardados
+// y no con el de los documentos
+func TestMemoFastJSONDetached(t *testing.T) {
+	eng := NewOptimizedEngine()
+	keys, err := parser.ParseQueryString("a.b.c.d.e.f.g.h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const documents = 16
+	const padding = 2 << 20
+	heapAlloc := func() uint64 {
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	before := heapAlloc()
+	for i := 0; i < documents; i++ {
+		document := fmt.Sprintf(`{"relleno": %q, "a": {"b": {"c": {"d": {"e": {"f": {"g": {"h": %d}}}}}}}}`,
+			strings.Repeat("x", padding), i)
+		result := eng.QueryWithOptimization(context.Background(), document, keys, "fastjson")
+		if result.Err != nil || result.Value != float64(i) {
+			t.Fatalf("documento %d: %v (%v)", i, result.Value, result.Err)
+		}
+
+		// La segunda consulta sobre el mismo documento usa el prefijo memorizado
+		again := eng.QueryWithOptimization(context.Background(), document, keys, "fastjson")
+		if again.Performance.MemoizedSegments == 0 || again.Value != float64(i) {
+			t.Fatalf("documento %d: no se usó el prefijo memorizado (%+v)", i, again.Performance)
+		}
+	}
+	grown := int64(heapAlloc()) - int64(before)
+
+	memo := eng.GetOptimizerStats().Caches["memo"]
+	if memo.Entries == 0 {
+		t.Fatal("no se memorizó ningún prefijo")
+	}
+	if limit := int64(documents * padding / 4); grown > limit {
+		t.Errorf("el heap creció %d bytes con %d entradas memorizadas; los documentos suman %d bytes",
+			grown, memo.Entries, documents*padding)
+	}
+}
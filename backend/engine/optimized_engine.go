@@ -1,23 +1,24 @@
 package engine
 
 import (
-	"encoding/json"
-	"fmt"
-	"sync"
+	"context"
 	"time"
 
+	"procesador-consultas/cache"
+	"procesador-consultas/limits"
 	"procesador-consultas/optimizer"
+	"procesador-consultas/parser"
+	"procesador-consultas/queryerr"
 
-	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
 )
 
 // OptimizedEngine representa el motor de consultas optimizado
 type OptimizedEngine struct {
 	*Engine
 	optimizer *optimizer.Optimizer
-	pool      *QueryPool
-	stats     *OptimizedEngineStats
-	statsMux  sync.RWMutex
+	pool      *cache.Cache // planes compilados por librería y consulta
+	stats     *engineStats
 }
 
 // OptimizedEngineStats contiene estadísticas del motor optimizado
@@ -27,175 +28,304 @@ type OptimizedEngineStats struct {
 	CacheHits               int64
 	AverageOptimizationTime time.Duration
 	TotalOptimizationTime   time.Duration
+	CostModel               map[string]CostAccuracy // estimado frente a medido por librería
 }
 
-// QueryPool representa un pool de consultas para reutilización
-type QueryPool struct {
-	queries map[string]*QueryPlan
-	mux     sync.RWMutex
-}
-
-// QueryPlan representa un plan de consulta optimizado
+// QueryPlan representa un plan de consulta optimizado del pool
 type QueryPlan struct {
 	Query     []string
 	Plan      *optimizer.QueryPlan
+	Compiled  *CompiledPlan
 	CreatedAt time.Time
-	UsedCount int64
 }
 
-// NewOptimizedEngine crea un nuevo motor optimizado
+// sizeBytes retorna el tamaño aproximado de la entrada del pool: el plan y dos
+// funciones compiladas por segmento
+func (p *QueryPlan) sizeBytes() int64 {
+	return 64 + p.Plan.SizeBytes() + int64(len(p.Compiled.keys))*96
+}
+
+// NewOptimizedEngine crea un nuevo motor optimizado con los límites por defecto
 func NewOptimizedEngine() *OptimizedEngine {
-	config := &optimizer.OptimizationConfig{
+	return NewOptimizedEngineWithLimits(limits.Default())
+}
+
+// NewOptimizedEngineWithLimits crea un nuevo motor optimizado con límites de recursos propios,
+// compartidos por todas las librerías y por el optimizador
+func NewOptimizedEngineWithLimits(resourceLimits limits.Config) *OptimizedEngine {
+	return NewOptimizedEngineWithConfig(resourceLimits, DefaultOptimizationConfig())
+}
+
+// DefaultOptimizationConfig retorna la configuración del optimizador del motor optimizado
+func DefaultOptimizationConfig() *optimizer.OptimizationConfig {
+	return &optimizer.OptimizationConfig{
 		EnableCache:       true,
 		EnableMemoization: true,
 		MaxCacheSize:      1000,
 		EnableParallel:    true,
 		OptimizationLevel: 2,
+		PlanCache:         optimizer.PlanCacheByQuery,
 	}
+}
+
+// NewOptimizedEngineWithConfig crea un motor optimizado con una configuración del
+// optimizador propia; los límites de recursos reemplazan a los de la configuración
+func NewOptimizedEngineWithConfig(resourceLimits limits.Config, config *optimizer.OptimizationConfig) *OptimizedEngine {
+	config.Limits = resourceLimits
 
 	optimizedEngine := &OptimizedEngine{
-		Engine:    NewEngine(),
+		Engine:    NewEngineWithLimits(resourceLimits),
 		optimizer: optimizer.NewOptimizer(config),
-		pool: &QueryPool{
-			queries: make(map[string]*QueryPlan),
-		},
-		stats: &OptimizedEngineStats{},
+		pool:      cache.New(config.CacheConfig()),
+		stats:     newEngineStats(),
 	}
 
 	return optimizedEngine
 }
 
 // QueryWithOptimization ejecuta una consulta con optimizaciones
-func (oe *OptimizedEngine) QueryWithOptimization(jsonStr string, keys []string, library string) QueryResult {
+func (oe *OptimizedEngine) QueryWithOptimization(ctx context.Context, jsonStr string, keys []string, library string) QueryResult {
 	// Actualizar estadísticas
-	oe.statsMux.Lock()
-	oe.stats.TotalQueries++
-	oe.statsMux.Unlock()
+	oe.stats.totalQueries.Add(1)
+
+	// Verificar límites de recursos antes de parsear (también para planes del pool)
+	if err := limits.CheckDocument(jsonStr, oe.limits); err != nil {
+		result := QueryResult{Keys: keys}
+		result.setError(err)
+		return result
+	}
 
-	// Generar clave de consulta
+	// Generar clave de consulta. Con PlanCacheByShape el plan depende de la forma del
+	// documento, así que hay que parsearlo antes de buscar en el pool; la ejecución
+	// reutiliza ese parseo.
 	queryKey := oe.generateQueryKey(keys, library)
+	var doc *parsedDocument
+	var data interface{}
+	if oe.optimizer.PlanCachePolicy() == optimizer.PlanCacheByShape {
+		var parseErr error
+		if doc, parseErr = parseDocument(ctx, jsonStr, library); parseErr != nil {
+			result := QueryResult{Keys: keys}
+			result.setParseError(jsonStr, parseErr)
+			return result
+		}
+		data = oe.genericData(doc)
+
+		if err := oe.setShape(ctx, doc, data); err != nil {
+			result := QueryResult{Keys: keys}
+			result.setError(err)
+			return result
+		}
+		queryKey += "@" + doc.shape
+	}
 
 	// Verificar pool de consultas
 	if cached := oe.getFromPool(queryKey); cached != nil {
-		oe.statsMux.Lock()
-		oe.stats.CacheHits++
-		oe.statsMux.Unlock()
+		oe.stats.cacheHits.Add(1)
 
-		// Ejecutar consulta con plan optimizado
-		return oe.executeOptimizedQuery(jsonStr, cached.Plan, library)
+		// Ejecutar consulta con el plan compilado
+		return oe.executeOptimizedQuery(ctx, jsonStr, doc, cached, library)
 	}
 
 	// Parsear JSON según la librería
-	var data interface{}
-	var parseErr error
-
-	switch library {
-	case "json-iterator":
-		parseErr = jsoniter.Unmarshal([]byte(jsonStr), &data)
-	case "fastjson":
-		// Para fastjson, usamos la implementación existente
-		return oe.QueryWithFastJSON(jsonStr, keys)
-	default:
-		parseErr = json.Unmarshal([]byte(jsonStr), &data)
-	}
-
-	if parseErr != nil {
-		return QueryResult{
-			Error: fmt.Sprintf("error parseando JSON: %v", parseErr),
-			Keys:  keys,
+	if doc == nil {
+		var parseErr error
+		if doc, parseErr = parseDocument(ctx, jsonStr, library); parseErr != nil {
+			result := QueryResult{Keys: keys}
+			result.setParseError(jsonStr, parseErr)
+			return result
+		}
+		data = oe.genericData(doc)
+
+		// La forma permite saber si el plan (quizá del cache del optimizador) se
+		// construyó para este documento; el optimizador la reutiliza
+		if err := oe.setShape(ctx, doc, data); err != nil {
+			result := QueryResult{Keys: keys}
+			result.setError(err)
+			return result
 		}
 	}
 
 	// Optimizar consulta
 	optimizationStart := time.Now()
-	plan := oe.optimizer.OptimizeQuery(keys, data)
-	oe.stats.TotalOptimizationTime += time.Since(optimizationStart)
+	plan, err := oe.optimizer.OptimizeQueryWithShape(ctx, keys, data, doc.shape)
+	oe.stats.optimizationTime.Add(int64(time.Since(optimizationStart)))
+	if err != nil {
+		if IsCanceled(err) {
+			err = canceledError(ctx)
+		}
+		result := QueryResult{Keys: keys}
+		result.setError(err)
+		return result
+	}
 
-	// Guardar en pool
-	oe.saveToPool(queryKey, &QueryPlan{
+	// Compilar y guardar en pool
+	entry := &QueryPlan{
 		Query:     keys,
 		Plan:      plan,
+		Compiled:  CompilePlan(plan),
 		CreatedAt: time.Now(),
-		UsedCount: 1,
-	})
+	}
+	oe.saveToPool(queryKey, entry)
 
-	// Ejecutar consulta optimizada
-	result := oe.executeOptimizedQuery(jsonStr, plan, library)
+	// Ejecutar consulta optimizada sobre el documento ya parseado
+	result := oe.executeOptimizedQuery(ctx, jsonStr, doc, entry, library)
 
 	// Actualizar estadísticas
-	oe.statsMux.Lock()
-	oe.stats.OptimizedQueries++
-	oe.statsMux.Unlock()
+	oe.stats.optimizedQueries.Add(1)
 
 	return result
 }
 
-// executeOptimizedQuery ejecuta una consulta usando un plan optimizado
-func (oe *OptimizedEngine) executeOptimizedQuery(jsonStr string, plan *optimizer.QueryPlan, library string) QueryResult {
-	start := time.Now()
-
-	result := QueryResult{
-		Keys: []string{plan.Steps[0].Target}, // Usar el primer paso como clave
-		Performance: Performance{
-			LibraryType: library,
-		},
-	}
+// parsedDocument es el documento de una consulta parseado con su librería: valores
+// genéricos con encoding/json y json-iterator, o el valor de fastjson
+type parsedDocument struct {
+	data      interface{}
+	fast      *fastjson.Value
+	parseTime time.Duration
+	shape     string // huella estructural, si se calculó (ver setShape)
+}
 
-	// Ejecutar pasos del plan optimizado
-	var current interface{}
-	var parseErr error
+// parseDocument parsea el documento con la librería y mide el tiempo de parseo
+func parseDocument(ctx context.Context, jsonStr string, library string) (*parsedDocument, error) {
+	doc := &parsedDocument{}
+	var err error
 
-	// Parsear JSON una sola vez
-	parseStart := time.Now()
+	start := time.Now()
 	switch library {
 	case "json-iterator":
-		parseErr = jsoniter.Unmarshal([]byte(jsonStr), &current)
+		err = decodeJsonIterator(ctx, jsonStr, &doc.data)
 	case "fastjson":
-		// Para fastjson, usar implementación existente
-		return oe.QueryWithFastJSON(jsonStr, []string{plan.Steps[0].Target})
+		doc.fast, err = parseFastJSON(ctx, jsonStr)
 	default:
-		parseErr = json.Unmarshal([]byte(jsonStr), &current)
+		err = decodeStandard(ctx, jsonStr, &doc.data)
 	}
+	doc.parseTime = time.Since(start)
 
-	if parseErr != nil {
-		result.Error = fmt.Sprintf("error parseando JSON: %v", parseErr)
-		result.Performance.TotalTime = time.Since(start)
-		return result
+	return doc, err
+}
+
+// setShape calcula la huella estructural del documento a partir de sus valores
+// genéricos
+func (oe *OptimizedEngine) setShape(ctx context.Context, doc *parsedDocument, data interface{}) error {
+	shape, err := oe.optimizer.ShapeFingerprint(ctx, data)
+	if err != nil {
+		if IsCanceled(err) {
+			return canceledError(ctx)
+		}
+		return err
 	}
+	doc.shape = shape
+	return nil
+}
 
-	result.Performance.ParseTime = time.Since(parseStart)
+// planMatches indica si el plan se construyó para un documento con la forma de doc.
+// Solo entonces las estadísticas del plan describen el documento y su costo
+// estimado es comparable con el tiempo medido; con PlanCacheByQuery, un plan del
+// pool se ejecuta sin calcular la forma y no se compara.
+func planMatches(doc *parsedDocument, entry *QueryPlan) bool {
+	return doc.shape != "" && doc.shape == entry.Plan.Shape
+}
 
-	// Ejecutar pasos optimizados
-	queryStart := time.Now()
-	for _, step := range plan.Steps {
-		switch step.Type {
-		case "navigation", "direct_access":
-			if value, found := oe.navigateOptimized(current, step.Target); found {
-				current = value
-			} else {
-				result.Error = fmt.Sprintf("no se encontró el valor para: %s", step.Target)
-				result.Performance.TotalTime = time.Since(start)
-				return result
-			}
-		case "combined_navigation":
-			// Para navegación combinada, dividir y ejecutar
-			keys := oe.splitCombinedKey(step.Target)
-			for _, key := range keys {
-				if value, found := oe.navigateOptimized(current, key); found {
-					current = value
-				} else {
-					result.Error = fmt.Sprintf("no se encontró el valor para: %s", key)
-					result.Performance.TotalTime = time.Since(start)
-					return result
-				}
-			}
-		case "memoization":
-			// Verificar cache (implementación simplificada)
-			continue
+// genericData retorna el documento como valores genéricos para el optimizador; con
+// fastjson lo convierte
+func (oe *OptimizedEngine) genericData(doc *parsedDocument) interface{} {
+	if doc.fast != nil {
+		return oe.fastJSONToInterface(doc.fast)
+	}
+	return doc.data
+}
+
+// parseForOptimizer parsea el documento con la librería para recorrerlo con el
+// optimizador, que trabaja sobre valores genéricos: con fastjson convierte el
+// documento
+func (oe *OptimizedEngine) parseForOptimizer(ctx context.Context, jsonStr string, library string) (interface{}, error) {
+	doc, err := parseDocument(ctx, jsonStr, library)
+	if err != nil {
+		return nil, err
+	}
+	return oe.genericData(doc), nil
+}
+
+// DocumentAST construye el AST del optimizador para un documento, con los mismos
+// límites de recursos que las consultas
+func (oe *OptimizedEngine) DocumentAST(ctx context.Context, jsonStr string) (*optimizer.ASTNode, error) {
+	if err := limits.CheckDocument(jsonStr, oe.limits); err != nil {
+		return nil, err
+	}
+
+	data, err := oe.parseForOptimizer(ctx, jsonStr, "standard")
+	if err != nil {
+		return nil, parseError(ctx, jsonStr, err)
+	}
+
+	ast, err := oe.optimizer.BuildAST(ctx, data)
+	if err != nil && IsCanceled(err) {
+		err = canceledError(ctx)
+	}
+	return ast, err
+}
+
+// executeOptimizedQuery ejecuta una consulta usando el plan compilado del pool sobre
+// el documento ya parseado o, si doc es nil, parseándolo. Si el plan memoriza
+// prefijos, primero busca en el cache de prefijos el valor de alguno sobre el mismo
+// documento y, si lo encuentra, ejecuta solo el resto de la ruta sin parsear el
+// documento.
+func (oe *OptimizedEngine) executeOptimizedQuery(ctx context.Context, jsonStr string, doc *parsedDocument, entry *QueryPlan, library string) QueryResult {
+	if library == "fastjson" {
+		return oe.executeCompiledFastJSON(ctx, jsonStr, doc, entry)
+	}
+
+	var memo *memoRun
+	if len(entry.Compiled.MemoPoints()) > 0 {
+		memo = oe.newMemoRun(jsonStr, entry, library)
+		if result, ok := oe.executeMemoized(ctx, memo, entry, library); ok {
+			return result
 		}
 	}
 
+	start := time.Now()
+
+	result := QueryResult{
+		Keys: entry.Compiled.Keys(),
+		Performance: Performance{
+			LibraryType:        library,
+			EstimatedQueryTime: oe.optimizer.EstimateQueryTime(entry.Plan, library),
+		},
+	}
+
+	// Parsear JSON una sola vez; un parseo previo cuenta en el tiempo total
+	if doc == nil {
+		var parseErr error
+		if doc, parseErr = parseDocument(ctx, jsonStr, library); parseErr != nil {
+			result.setParseError(jsonStr, parseErr)
+			result.Performance.TotalTime = time.Since(start)
+			return result
+		}
+	} else {
+		start = start.Add(-doc.parseTime)
+	}
+	result.Performance.ParseTime = doc.parseTime
+
+	// Ejecutar la cadena compilada
+	queryStart := time.Now()
+	current, failed, err := entry.Compiled.RunFrom(ctx, doc.data, 0, memo.visitor())
 	result.Performance.QueryTime = time.Since(queryStart)
+	if err == nil && planMatches(doc, entry) {
+		oe.recordCost(library, result.Performance.EstimatedQueryTime, result.Performance.QueryTime)
+	}
+	memo.store()
+	if err == nil && failed >= 0 {
+		err = pathNotFoundAt(current, result.Keys, failed)
+	}
+	if err == nil {
+		err = limits.CheckResult(current, oe.limits)
+	}
+	if err != nil {
+		result.setError(err)
+		result.Performance.TotalTime = time.Since(start)
+		return result
+	}
+
 	result.Performance.TotalTime = time.Since(start)
 	result.Value = current
 	result.Found = true
@@ -203,150 +333,197 @@ func (oe *OptimizedEngine) executeOptimizedQuery(jsonStr string, plan *optimizer
 	return result
 }
 
-// navigateOptimized navega por la estructura JSON de forma optimizada
-func (oe *OptimizedEngine) navigateOptimized(data interface{}, key string) (interface{}, bool) {
-	switch v := data.(type) {
-	case map[string]interface{}:
-		if value, exists := v[key]; exists {
-			return value, true
-		}
-	case map[interface{}]interface{}:
-		if value, exists := v[key]; exists {
-			return value, true
-		}
-	case []interface{}:
-		// Intentar convertir la clave a índice
-		var index int
-		if _, err := fmt.Sscanf(key, "%d", &index); err == nil && index >= 0 && index < len(v) {
-			return v[index], true
+// executeMemoized ejecuta la consulta a partir del prefijo memorizado más largo.
+// Solo resuelve consultas cuya ruta existe: si no hay prefijo guardado o la ruta
+// falla, retorna false y la ejecución completa construye el error con su diagnóstico.
+func (oe *OptimizedEngine) executeMemoized(ctx context.Context, memo *memoRun, entry *QueryPlan, library string) (QueryResult, bool) {
+	start := time.Now()
+	cached, resolved, ok := memo.lookup()
+	if !ok {
+		return QueryResult{}, false
+	}
+
+	queryStart := time.Now()
+	var current interface{}
+	var failed int
+	var err error
+	if library == "fastjson" {
+		var value *fastjson.Value
+		value, failed, err = entry.Compiled.RunFastJSONFrom(ctx, cached.(*fastjson.Value), resolved, memo.fastJSONVisitor())
+		if err == nil && failed < 0 {
+			current = oe.fastJSONToInterface(value)
 		}
+	} else {
+		current, failed, err = entry.Compiled.RunFrom(ctx, cached, resolved, memo.visitor())
 	}
-	return nil, false
+	queryTime := time.Since(queryStart)
+	memo.store()
+
+	if err != nil || failed >= 0 || limits.CheckResult(current, oe.limits) != nil {
+		return QueryResult{}, false
+	}
+
+	return QueryResult{
+		Found: true,
+		Value: current,
+		Keys:  entry.Compiled.Keys(),
+		Performance: Performance{
+			QueryTime:          queryTime,
+			TotalTime:          time.Since(start),
+			LibraryType:        library,
+			EstimatedQueryTime: oe.optimizer.EstimateQueryTime(entry.Plan, library),
+			MemoizedSegments:   resolved,
+		},
+	}, true
 }
 
-// splitCombinedKey divide una clave combinada en claves individuales
-func (oe *OptimizedEngine) splitCombinedKey(combinedKey string) []string {
-	// Implementación simple: dividir por punto
-	var keys []string
-	var current string
-
-	for _, ch := range combinedKey {
-		if ch == '.' {
-			if current != "" {
-				keys = append(keys, current)
-				current = ""
-			}
-		} else {
-			current += string(ch)
+// executeCompiledFastJSON ejecuta el plan compilado sobre fastjson con las mismas
+// validaciones y errores que QueryWithFastJSON, sobre el documento ya parseado o, si
+// doc es nil, parseándolo
+func (oe *OptimizedEngine) executeCompiledFastJSON(ctx context.Context, jsonStr string, doc *parsedDocument, entry *QueryPlan) QueryResult {
+	var memo *memoRun
+	if jsonStr != "" && len(entry.Compiled.MemoPoints()) > 0 {
+		memo = oe.newMemoRun(jsonStr, entry, "fastjson")
+		if result, ok := oe.executeMemoized(ctx, memo, entry, "fastjson"); ok {
+			return result
 		}
 	}
 
-	if current != "" {
-		keys = append(keys, current)
+	start := time.Now()
+
+	result := QueryResult{
+		Keys: entry.Compiled.Keys(),
+		Performance: Performance{
+			LibraryType:        "fastjson",
+			EstimatedQueryTime: oe.optimizer.EstimateQueryTime(entry.Plan, "fastjson"),
+		},
+	}
+
+	if jsonStr == "" {
+		result.setError(queryerr.New(queryerr.CodeInvalidDocument, "JSON de entrada está vacío"))
+		result.Performance.TotalTime = time.Since(start)
+		return result
 	}
 
-	return keys
+	if doc == nil {
+		var err error
+		if doc, err = parseDocument(ctx, jsonStr, "fastjson"); err != nil {
+			result.setParseError(jsonStr, err)
+			result.Performance.TotalTime = time.Since(start)
+			return result
+		}
+	} else {
+		start = start.Add(-doc.parseTime)
+	}
+	result.Performance.ParseTime = doc.parseTime
+	v := doc.fast
+
+	queryStart := time.Now()
+	current, failed, err := entry.Compiled.RunFastJSONFrom(ctx, v, 0, memo.fastJSONVisitor())
+	var value interface{}
+	if err == nil && failed < 0 {
+		value = oe.fastJSONToInterface(current)
+	}
+	result.Performance.QueryTime = time.Since(queryStart)
+	if err == nil && planMatches(doc, entry) {
+		oe.recordCost("fastjson", result.Performance.EstimatedQueryTime, result.Performance.QueryTime)
+	}
+	memo.store()
+
+	switch {
+	case err != nil:
+	case failed >= 0:
+		err = pathNotFoundFastJSON(v, result.Keys, failed)
+	default:
+		err = limits.CheckResult(value, oe.limits)
+	}
+	if err != nil {
+		result.setError(err)
+		result.Performance.TotalTime = time.Since(start)
+		return result
+	}
+
+	result.Performance.TotalTime = time.Since(start)
+	result.Value = value
+	result.Found = true
+
+	return result
 }
 
-// generateQueryKey genera una clave única para la consulta
+// generateQueryKey genera una clave única para la consulta a partir de la forma canónica de la ruta
 func (oe *OptimizedEngine) generateQueryKey(keys []string, library string) string {
-	key := library + ":"
-	for _, k := range keys {
-		key += k + "."
-	}
-	return key
+	return library + ":" + parser.CanonicalKey(keys)
 }
 
 // getFromPool obtiene un plan del pool
 func (oe *OptimizedEngine) getFromPool(key string) *QueryPlan {
-	oe.pool.mux.RLock()
-	defer oe.pool.mux.RUnlock()
-
-	if plan, exists := oe.pool.queries[key]; exists {
-		plan.UsedCount++
-		return plan
+	if plan, exists := oe.pool.Get(key); exists {
+		return plan.(*QueryPlan)
 	}
 	return nil
 }
 
 // saveToPool guarda un plan en el pool
 func (oe *OptimizedEngine) saveToPool(key string, plan *QueryPlan) {
-	oe.pool.mux.Lock()
-	defer oe.pool.mux.Unlock()
-
-	// Limpiar planes antiguos (más de 1 hora)
-	now := time.Now()
-	for k, p := range oe.pool.queries {
-		if now.Sub(p.CreatedAt) > time.Hour {
-			delete(oe.pool.queries, k)
-		}
-	}
-
-	oe.pool.queries[key] = plan
+	oe.pool.Set(key, plan, int64(len(key))+plan.sizeBytes())
 }
 
 // CompareOptimizedPerformance compara rendimiento con optimizaciones
-func (oe *OptimizedEngine) CompareOptimizedPerformance(jsonStr string, keys []string) map[string]QueryResult {
-	results := make(map[string]QueryResult)
+func (oe *OptimizedEngine) CompareOptimizedPerformance(ctx context.Context, jsonStr string, keys []string) map[string]QueryResult {
+	results, _ := oe.CompareOptimizedPerformanceWithOptions(ctx, jsonStr, keys, ExecutionOptions{Mode: ExecutionSequential})
+	return results
+}
 
-	// Ejecutar con optimizaciones para cada librería
-	libraries := []string{"standard", "json-iterator", "fastjson"}
+// CompareOptimizedPerformanceWithOptions compara rendimiento con optimizaciones
+// ejecutando las librerías de forma secuencial o concurrente según las opciones.
+// Retorna también las opciones efectivas con las que se obtuvieron las mediciones.
+func (oe *OptimizedEngine) CompareOptimizedPerformanceWithOptions(ctx context.Context, jsonStr string, keys []string, options ExecutionOptions) (map[string]QueryResult, ExecutionOptions) {
+	tasks := make([]comparisonTask, 0, len(Libraries)*2)
 
-	for _, library := range libraries {
-		results[library+"_optimized"] = oe.QueryWithOptimization(jsonStr, keys, library)
+	// Ejecutar con optimizaciones para cada librería
+	for _, library := range Libraries {
+		library := library
+		tasks = append(tasks, comparisonTask{
+			name: library + "_optimized",
+			keys: keys,
+			run:  func() QueryResult { return oe.QueryWithOptimization(ctx, jsonStr, keys, library) },
+		})
 	}
 
 	// Comparar con versiones no optimizadas
-	for _, library := range libraries {
-		var result QueryResult
-		switch library {
-		case "standard":
-			result = oe.QueryWithStandardLibrary(jsonStr, keys)
-		case "json-iterator":
-			result = oe.QueryWithJsonIterator(jsonStr, keys)
-		case "fastjson":
-			result = oe.QueryWithFastJSON(jsonStr, keys)
-		}
-		results[library+"_original"] = result
+	for _, library := range Libraries {
+		run := oe.runnerFor(library)
+		tasks = append(tasks, comparisonTask{
+			name: library + "_original",
+			keys: keys,
+			run:  func() QueryResult { return run(ctx, jsonStr, keys) },
+		})
 	}
 
-	return results
+	options.Normalize(len(tasks))
+	return runComparisonTasks(ctx, tasks, options), options
 }
 
-// GetOptimizationStats retorna las estadísticas de optimización
+// GetOptimizationStats retorna una copia de las estadísticas de optimización
 func (oe *OptimizedEngine) GetOptimizationStats() *OptimizedEngineStats {
-	oe.statsMux.RLock()
-	defer oe.statsMux.RUnlock()
-
-	// Crear una copia para evitar race conditions
-	stats := &OptimizedEngineStats{
-		TotalQueries:          oe.stats.TotalQueries,
-		OptimizedQueries:      oe.stats.OptimizedQueries,
-		CacheHits:             oe.stats.CacheHits,
-		TotalOptimizationTime: oe.stats.TotalOptimizationTime,
-	}
-
-	// Calcular tiempo promedio
-	if stats.TotalQueries > 0 {
-		stats.AverageOptimizationTime = stats.TotalOptimizationTime / time.Duration(stats.TotalQueries)
-	}
-
-	return stats
+	return oe.stats.snapshot()
 }
 
-// GetOptimizerStats retorna las estadísticas del optimizador
+// GetOptimizerStats retorna las estadísticas del optimizador, con las métricas
+// del pool de planes compilados del motor en Caches["query_pool"]
 func (oe *OptimizedEngine) GetOptimizerStats() *optimizer.OptimizationStats {
-	return oe.optimizer.GetStats()
+	stats := oe.optimizer.GetStats()
+	stats.Caches["query_pool"] = oe.pool.Stats()
+	return stats
 }
 
 // ClearOptimizationCache limpia el cache de optimización
 func (oe *OptimizedEngine) ClearOptimizationCache() {
 	oe.optimizer.ClearCache()
+	oe.pool.Clear()
+}
 
-	oe.pool.mux.Lock()
-	defer oe.pool.mux.Unlock()
-
-	for k := range oe.pool.queries {
-		delete(oe.pool.queries, k)
-	}
+// Pipeline retorna el pipeline de pases del optimizador del motor
+func (oe *OptimizedEngine) Pipeline() optimizer.Pipeline {
+	return oe.optimizer.Pipeline()
 }
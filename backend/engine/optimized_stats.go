@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// engineStats acumula las estadísticas del motor optimizado. Los contadores son
+// atómicos y las muestras del modelo de costos se protegen con su propio mutex,
+// así que las consultas concurrentes no comparten un bloqueo global; snapshot
+// retorna una copia independiente.
+type engineStats struct {
+	totalQueries     atomic.Int64
+	optimizedQueries atomic.Int64
+	cacheHits        atomic.Int64
+	optimizationTime atomic.Int64 // nanosegundos
+
+	costMux sync.Mutex
+	cost    map[string]*costSamples // tiempo estimado y medido por librería
+}
+
+// newEngineStats crea el colector de estadísticas
+func newEngineStats() *engineStats {
+	return &engineStats{cost: make(map[string]*costSamples)}
+}
+
+// snapshot retorna una copia de las estadísticas
+func (s *engineStats) snapshot() *OptimizedEngineStats {
+	stats := &OptimizedEngineStats{
+		TotalQueries:          s.totalQueries.Load(),
+		OptimizedQueries:      s.optimizedQueries.Load(),
+		CacheHits:             s.cacheHits.Load(),
+		TotalOptimizationTime: time.Duration(s.optimizationTime.Load()),
+	}
+
+	// Calcular tiempo promedio
+	if stats.TotalQueries > 0 {
+		stats.AverageOptimizationTime = stats.TotalOptimizationTime / time.Duration(stats.TotalQueries)
+	}
+
+	s.costMux.Lock()
+	defer s.costMux.Unlock()
+	stats.CostModel = make(map[string]CostAccuracy, len(s.cost))
+	for library, samples := range s.cost {
+		stats.CostModel[library] = samples.accuracy()
+	}
+	return stats
+}
@@ -0,0 +1,324 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"procesador-consultas/limits"
+	"procesador-consultas/optimizer"
+	"procesador-consultas/queryerr"
+)
+
+// Pruebas diferenciales del optimizador: comparan la ejecución sin optimizar
+// (navigateJSON y navigateFastJSON, a través de las consultas originales del motor)
+// con los planes del optimizador en cada OptimizationLevel y con un pipeline de pases
+// configurable (por defecto, todos los pases repetidos hasta un punto fijo), sobre
+// documentos y consultas aleatorios.
+//
+// Para cada caso verifican, por configuración y por librería, que el optimizador no
+// falle, que el plan recorra exactamente la ruta de la consulta, que su ejecución
+// interpretada coincida con la compilada y que el resultado (valor, encontrado, error
+// y claves reportadas) coincida con el del motor sin optimizar, tanto con un plan
+// recién creado como con el plan reutilizado del pool.
+//
+// Uso:
+//
+//	go test ./engine -run TestOptimizerMatchesReference -args -plancheck.n 5000 -plancheck.seed 42 \
+//		[-plancheck.plan-cache shape] [-plancheck.passes step_combination,memoization -plancheck.iterations 3]
+var (
+	plancheckCases      = flag.Int("plancheck.n", 2000, "número de casos de las pruebas diferenciales; -short usa 200")
+	plancheckSeed       = flag.Int64("plancheck.seed", 1, "semilla del generador de las pruebas diferenciales")
+	plancheckDepth      = flag.Int("plancheck.depth", 4, "profundidad máxima de los documentos generados")
+	plancheckPolicy     = flag.String("plancheck.plan-cache", "", "política del cache de planes (query o shape); vacío prueba ambas")
+	plancheckPasses     = flag.String("plancheck.passes", "redundant_elimination,step_combination,step_reordering,memoization", "pases del pipeline comparado, separados por comas; -nombre lo deshabilita")
+	plancheckIterations = flag.Int("plancheck.iterations", 4, "iteraciones máximas del pipeline comparado")
+)
+
+// levels son los niveles de optimización que se comparan
+var levels = []int{0, 1, 2}
+
+// variant es una configuración del optimizador que se compara
+type variant struct {
+	name   string
+	config func() *optimizer.OptimizationConfig
+}
+
+// keyPool contiene claves que provocan los casos delicados: claves repetidas (a.a),
+// claves numéricas en objetos, índices con ceros a la izquierda, puntos y espacios
+var keyPool = []string{"a", "b", "c", "0", "1", "2", "01", "a.b", "x y", "ñ", ""}
+
+// generator crea documentos y consultas aleatorios
+type generator struct {
+	rng *rand.Rand
+}
+
+// document crea un valor JSON aleatorio de hasta depth niveles
+func (g *generator) document(depth int) interface{} {
+	if depth == 0 || g.rng.Intn(5) == 0 {
+		switch g.rng.Intn(4) {
+		case 0:
+			return float64(g.rng.Intn(100))
+		case 1:
+			return keyPool[g.rng.Intn(len(keyPool))]
+		case 2:
+			return g.rng.Intn(2) == 0
+		default:
+			return nil
+		}
+	}
+
+	if g.rng.Intn(2) == 0 {
+		items := make([]interface{}, g.rng.Intn(4))
+		for i := range items {
+			items[i] = g.document(depth - 1)
+		}
+		return items
+	}
+
+	object := map[string]interface{}{}
+	for i := g.rng.Intn(4); i >= 0; i-- {
+		object[keyPool[g.rng.Intn(len(keyPool))]] = g.document(depth - 1)
+	}
+	return object
+}
+
+// query recorre el documento al azar y altera algunos segmentos para que también
+// haya rutas inexistentes, índices fuera de rango y accesos sobre escalares
+func (g *generator) query(document interface{}) []string {
+	length := 1 + g.rng.Intn(5)
+	keys := make([]string, 0, length)
+	current := document
+
+	for len(keys) < length {
+		var key string
+		switch v := current.(type) {
+		case map[string]interface{}:
+			for candidate := range v {
+				key = candidate
+				if g.rng.Intn(2) == 0 {
+					break
+				}
+			}
+		case []interface{}:
+			key = strconv.Itoa(g.rng.Intn(len(v) + 1))
+		}
+
+		switch {
+		case key == "" || g.rng.Intn(6) == 0:
+			key = keyPool[g.rng.Intn(len(keyPool))]
+		case len(keys) > 0 && g.rng.Intn(8) == 0:
+			key = keys[len(keys)-1] // segmento repetido
+		}
+		keys = append(keys, key)
+
+		switch v := current.(type) {
+		case map[string]interface{}:
+			current = v[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				current = nil
+			} else {
+				current = v[index]
+			}
+		default:
+			current = nil
+		}
+	}
+	return keys
+}
+
+// outcome es la parte comparable de un resultado
+type outcome struct {
+	Found     bool
+	Value     interface{}
+	Keys      []string
+	ErrorCode string
+	Error     string
+	Segment   *int
+	Reason    string
+}
+
+// outcomeOf extrae la parte comparable de un resultado
+func outcomeOf(result QueryResult) outcome {
+	o := outcome{
+		Found:     result.Found,
+		Value:     result.Value,
+		Keys:      result.Keys,
+		ErrorCode: string(result.ErrorCode),
+		Error:     result.Error,
+	}
+	if result.Err != nil {
+		queryErr := queryerr.From(result.Err)
+		o.Segment = queryErr.Segment
+		if queryErr.Diagnostic != nil {
+			o.Reason = queryErr.Diagnostic.Reason
+		}
+	}
+	return o
+}
+
+// checker ejecuta un caso en todas las variantes y librerías
+type checker struct {
+	reference *Engine
+	variants  []variant
+}
+
+// original ejecuta la consulta sin optimizar con la librería indicada
+func (c *checker) original(ctx context.Context, jsonStr string, keys []string, library string) QueryResult {
+	switch library {
+	case "json-iterator":
+		return c.reference.QueryWithJsonIterator(ctx, jsonStr, keys)
+	case "fastjson":
+		return c.reference.QueryWithFastJSON(ctx, jsonStr, keys)
+	default:
+		return c.reference.QueryWithStandardLibrary(ctx, jsonStr, keys)
+	}
+}
+
+// newVariants crea una variante por nivel y otra con el pipeline indicado, con la
+// política del cache de planes indicada
+func newVariants(policy optimizer.PlanCachePolicy, pipeline optimizer.Pipeline) []variant {
+	var variants []variant
+	for _, level := range levels {
+		level := level
+		variants = append(variants, variant{
+			name:   fmt.Sprintf("nivel %d", level),
+			config: func() *optimizer.OptimizationConfig { return newConfig(level, policy) },
+		})
+	}
+	variants = append(variants, variant{
+		name: fmt.Sprintf("pipeline %v", pipeline.Passes),
+		config: func() *optimizer.OptimizationConfig {
+			config := newConfig(0, policy)
+			config.Pipeline = &pipeline
+			return config
+		},
+	})
+	return variants
+}
+
+// newConfig crea la configuración del optimizador para un nivel
+func newConfig(level int, policy optimizer.PlanCachePolicy) *optimizer.OptimizationConfig {
+	return &optimizer.OptimizationConfig{
+		EnableCache:       true,
+		EnableMemoization: true,
+		MaxCacheSize:      1000,
+		OptimizationLevel: level,
+		Limits:            limits.Default(),
+		PlanCache:         policy,
+	}
+}
+
+// check retorna la primera diferencia encontrada para el caso, o "" si no hay
+func (c *checker) check(document interface{}, keys []string) string {
+	ctx := context.Background()
+	encoded, _ := json.Marshal(document)
+	jsonStr := string(encoded)
+
+	for _, v := range c.variants {
+		// El plan debe recorrer exactamente la ruta de la consulta
+		plan, err := optimizer.NewOptimizer(v.config()).OptimizeQuery(ctx, keys, document)
+		if err != nil {
+			return fmt.Sprintf("%s: el optimizador falló: %v", v.name, err)
+		}
+		if !reflect.DeepEqual(plan.Path(), keys) {
+			return fmt.Sprintf("%s: el plan recorre %q en lugar de %q (%s)", v.name, plan.Path(), keys, describePlan(plan))
+		}
+
+		// Motor nuevo por caso: la primera ejecución crea el plan y la segunda usa el pool
+		optimized := NewOptimizedEngineWithConfig(limits.Default(), v.config())
+
+		// La ejecución interpretada y la compilada del plan deben coincidir
+		interpreted, interpretedFailed, _ := interpretPlan(ctx, plan, document)
+		compiled, compiledFailed, _ := CompilePlan(plan).Run(ctx, document)
+		if interpretedFailed != compiledFailed || !reflect.DeepEqual(interpreted, compiled) {
+			return fmt.Sprintf("%s: interpretado %v (falla %d), compilado %v (falla %d) (%s)",
+				v.name, interpreted, interpretedFailed, compiled, compiledFailed, describePlan(plan))
+		}
+		for _, library := range Libraries {
+			want := outcomeOf(c.original(ctx, jsonStr, keys, library))
+			for _, run := range []string{"plan nuevo", "plan del pool"} {
+				got := outcomeOf(optimized.QueryWithOptimization(ctx, jsonStr, keys, library))
+				if !reflect.DeepEqual(got, want) {
+					return fmt.Sprintf("%s, %s, %s: se obtuvo %+v, se esperaba %+v (%s)",
+						v.name, library, run, got, want, describePlan(plan))
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// describePlan resume los pasos de un plan
+func describePlan(plan *optimizer.QueryPlan) string {
+	steps := make([]string, len(plan.Steps))
+	for i, step := range plan.Steps {
+		steps[i] = fmt.Sprintf("%s%q", step.Type, step.Keys)
+	}
+	return "plan: " + strings.Join(steps, " → ")
+}
+
+// shrink reduce la consulta mientras siga fallando: quita segmentos de uno en uno
+func (c *checker) shrink(document interface{}, keys []string) []string {
+	for changed := true; changed; {
+		changed = false
+		for i := range keys {
+			candidate := append(append([]string{}, keys[:i]...), keys[i+1:]...)
+			if len(candidate) > 0 && c.check(document, candidate) != "" {
+				keys, changed = candidate, true
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// TestOptimizerMatchesReference ejecuta las pruebas diferenciales con una semilla
+// fija y muestra el caso mínimo encontrado si algo difiere
+func TestOptimizerMatchesReference(t *testing.T) {
+	pipeline, err := optimizer.ParsePipeline(*plancheckPasses, *plancheckIterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies := []optimizer.PlanCachePolicy{optimizer.PlanCacheByQuery, optimizer.PlanCacheByShape}
+	if *plancheckPolicy != "" {
+		policy, err := optimizer.ParsePlanCachePolicy(*plancheckPolicy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policies = []optimizer.PlanCachePolicy{policy}
+	}
+
+	n := *plancheckCases
+	if testing.Short() && n > 200 {
+		n = 200
+	}
+
+	for _, policy := range policies {
+		t.Run(string(policy), func(t *testing.T) {
+			g := &generator{rng: rand.New(rand.NewSource(*plancheckSeed))}
+			c := &checker{reference: NewEngine(), variants: newVariants(policy, pipeline)}
+
+			for i := 0; i < n; i++ {
+				document := g.document(*plancheckDepth)
+				keys := g.query(document)
+
+				if failure := c.check(document, keys); failure != "" {
+					keys = c.shrink(document, keys)
+					encoded, _ := json.Marshal(document)
+					t.Fatalf("diferencia en el caso %d (semilla %d)\ndocumento: %s\nconsulta:  %q\n%s",
+						i, *plancheckSeed, encoded, keys, c.check(document, keys))
+				}
+			}
+		})
+	}
+}
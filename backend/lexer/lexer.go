@@ -1,7 +1,10 @@
 package lexer
 
 import (
+	"encoding/json"
+	"fmt"
 	"unicode"
+	"unicode/utf8"
 )
 
 // TokenType representa el tipo de token
@@ -13,64 +16,123 @@ const (
 	TOKEN_NUMBER
 	TOKEN_EOF
 	TOKEN_ERROR
+	TOKEN_STRING
+	TOKEN_LBRACKET
+	TOKEN_RBRACKET
 )
 
-// Token representa un token léxico
+// tokenNames son los nombres estables de los tipos de token en el formato de
+// intercambio; no cambian aunque se agreguen tipos nuevos
+var tokenNames = map[TokenType]string{
+	TOKEN_IDENTIFIER: "identifier",
+	TOKEN_DOT:        "dot",
+	TOKEN_NUMBER:     "number",
+	TOKEN_EOF:        "eof",
+	TOKEN_ERROR:      "error",
+	TOKEN_STRING:     "string",
+	TOKEN_LBRACKET:   "lbracket",
+	TOKEN_RBRACKET:   "rbracket",
+}
+
+// String retorna el nombre estable del tipo de token
+func (t TokenType) String() string {
+	if name, ok := tokenNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
+// MarshalText serializa el tipo de token con su nombre estable
+func (t TokenType) MarshalText() ([]byte, error) {
+	name, ok := tokenNames[t]
+	if !ok {
+		return nil, fmt.Errorf("tipo de token desconocido: %d", int(t))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText obtiene el tipo de token a partir de su nombre estable
+func (t *TokenType) UnmarshalText(text []byte) error {
+	for tokenType, name := range tokenNames {
+		if name == string(text) {
+			*t = tokenType
+			return nil
+		}
+	}
+	return fmt.Errorf("tipo de token desconocido: %q", text)
+}
+
+// Token representa un token léxico.
+// Line y Column empiezan en 1 y la columna se cuenta en runas (caracteres), no en
+// bytes; Offset es la posición en bytes dentro de la consulta.
 type Token struct {
 	Type    TokenType
 	Literal string
 	Line    int
 	Column  int
+	Offset  int
+	Message string // motivo del error, solo en tokens TOKEN_ERROR
 }
 
-// Lexer representa el analizador léxico
+// eof marca el final de la entrada (distinto de un carácter NUL en la consulta)
+const eof rune = -1
+
+// Lexer representa el analizador léxico. Decodifica la entrada como UTF-8.
+//
+// Regla de identificadores: un identificador empieza con una letra Unicode
+// (categoría L) o '_', y continúa con letras, dígitos decimales Unicode
+// (categoría Nd), marcas combinantes (categorías Mn y Mc, p. ej. acentos
+// descompuestos) o '_'. Así "año", "número" o "名前" son identificadores válidos.
+// Los números (índices de arreglos) solo admiten dígitos ASCII 0-9.
+//
+// Las claves que no cumplen la regla se escriben entre comillas dobles con los
+// escapes de JSON ("a.b", "con espacio"); el literal del token conserva las
+// comillas y Unquote obtiene la clave.
 type Lexer struct {
 	input        string
-	position     int
-	readPosition int
-	ch           byte
+	position     int  // offset en bytes del carácter actual
+	readPosition int  // offset en bytes del siguiente carácter
+	ch           rune // carácter actual, o eof
+	invalid      bool // el carácter actual es una secuencia UTF-8 inválida
 	line         int
-	column       int
+	column       int // columna del carácter actual, en runas
 }
 
 // NewLexer crea un nuevo analizador léxico
 func NewLexer(input string) *Lexer {
 	l := &Lexer{
-		input:  input,
-		line:   1,
-		column: 1,
+		input: input,
+		line:  1,
 	}
 	l.readChar()
 	return l
 }
 
-// readChar lee el siguiente carácter
+// readChar decodifica el siguiente carácter y actualiza línea y columna
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0 // EOF
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
 	}
-	l.position = l.readPosition
-	l.readPosition++
-	l.column++
-}
 
-// peekChar mira el siguiente carácter sin avanzar
-func (l *Lexer) peekChar() byte {
+	l.position = l.readPosition
 	if l.readPosition >= len(l.input) {
-		return 0
+		l.ch = eof
+		l.invalid = false
+		l.column++
+		return
 	}
-	return l.input[l.readPosition]
+
+	r, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = r
+	l.invalid = r == utf8.RuneError && size == 1
+	l.readPosition += size
+	l.column++
 }
 
 // skipWhitespace salta espacios en blanco
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
-		if l.ch == '\n' {
-			l.line++
-			l.column = 0
-		}
 		l.readChar()
 	}
 }
@@ -78,12 +140,51 @@ func (l *Lexer) skipWhitespace() {
 // readIdentifier lee un identificador
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) || isDigit(l.ch) || l.ch == '_' {
+	for !l.invalid && isIdentifierPart(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
+// readString lee una clave entre comillas. Si la cadena no se cierra o no es una
+// cadena JSON válida, el token se convierte en TOKEN_ERROR con el motivo.
+func (l *Lexer) readString(tok *Token) {
+	position := l.position
+	l.readChar()
+	for l.ch != '"' {
+		if l.ch == eof {
+			tok.Type = TOKEN_ERROR
+			tok.Literal = l.input[position:]
+			tok.Message = "cadena sin cerrar"
+			return
+		}
+		if l.ch == '\\' {
+			l.readChar()
+			if l.ch == eof {
+				continue
+			}
+		}
+		l.readChar()
+	}
+	l.readChar()
+
+	tok.Literal = l.input[position:l.position]
+	tok.Type = TOKEN_STRING
+	if _, err := Unquote(tok.Literal); err != nil {
+		tok.Type = TOKEN_ERROR
+		tok.Message = fmt.Sprintf("cadena inválida %s", tok.Literal)
+	}
+}
+
+// Unquote decodifica el literal de un token TOKEN_STRING con las reglas de JSON
+func Unquote(literal string) (string, error) {
+	var value string
+	if err := json.Unmarshal([]byte(literal), &value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
 // readNumber lee un número
 func (l *Lexer) readNumber() string {
 	position := l.position
@@ -93,50 +194,85 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
-// isLetter verifica si el carácter es una letra
-func isLetter(ch byte) bool {
-	return unicode.IsLetter(rune(ch)) || ch == '_'
+// isLetter verifica si el carácter puede iniciar un identificador
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-// isDigit verifica si el carácter es un dígito
-func isDigit(ch byte) bool {
-	return unicode.IsDigit(rune(ch))
+// isIdentifierPart verifica si el carácter puede continuar un identificador
+func isIdentifierPart(ch rune) bool {
+	return isLetter(ch) || unicode.Is(unicode.Nd, ch) || unicode.In(ch, unicode.Mn, unicode.Mc)
+}
+
+// IsIdentifier indica si una clave puede escribirse sin comillas en una consulta
+func IsIdentifier(key string) bool {
+	if key == "" || !utf8.ValidString(key) {
+		return false
+	}
+	for i, ch := range key {
+		if i == 0 && !isLetter(ch) || !isIdentifierPart(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+// isDigit verifica si el carácter es un dígito ASCII
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
 }
 
 // NextToken retorna el siguiente token
 func (l *Lexer) NextToken() Token {
-	var tok Token
-
 	l.skipWhitespace()
 
-	switch l.ch {
-	case '.':
-		tok = Token{Type: TOKEN_DOT, Literal: string(l.ch), Line: l.line, Column: l.column}
-	case 0:
-		tok.Literal = ""
+	tok := Token{Line: l.line, Column: l.column, Offset: l.position}
+
+	switch {
+	case l.ch == eof:
 		tok.Type = TOKEN_EOF
+		return tok
+	case l.invalid:
+		tok.Type = TOKEN_ERROR
+		tok.Literal = l.input[l.position:l.readPosition]
+		tok.Message = fmt.Sprintf("secuencia UTF-8 inválida %q", tok.Literal)
+	case l.ch == '.':
+		tok.Type = TOKEN_DOT
+		tok.Literal = "."
+	case l.ch == '[':
+		tok.Type = TOKEN_LBRACKET
+		tok.Literal = "["
+	case l.ch == ']':
+		tok.Type = TOKEN_RBRACKET
+		tok.Literal = "]"
+	case l.ch == '"':
+		l.readString(&tok)
+		return tok
+	case isLetter(l.ch):
+		tok.Type = TOKEN_IDENTIFIER
+		tok.Literal = l.readIdentifier()
+		return tok
+	case isDigit(l.ch):
+		tok.Type = TOKEN_NUMBER
+		tok.Literal = l.readNumber()
+		return tok
 	default:
-		if isLetter(l.ch) {
-			tok.Literal = l.readIdentifier()
-			tok.Type = TOKEN_IDENTIFIER
-			tok.Line = l.line
-			tok.Column = l.column
-			return tok
-		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = TOKEN_NUMBER
-			tok.Line = l.line
-			tok.Column = l.column
-			return tok
-		} else {
-			tok = Token{Type: TOKEN_ERROR, Literal: string(l.ch), Line: l.line, Column: l.column}
-		}
+		tok.Type = TOKEN_ERROR
+		tok.Literal = string(l.ch)
+		tok.Message = fmt.Sprintf("carácter inesperado %q", l.ch)
 	}
 
 	l.readChar()
 	return tok
 }
 
+// Slice retorna el fragmento de la entrada entre dos offsets en bytes
+func (l *Lexer) Slice(start, end int) string {
+	start = max(0, min(start, len(l.input)))
+	end = max(start, min(end, len(l.input)))
+	return l.input[start:end]
+}
+
 // Tokenize tokeniza toda la entrada
 func (l *Lexer) Tokenize() []Token {
 	var tokens []Token
@@ -0,0 +1,120 @@
+package lexer
+
+import (
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// Expresiones de la regla de identificadores documentada en lexer.Lexer
+var (
+	identifierPattern = regexp.MustCompile(`^[\p{L}_][\p{L}\p{Nd}\p{Mn}\p{Mc}_]*`)
+	numberPattern     = regexp.MustCompile(`^[0-9]+`)
+	stringPattern     = regexp.MustCompile(`^"(?s:[^"\\]|\\.)*"`)
+	validString       = regexp.MustCompile(`^"(?:[^"\\\x00-\x1f]|\\["\\/bfnrt]|\\u[0-9a-fA-F]{4})*"$`)
+)
+
+// alphabet contiene fragmentos que se combinan para generar el corpus inicial
+var alphabet = []string{
+	"a", "Z", "_", "x1", ".", "..", "0", "42", " ", "\t", "\n", "\r\n",
+	"ñ", "año", "número", "名前", "é", "é", "́", "٣", "Ω", "🙂",
+	"$", "#", "[", "]", "\"", "\x00", "\xff", "\xc3", "\xe5\x90", "-",
+	"\\", "\\\"", "\"a.b\"", "\\u00f1", "\\n", "\\x", "[0]", "[\"k\"]", "<&>",
+}
+
+// seedCorpus retorna los fragmentos del alfabeto y combinaciones de ellos generadas
+// con una semilla fija
+func seedCorpus() []string {
+	corpus := append([]string{}, alphabet...)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		var b strings.Builder
+		for n := rng.Intn(13); n > 0; n-- {
+			b.WriteString(alphabet[rng.Intn(len(alphabet))])
+		}
+		corpus = append(corpus, b.String())
+	}
+	return corpus
+}
+
+// FuzzLexer compara el lexer con un tokenizador de referencia basado en expresiones
+// regulares: tipo, literal y posición de cada token, con UTF-8 válido e inválido.
+// Sin -fuzz ejecuta solo el corpus inicial.
+//
+//	go test ./lexer -fuzz FuzzLexer -fuzztime 30s
+func FuzzLexer(f *testing.F) {
+	for _, input := range seedCorpus() {
+		f.Add(input)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		got := NewLexer(input).Tokenize()
+		for i := range got {
+			got[i].Message = ""
+		}
+		if want := reference(input); !reflect.DeepEqual(got, want) {
+			t.Fatalf("entrada %q\n  lexer:      %+v\n  referencia: %+v", input, got, want)
+		}
+	})
+}
+
+// reference tokeniza con expresiones regulares y cuenta líneas y columnas en runas
+func reference(input string) []Token {
+	var tokens []Token
+	line, column, offset := 1, 1, 0
+
+	advance := func(text string) {
+		for _, ch := range text {
+			if ch == '\n' {
+				line++
+				column = 1
+				continue
+			}
+			column++
+		}
+		offset += len(text)
+	}
+
+	for {
+		rest := input[offset:]
+		trimmed := strings.TrimLeft(rest, " \t\r\n")
+		advance(rest[:len(rest)-len(trimmed)])
+
+		tok := Token{Line: line, Column: column, Offset: offset}
+		if trimmed == "" {
+			tok.Type = TOKEN_EOF
+			return append(tokens, tok)
+		}
+
+		r, size := utf8.DecodeRuneInString(trimmed)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			tok.Type, tok.Literal = TOKEN_ERROR, trimmed[:1]
+		case r == '.':
+			tok.Type, tok.Literal = TOKEN_DOT, "."
+		case r == '[':
+			tok.Type, tok.Literal = TOKEN_LBRACKET, "["
+		case r == ']':
+			tok.Type, tok.Literal = TOKEN_RBRACKET, "]"
+		case r == '"':
+			tok.Type, tok.Literal = TOKEN_ERROR, stringPattern.FindString(trimmed)
+			if tok.Literal == "" {
+				tok.Literal = trimmed
+			} else if validString.MatchString(tok.Literal) {
+				tok.Type = TOKEN_STRING
+			}
+		case identifierPattern.MatchString(trimmed):
+			tok.Type, tok.Literal = TOKEN_IDENTIFIER, identifierPattern.FindString(trimmed)
+		case numberPattern.MatchString(trimmed):
+			tok.Type, tok.Literal = TOKEN_NUMBER, numberPattern.FindString(trimmed)
+		default:
+			tok.Type, tok.Literal = TOKEN_ERROR, trimmed[:size]
+		}
+
+		tokens = append(tokens, tok)
+		advance(tok.Literal)
+	}
+}
@@ -0,0 +1,324 @@
+package limits
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Kind identifica el límite que se excedió
+type Kind string
+
+const (
+	KindBodySize   Kind = "body_size"
+	KindDepth      Kind = "depth"
+	KindNodeCount  Kind = "node_count"
+	KindResultSize Kind = "result_size"
+)
+
+// Config contiene los límites de recursos aplicados a cada consulta.
+// Un valor menor o igual a cero desactiva el límite correspondiente.
+type Config struct {
+	MaxBodyBytes   int64 `json:"max_body_bytes"`
+	MaxDepth       int   `json:"max_depth"`
+	MaxNodes       int   `json:"max_nodes"`
+	MaxResultBytes int   `json:"max_result_bytes"`
+}
+
+// Default retorna los límites por defecto
+func Default() Config {
+	return Config{
+		MaxBodyBytes:   64 << 20,
+		MaxDepth:       512,
+		MaxNodes:       5_000_000,
+		MaxResultBytes: 16 << 20,
+	}
+}
+
+// FromEnv retorna los límites por defecto sobrescritos por las variables de entorno
+// QUERY_MAX_BODY_BYTES, QUERY_MAX_DEPTH, QUERY_MAX_NODES y QUERY_MAX_RESULT_BYTES
+func FromEnv() Config {
+	config := Default()
+
+	if v, ok := envInt("QUERY_MAX_BODY_BYTES"); ok {
+		config.MaxBodyBytes = int64(v)
+	}
+	if v, ok := envInt("QUERY_MAX_DEPTH"); ok {
+		config.MaxDepth = v
+	}
+	if v, ok := envInt("QUERY_MAX_NODES"); ok {
+		config.MaxNodes = v
+	}
+	if v, ok := envInt("QUERY_MAX_RESULT_BYTES"); ok {
+		config.MaxResultBytes = v
+	}
+
+	return config
+}
+
+// envInt lee una variable de entorno entera
+func envInt(name string) (int, bool) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return 0, false
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// Error representa un límite de recursos excedido
+type Error struct {
+	Kind   Kind  `json:"kind"`
+	Limit  int64 `json:"limit"`
+	Actual int64 `json:"actual,omitempty"`
+}
+
+// Error implementa la interfaz error
+func (e *Error) Error() string {
+	switch e.Kind {
+	case KindBodySize:
+		return fmt.Sprintf("el cuerpo de la petición excede el máximo de %d bytes", e.Limit)
+	case KindDepth:
+		return fmt.Sprintf("el JSON excede la profundidad máxima de anidamiento de %d niveles", e.Limit)
+	case KindNodeCount:
+		return fmt.Sprintf("el JSON excede el máximo de %d nodos", e.Limit)
+	case KindResultSize:
+		return fmt.Sprintf("el resultado excede el máximo de %d bytes", e.Limit)
+	default:
+		return fmt.Sprintf("límite %s excedido (%d > %d)", e.Kind, e.Actual, e.Limit)
+	}
+}
+
+// Code retorna el código de error legible por máquina
+func (e *Error) Code() string {
+	return "limit_" + string(e.Kind)
+}
+
+// AsError extrae un error de límite de una cadena de errores
+func AsError(err error) (*Error, bool) {
+	var limitErr *Error
+	if errors.As(err, &limitErr) {
+		return limitErr, true
+	}
+	return nil, false
+}
+
+// CheckDocument verifica el tamaño del JSON y lo recorre sin construirlo para verificar
+// profundidad y número de nodos. Se cuentan como nodos los valores (objetos, arrays y
+// primitivos), no las claves. El JSON mal formado no se reporta aquí: lo detecta después
+// el parser de cada librería.
+func CheckDocument(jsonStr string, config Config) error {
+	if config.MaxBodyBytes > 0 && int64(len(jsonStr)) > config.MaxBodyBytes {
+		return &Error{Kind: KindBodySize, Limit: config.MaxBodyBytes, Actual: int64(len(jsonStr))}
+	}
+	if config.MaxDepth <= 0 && config.MaxNodes <= 0 {
+		return nil
+	}
+
+	var (
+		stack     []bool // true para objetos, false para arrays
+		expectKey bool
+		nodes     int
+	)
+
+	countNode := func() error {
+		nodes++
+		if config.MaxNodes > 0 && nodes > config.MaxNodes {
+			return &Error{Kind: KindNodeCount, Limit: int64(config.MaxNodes), Actual: int64(nodes)}
+		}
+		return nil
+	}
+
+	for i := 0; i < len(jsonStr); i++ {
+		switch ch := jsonStr[i]; ch {
+		case ' ', '\t', '\n', '\r':
+		case '{', '[':
+			if err := countNode(); err != nil {
+				return err
+			}
+			stack = append(stack, ch == '{')
+			if config.MaxDepth > 0 && len(stack) > config.MaxDepth {
+				return &Error{Kind: KindDepth, Limit: int64(config.MaxDepth), Actual: int64(len(stack))}
+			}
+			expectKey = ch == '{'
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			expectKey = false
+		case ',':
+			expectKey = len(stack) > 0 && stack[len(stack)-1]
+		case ':':
+			expectKey = false
+		case '"':
+			// Saltar la cadena respetando los escapes
+			for i++; i < len(jsonStr) && jsonStr[i] != '"'; i++ {
+				if jsonStr[i] == '\\' {
+					i++
+				}
+			}
+			if expectKey {
+				expectKey = false
+				continue
+			}
+			if err := countNode(); err != nil {
+				return err
+			}
+		default:
+			// Número o literal: saltar hasta el siguiente delimitador
+			if err := countNode(); err != nil {
+				return err
+			}
+			for i+1 < len(jsonStr) && !isDelimiter(jsonStr[i+1]) {
+				i++
+			}
+		}
+	}
+
+	return nil
+}
+
+// isDelimiter indica si el byte termina un número o literal
+func isDelimiter(ch byte) bool {
+	switch ch {
+	case ',', ']', '}', ':', ' ', '\t', '\n', '\r', '"', '{', '[':
+		return true
+	}
+	return false
+}
+
+// CheckResult verifica que la serialización del resultado no exceda el tamaño máximo.
+// Calcula el tamaño que tendría con json.Marshal recorriendo el valor sin serializarlo
+// y se detiene al superar el límite, así que su costo no depende del tamaño de un
+// resultado que lo excede; en ese caso Actual es el tamaño contado hasta detenerse.
+func CheckResult(value interface{}, config Config) error {
+	if config.MaxResultBytes <= 0 {
+		return nil
+	}
+
+	counter := resultSize{limit: config.MaxResultBytes}
+	if !counter.add(value) && counter.size > config.MaxResultBytes {
+		return &Error{Kind: KindResultSize, Limit: int64(config.MaxResultBytes), Actual: int64(counter.size)}
+	}
+	return nil
+}
+
+// resultSize cuenta los bytes de la serialización de un valor hasta superar limit
+type resultSize struct {
+	limit   int
+	size    int
+	scratch [64]byte // formato de los números sin reservar memoria
+}
+
+// add suma el tamaño del valor; retorna false si se superó el límite o si el valor
+// no se puede serializar (que no es un problema de límites)
+func (r *resultSize) add(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		r.size += len("null")
+	case bool:
+		if v {
+			r.size += len("true")
+		} else {
+			r.size += len("false")
+		}
+	case string:
+		r.size += stringSize(v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+		r.size += r.floatSize(v)
+	case json.Number:
+		r.size += len(v)
+	case map[string]interface{}:
+		if v == nil {
+			r.size += len("null")
+			break
+		}
+		r.size += len("{}")
+		if len(v) > 1 {
+			r.size += len(v) - 1 // comas
+		}
+		for key, item := range v {
+			r.size += stringSize(key) + len(":")
+			if r.size > r.limit || !r.add(item) {
+				return false
+			}
+		}
+	case []interface{}:
+		if v == nil {
+			r.size += len("null")
+			break
+		}
+		r.size += len("[]")
+		if len(v) > 1 {
+			r.size += len(v) - 1 // comas
+		}
+		for _, item := range v {
+			if r.size > r.limit || !r.add(item) {
+				return false
+			}
+		}
+	default:
+		// Otros tipos (enteros de fastjson, por ejemplo) se serializan
+		data, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		r.size += len(data)
+	}
+	return r.size <= r.limit
+}
+
+// floatSize retorna el tamaño de un número con el formato de encoding/json
+func (r *resultSize) floatSize(f float64) int {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b := strconv.AppendFloat(r.scratch[:0], f, format, -1, 64)
+	if n := len(b); format == 'e' && n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+		return n - 1 // encoding/json escribe e-7 en lugar de e-07
+	}
+	return len(b)
+}
+
+// stringSize retorna el tamaño de una cadena con los escapes de encoding/json,
+// incluidos los de HTML y el reemplazo de cada byte de UTF-8 inválido por U+FFFD
+func stringSize(s string) int {
+	size := len(`""`)
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			switch {
+			case b == '"' || b == '\\' || b == '\b' || b == '\f' || b == '\n' || b == '\r' || b == '\t':
+				size += 2
+			case b < 0x20 || b == '<' || b == '>' || b == '&':
+				size += len(`\u0000`)
+			default:
+				size++
+			}
+			i++
+			continue
+		}
+
+		r, width := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && width == 1:
+			size += utf8.RuneLen(utf8.RuneError)
+		case r == '\u2028' || r == '\u2029':
+			size += len(`\u0000`)
+		default:
+			size += width
+		}
+		i += width
+	}
+	return size
+}
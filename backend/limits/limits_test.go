@@ -0,0 +1,57 @@
+package limits
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestCheckResultSize verifica que el tamaño calculado sin serializar coincida con el
+// de json.Marshal, incluidos los escapes de cadenas y el formato de los números
+func TestCheckResultSize(t *testing.T) {
+	values := []interface{}{
+		nil, true, false, "", "texto", "comillas \" y \\ barra", "\b\f\n\r\t\x00\x1f",
+		"<a href=\"x\">&</a>", "año 名前 🙂", "inválido \xff\xc3", "separadores   ",
+		0.0, 1.0, -1.5, 42.0, 1e20, 1e21, 1e-6, 1e-7, 123456789.123, -2.5e-300, json.Number("12.50"),
+		map[string]interface{}{}, []interface{}{}, map[string]interface{}(nil), []interface{}(nil),
+		map[string]interface{}{"a": 1.0, "<b>": []interface{}{"x", nil, true}, "ñ": map[string]interface{}{"c": "d"}},
+		[]interface{}{1.0, "dos", []interface{}{}, map[string]interface{}{"k": []interface{}{3.0}}},
+		map[string]interface{}{"entero": int64(7)},
+	}
+
+	for _, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counter := resultSize{limit: len(data)}
+		if !counter.add(value) || counter.size != len(data) {
+			t.Errorf("%#v: tamaño %d, json.Marshal produce %d bytes (%s)", value, counter.size, len(data), data)
+		}
+		if err := CheckResult(value, Config{MaxResultBytes: len(data)}); err != nil {
+			t.Errorf("%#v: con el límite exacto se obtuvo %v", value, err)
+		}
+		if err := CheckResult(value, Config{MaxResultBytes: len(data) - 1}); len(data) > 1 && err == nil {
+			t.Errorf("%#v: con un byte menos que %d no se excedió el límite", value, len(data))
+		}
+	}
+}
+
+// TestCheckResultStopsEarly verifica que el recorrido se detenga al superar el límite
+func TestCheckResultStopsEarly(t *testing.T) {
+	items := make([]interface{}, 100000)
+	for i := range items {
+		items[i] = strings.Repeat("x", 100)
+	}
+
+	err := CheckResult(items, Config{MaxResultBytes: 1000})
+	limitErr, ok := AsError(err)
+	if !ok || limitErr.Kind != KindResultSize {
+		t.Fatalf("se esperaba un error de %s, se obtuvo %v", KindResultSize, err)
+	}
+	// Actual es el tamaño contado al detenerse: supera el límite sin llegar al total
+	if total := int64(len("[]") + len(items)*(102+1) - 1); limitErr.Actual <= 1000 || limitErr.Actual >= total {
+		t.Errorf("Actual = %d, se esperaba un valor entre 1000 y %d", limitErr.Actual, total)
+	}
+}
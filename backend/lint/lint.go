@@ -0,0 +1,216 @@
+package lint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"procesador-consultas/parser"
+	"procesador-consultas/queryerr"
+	"procesador-consultas/schema"
+	"procesador-consultas/suggest"
+)
+
+// Severity indica la gravedad de un diagnóstico
+type Severity string
+
+const (
+	// SeverityError indica que la consulta nunca encontrará un valor
+	SeverityError Severity = "error"
+	// SeverityWarning indica que la consulta probablemente no encuentre el valor
+	SeverityWarning Severity = "warning"
+	// SeverityInfo indica una sugerencia de estilo
+	SeverityInfo Severity = "info"
+)
+
+// Reglas del lint
+const (
+	RuleSyntax           = "syntax"             // la consulta no se puede parsear
+	RuleNonCanonical     = "non_canonical"      // la consulta no está en forma canónica
+	RuleLeadingZeroIndex = "leading_zero_index" // índice con ceros a la izquierda (007)
+	RuleAccessOnScalar   = "access_on_scalar"   // segmento aplicado a un valor sin hijos
+	RuleKeyOnArray       = "key_on_array"       // clave aplicada a un arreglo
+	RuleIndexOnObject    = "index_on_object"    // índice aplicado a un objeto sin esa clave
+	RuleIndexOutOfRange  = "index_out_of_range" // índice mayor que la longitud observada
+	RuleUnknownKey       = "unknown_key"        // clave ausente en el documento
+	RuleOptionalKey      = "optional_key"       // clave ausente en algunos objetos observados
+)
+
+// Diagnostic es un problema encontrado en la consulta
+type Diagnostic struct {
+	Rule        string        `json:"rule"`
+	Severity    Severity      `json:"severity"`
+	Message     string        `json:"message"`
+	Span        queryerr.Span `json:"span"`
+	Segment     *int          `json:"segment,omitempty"`
+	Suggestions []string      `json:"suggestions,omitempty"`
+}
+
+// Result es el resultado de analizar una consulta
+type Result struct {
+	Canonical   string       `json:"canonical,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Lint analiza una consulta sin conocer el documento: solo aplica las reglas de estilo
+func Lint(source string) Result {
+	return lint(source, nil)
+}
+
+// LintWithDocument analiza una consulta contra la estructura inferida de un documento
+// de ejemplo, además de las reglas de estilo
+func LintWithDocument(source string, document interface{}) Result {
+	return lint(source, schema.Infer(document))
+}
+
+// LintWithSchema analiza una consulta contra un esquema inferido (por ejemplo, de
+// varios documentos con schema.Infer), además de las reglas de estilo
+func LintWithSchema(source string, inferred *schema.Schema) Result {
+	return lint(source, inferred)
+}
+
+// lint aplica las reglas de estilo y, si hay esquema, las reglas de tipos
+func lint(source string, root *schema.Schema) Result {
+	result := Result{Diagnostics: []Diagnostic{}}
+
+	query, err := parser.Parse(source)
+	if err != nil {
+		for _, syntax := range queryerr.From(err).Diagnostics {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{
+				Rule:     RuleSyntax,
+				Severity: SeverityError,
+				Message:  syntax.Message,
+				Span:     syntax.Span,
+			})
+		}
+		return result
+	}
+
+	result.Canonical = parser.Format(query)
+	if result.Canonical != source {
+		result.Diagnostics = append(result.Diagnostics, Diagnostic{
+			Rule:        RuleNonCanonical,
+			Severity:    SeverityInfo,
+			Message:     fmt.Sprintf("la forma canónica de la consulta es %s", result.Canonical),
+			Span:        querySpan(query),
+			Suggestions: []string{result.Canonical},
+		})
+	}
+
+	for i, segment := range query.Segments {
+		if isIndex(segment.Key) && len(segment.Key) > 1 && segment.Key[0] == '0' {
+			index, _ := strconv.Atoi(segment.Key)
+			result.Diagnostics = append(result.Diagnostics, newDiagnostic(RuleLeadingZeroIndex, SeverityWarning, i, segment,
+				fmt.Sprintf("el índice %s tiene ceros a la izquierda: en arreglos equivale a %d y en objetos busca la clave %q",
+					segment.Key, index, segment.Key)))
+		}
+	}
+
+	if root != nil {
+		result.Diagnostics = append(result.Diagnostics, checkTypes(query, root)...)
+	}
+
+	return result
+}
+
+// checkTypes recorre la ruta sobre el esquema inferido y se detiene en el primer
+// segmento que no se puede resolver, ya que los siguientes dependen de él
+func checkTypes(query *parser.Query, root *schema.Schema) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	current := root
+	for i, segment := range query.Segments {
+		if current == nil {
+			// Arreglo vacío en el documento: no hay información de sus elementos
+			return diagnostics
+		}
+
+		isObject, isArray := current.Has(schema.TypeObject), current.Has(schema.TypeArray)
+
+		if !isObject && !isArray {
+			return append(diagnostics, newDiagnostic(RuleAccessOnScalar, SeverityError, i, segment,
+				fmt.Sprintf("el segmento %q se aplica a un valor de tipo %s, que no tiene claves ni índices",
+					segment.Key, strings.Join(current.TypeNames(), "|"))))
+		}
+
+		if child, exists := current.Properties[segment.Key]; isObject && exists {
+			if !current.IsRequired(segment.Key) {
+				diagnostics = append(diagnostics, newDiagnostic(RuleOptionalKey, SeverityInfo, i, segment,
+					fmt.Sprintf("la clave %q aparece en %d de %d objetos observados", segment.Key, child.Count, current.Types[schema.TypeObject])))
+			}
+			current = child
+			continue
+		}
+
+		if isIndex(segment.Key) {
+			if !isArray {
+				return append(diagnostics, newDiagnostic(RuleIndexOnObject, SeverityWarning, i, segment,
+					fmt.Sprintf("se usa el índice %s sobre un objeto que no tiene la clave %q", segment.Key, segment.Key)))
+			}
+
+			maxItems := 0
+			if current.ItemCount != nil {
+				maxItems = current.ItemCount.Max
+			}
+
+			index, err := strconv.Atoi(segment.Key)
+			if err != nil || index >= maxItems {
+				diagnostic := newDiagnostic(RuleIndexOutOfRange, SeverityWarning, i, segment,
+					fmt.Sprintf("el índice %s supera la longitud observada del arreglo (%d)", segment.Key, maxItems))
+				if maxItems > 0 {
+					diagnostic.Suggestions = []string{strconv.Itoa(maxItems - 1)}
+				}
+				return append(diagnostics, diagnostic)
+			}
+			current = current.Items
+			continue
+		}
+
+		if !isObject {
+			return append(diagnostics, newDiagnostic(RuleKeyOnArray, SeverityError, i, segment,
+				fmt.Sprintf("se usa la clave %q sobre un arreglo; los arreglos solo admiten índices", segment.Key)))
+		}
+
+		diagnostic := newDiagnostic(RuleUnknownKey, SeverityWarning, i, segment,
+			fmt.Sprintf("la clave %q no existe en el documento", segment.Key))
+		diagnostic.Suggestions = suggest.Keys(segment.Key, current.Keys())
+		if len(diagnostic.Suggestions) > 0 {
+			diagnostic.Message = fmt.Sprintf("%s (¿quisiste decir %q?)", diagnostic.Message, diagnostic.Suggestions[0])
+		}
+		return append(diagnostics, diagnostic)
+	}
+
+	return diagnostics
+}
+
+// newDiagnostic crea un diagnóstico ubicado en un segmento de la consulta
+func newDiagnostic(rule string, severity Severity, index int, segment parser.Segment, message string) Diagnostic {
+	return Diagnostic{
+		Rule:     rule,
+		Severity: severity,
+		Message:  message,
+		Span:     segment.Span,
+		Segment:  &index,
+	}
+}
+
+// querySpan retorna el fragmento que ocupa toda la consulta
+func querySpan(query *parser.Query) queryerr.Span {
+	return queryerr.Span{
+		Start: query.Segments[0].Span.Start,
+		End:   query.Segments[len(query.Segments)-1].Span.End,
+	}
+}
+
+// isIndex verifica si la clave está formada solo por dígitos ASCII
+func isIndex(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '0' || key[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package lint
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"procesador-consultas/queryerr"
+	"procesador-consultas/schema"
+)
+
+// document es el documento de ejemplo de las pruebas con documento
+const document = `{
+	"usuario": {"nombre": "Ana", "edad": 30},
+	"items": [{"id": 1, "extra": true}, {"id": 2}],
+	"vacio": [],
+	"niño": {"año": 1}
+}`
+
+// expected es un diagnóstico esperado; el mensaje es texto libre. Las posiciones
+// tienen el offset en bytes y la columna en caracteres.
+type expected struct {
+	rule        string
+	severity    Severity
+	span        queryerr.Span
+	segment     int // -1 si el diagnóstico no corresponde a un segmento
+	suggestions []string
+}
+
+// at construye un fragmento de una línea
+func at(line, startOffset, startColumn, endOffset, endColumn int) queryerr.Span {
+	return queryerr.Span{
+		Start: queryerr.Position{Offset: startOffset, Line: line, Column: startColumn},
+		End:   queryerr.Position{Offset: endOffset, Line: line, Column: endColumn},
+	}
+}
+
+// decode decodifica un documento de prueba
+func decode(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// check compara los diagnósticos con los esperados
+func check(t *testing.T, query string, result Result, want []expected) {
+	t.Helper()
+	if len(result.Diagnostics) != len(want) {
+		t.Fatalf("%q: %d diagnósticos, se esperaban %d: %+v", query, len(result.Diagnostics), len(want), result.Diagnostics)
+	}
+	for i, diagnostic := range result.Diagnostics {
+		w := want[i]
+		segment := -1
+		if diagnostic.Segment != nil {
+			segment = *diagnostic.Segment
+		}
+		if diagnostic.Rule != w.rule || diagnostic.Severity != w.severity || diagnostic.Span != w.span ||
+			segment != w.segment || !sameSuggestions(diagnostic.Suggestions, w.suggestions) {
+			t.Errorf("%q: diagnóstico %d\n  se obtuvo   %s %s %+v segmento %d %q\n  se esperaba %s %s %+v segmento %d %q",
+				query, i, diagnostic.Rule, diagnostic.Severity, diagnostic.Span, segment, diagnostic.Suggestions,
+				w.rule, w.severity, w.span, w.segment, w.suggestions)
+		}
+		if diagnostic.Message == "" {
+			t.Errorf("%q: diagnóstico %s sin mensaje", query, diagnostic.Rule)
+		}
+	}
+}
+
+// sameSuggestions compara las sugerencias; nil y vacío son equivalentes porque
+// ambos se omiten en JSON
+func sameSuggestions(got, want []string) bool {
+	return len(got) == 0 && len(want) == 0 || reflect.DeepEqual(got, want)
+}
+
+// TestLintWithDocument verifica cada regla con su severidad y su posición
+func TestLintWithDocument(t *testing.T) {
+	doc := decode(t, document)
+	cases := []struct {
+		query string
+		want  []expected
+	}{
+		{"usuario.nombre", nil},
+		{"usuario.nombre.x", []expected{{RuleAccessOnScalar, SeverityError, at(1, 15, 16, 16, 17), 2, nil}}},
+		{"items.id", []expected{{RuleKeyOnArray, SeverityError, at(1, 6, 7, 8, 9), 1, nil}}},
+		{"usuario[0]", []expected{{RuleIndexOnObject, SeverityWarning, at(1, 8, 9, 9, 10), 1, nil}}},
+		{"items[5]", []expected{{RuleIndexOutOfRange, SeverityWarning, at(1, 6, 7, 7, 8), 1, []string{"1"}}}},
+		// Sin elementos observados no hay índice que sugerir
+		{"vacio[0]", []expected{{RuleIndexOutOfRange, SeverityWarning, at(1, 6, 7, 7, 8), 1, nil}}},
+		{"usuario.nombr", []expected{{RuleUnknownKey, SeverityWarning, at(1, 8, 9, 13, 14), 1, []string{"nombre"}}}},
+		{"usuario.zzzzzz", []expected{{RuleUnknownKey, SeverityWarning, at(1, 8, 9, 14, 15), 1, nil}}},
+		// Offsets en bytes y columnas en caracteres
+		{"niño.añp", []expected{{RuleUnknownKey, SeverityWarning, at(1, 6, 6, 10, 9), 1, []string{"año"}}}},
+		{"usuario\n.nombr", []expected{
+			{RuleNonCanonical, SeverityInfo, queryerr.Span{Start: queryerr.Position{Offset: 0, Line: 1, Column: 1}, End: queryerr.Position{Offset: 14, Line: 2, Column: 7}}, -1, []string{"usuario.nombr"}},
+			{RuleUnknownKey, SeverityWarning, at(2, 9, 2, 14, 7), 1, []string{"nombre"}},
+		}},
+		{"items[0].extra", []expected{{RuleOptionalKey, SeverityInfo, at(1, 9, 10, 14, 15), 2, nil}}},
+		{"items.007", []expected{
+			{RuleNonCanonical, SeverityInfo, at(1, 0, 1, 9, 10), -1, []string{"items[007]"}},
+			{RuleLeadingZeroIndex, SeverityWarning, at(1, 6, 7, 9, 10), 1, nil},
+			{RuleIndexOutOfRange, SeverityWarning, at(1, 6, 7, 9, 10), 1, []string{"1"}},
+		}},
+		// El recorrido se detiene en el primer segmento que no se resuelve
+		{"usuario.falta.x.y", []expected{{RuleUnknownKey, SeverityWarning, at(1, 8, 9, 13, 14), 1, nil}}},
+		{"a..b", []expected{{RuleSyntax, SeverityError, at(1, 2, 3, 3, 4), -1, nil}}},
+	}
+
+	for _, tc := range cases {
+		check(t, tc.query, LintWithDocument(tc.query, doc), tc.want)
+	}
+}
+
+// TestLint verifica que sin documento solo se apliquen las reglas de estilo
+func TestLint(t *testing.T) {
+	cases := []struct {
+		query     string
+		canonical string
+		want      []expected
+	}{
+		{"usuario.nombre.x", "usuario.nombre.x", nil},
+		{"usuario . nombre", "usuario.nombre", []expected{{RuleNonCanonical, SeverityInfo, at(1, 0, 1, 16, 17), -1, []string{"usuario.nombre"}}}},
+		{"a[01]", "a[01]", []expected{{RuleLeadingZeroIndex, SeverityWarning, at(1, 2, 3, 4, 5), 1, nil}}},
+		{"a..b", "", []expected{{RuleSyntax, SeverityError, at(1, 2, 3, 3, 4), -1, nil}}},
+	}
+
+	for _, tc := range cases {
+		result := Lint(tc.query)
+		if result.Canonical != tc.canonical {
+			t.Errorf("%q: forma canónica %q, se esperaba %q", tc.query, result.Canonical, tc.canonical)
+		}
+		check(t, tc.query, result, tc.want)
+	}
+}
+
+// TestLintWithSchema verifica las reglas contra un esquema inferido de varias muestras
+func TestLintWithSchema(t *testing.T) {
+	inferred := schema.Infer(decode(t, `{"id": 1, "nota": "x"}`), decode(t, `{"id": 2}`), decode(t, `{"id": 3}`))
+
+	result := LintWithSchema("nota", inferred)
+	check(t, "nota", result, []expected{{RuleOptionalKey, SeverityInfo, at(1, 0, 1, 4, 5), 0, nil}})
+	if want := `la clave "nota" aparece en 1 de 3 objetos observados`; result.Diagnostics[0].Message != want {
+		t.Errorf("mensaje %q, se esperaba %q", result.Diagnostics[0].Message, want)
+	}
+
+	check(t, "id", LintWithSchema("id", inferred), nil)
+}
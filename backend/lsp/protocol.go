@@ -0,0 +1,132 @@
+package lsp
+
+// Tipos del protocolo LSP que usa el servidor. Las posiciones cuentan líneas desde 0
+// y caracteres en unidades UTF-16, como exige el protocolo.
+
+// Position es una posición en un documento
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range es un rango de un documento; End es exclusivo
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// TextDocumentItem es un documento abierto en el editor
+type TextDocumentItem struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+// TextDocumentIdentifier identifica un documento
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// TextDocumentPositionParams son los parámetros de completion y hover
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// DidOpenParams son los parámetros de textDocument/didOpen
+type DidOpenParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// VersionedTextDocumentIdentifier identifica una versión de un documento
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+// DidChangeParams son los parámetros de textDocument/didChange (sincronización completa)
+type DidChangeParams struct {
+	TextDocument   VersionedTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// DidCloseParams son los parámetros de textDocument/didClose
+type DidCloseParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// FormattingParams son los parámetros de textDocument/formatting
+type FormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// InitializeParams son los parámetros de initialize que usa el servidor
+type InitializeParams struct {
+	InitializationOptions *struct {
+		// Sample es la ruta de un documento JSON de ejemplo para completion, hover y lint
+		Sample string `json:"sample"`
+	} `json:"initializationOptions,omitempty"`
+}
+
+// Severidades de los diagnósticos
+const (
+	SeverityError       = 1
+	SeverityWarning     = 2
+	SeverityInformation = 3
+)
+
+// Diagnostic es un problema que se muestra en el editor
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Code     string `json:"code,omitempty"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// PublishDiagnosticsParams son los parámetros de textDocument/publishDiagnostics
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     int          `json:"version"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Tipos de elemento de completion
+const (
+	CompletionKindField = 5
+	CompletionKindValue = 12
+)
+
+// TextEdit reemplaza un rango por un texto
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// CompletionItem es un candidato de completion
+type CompletionItem struct {
+	Label    string    `json:"label"`
+	Kind     int       `json:"kind"`
+	Detail   string    `json:"detail,omitempty"`
+	TextEdit *TextEdit `json:"textEdit,omitempty"`
+}
+
+// CompletionList es el resultado de textDocument/completion
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+// MarkupContent es texto con formato
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Hover es el resultado de textDocument/hover
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
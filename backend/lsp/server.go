@@ -0,0 +1,491 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"procesador-consultas/completion"
+	"procesador-consultas/limits"
+	"procesador-consultas/lint"
+	"procesador-consultas/parser"
+	"procesador-consultas/schema"
+)
+
+// source identifica los diagnósticos del servidor en el editor
+const source = "procesador-consultas"
+
+// ErrExitWithoutShutdown indica que el cliente envió exit sin shutdown previo
+var ErrExitWithoutShutdown = errors.New("exit recibido sin shutdown")
+
+// Options configura el servidor
+type Options struct {
+	// Sample es el documento de ejemplo (decodificado con encoding/json) contra el que
+	// se completan, describen y verifican las consultas; nil desactiva esas funciones.
+	// initializationOptions.sample lo reemplaza al inicializar.
+	Sample interface{}
+}
+
+// server mantiene el estado de una sesión
+type server struct {
+	out         *writer
+	sample      interface{}
+	inferred    *schema.Schema
+	documents   map[string]*TextDocumentItem
+	initialized bool
+	shutdown    bool
+}
+
+// Serve atiende una sesión LSP sobre r y w hasta recibir exit, que termine la
+// entrada o que se cancele el contexto.
+//
+// Cada línea no vacía del documento que no empiece con # es una consulta. El
+// servidor publica los diagnósticos del lint al abrir o cambiar un documento y
+// responde completion, hover y formatting. Los mensajes se procesan en orden.
+func Serve(ctx context.Context, r io.Reader, w io.Writer, options Options) error {
+	s := &server{out: &writer{w: w}, documents: map[string]*TextDocumentItem{}}
+	s.setSample(options.Sample)
+
+	type incoming struct {
+		msg *message
+		err error
+	}
+	messages := make(chan incoming)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		in := newReader(r)
+		for {
+			msg, err := in.read()
+			select {
+			case messages <- incoming{msg, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case next := <-messages:
+			if next.err == io.EOF {
+				return nil
+			}
+			if next.err != nil {
+				return next.err
+			}
+			if next.msg.Method == "exit" {
+				if !s.shutdown {
+					return ErrExitWithoutShutdown
+				}
+				return nil
+			}
+			if err := s.handle(next.msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// setSample reemplaza el documento de ejemplo y su estructura inferida
+func (s *server) setSample(sample interface{}) {
+	s.sample = sample
+	s.inferred = nil
+	if sample != nil {
+		s.inferred = schema.Infer(sample)
+	}
+}
+
+// handle despacha un mensaje y escribe la respuesta si es una petición
+func (s *server) handle(msg *message) error {
+	if msg.Error != nil && msg.Method == "" {
+		// JSON inválido: no hay id al que responder
+		return s.out.write(&message{ID: json.RawMessage("null"), Error: msg.Error})
+	}
+	if msg.Method == "" {
+		// Respuestas del cliente: el servidor no envía peticiones
+		return nil
+	}
+
+	result, rpcErr := s.dispatch(msg)
+	if msg.isNotification() {
+		return nil
+	}
+
+	response := &message{ID: msg.ID, Error: rpcErr}
+	if rpcErr == nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		response.Result = encoded
+	}
+	return s.out.write(response)
+}
+
+// dispatch ejecuta el método pedido
+func (s *server) dispatch(msg *message) (interface{}, *responseError) {
+	if !s.initialized && msg.Method != "initialize" {
+		return nil, &responseError{Code: codeServerNotInitialized, Message: "el servidor no está inicializado"}
+	}
+	if s.shutdown && msg.Method != "shutdown" {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "el servidor se está cerrando"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.initialize(params)
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		document := params.TextDocument
+		s.documents[document.URI] = &document
+		return nil, s.publishDiagnostics(&document)
+	case "textDocument/didChange":
+		var params DidChangeParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		document, ok := s.documents[params.TextDocument.URI]
+		if !ok || len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// Sincronización completa: el último cambio es el texto entero
+		document.Text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		document.Version = params.TextDocument.Version
+		return nil, s.publishDiagnostics(document)
+	case "textDocument/didClose":
+		var params DidCloseParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI: params.TextDocument.URI, Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(params), nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+	case "textDocument/formatting":
+		var params FormattingParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.formatting(params), nil
+	}
+
+	if strings.HasPrefix(msg.Method, "$/") {
+		// Notificaciones opcionales del protocolo ($/cancelRequest, $/setTrace...)
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("método no soportado: %s", msg.Method)}
+}
+
+// decodeParams decodifica los parámetros de un mensaje
+func decodeParams(msg *message, params interface{}) *responseError {
+	if len(msg.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// notify envía una notificación al cliente
+func (s *server) notify(method string, params interface{}) *responseError {
+	encoded, err := json.Marshal(params)
+	if err == nil {
+		err = s.out.write(&message{Method: method, Params: encoded})
+	}
+	if err != nil {
+		return &responseError{Code: codeInvalidRequest, Message: err.Error()}
+	}
+	return nil
+}
+
+// initialize carga el documento de ejemplo y anuncia las capacidades del servidor
+func (s *server) initialize(params InitializeParams) (interface{}, *responseError) {
+	if options := params.InitializationOptions; options != nil && options.Sample != "" {
+		sample, err := LoadSample(options.Sample)
+		if err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		s.setSample(sample)
+	}
+	s.initialized = true
+
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": 1, // sincronización completa
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{".", "[", `"`},
+			},
+			"hoverProvider":              true,
+			"documentFormattingProvider": true,
+		},
+		"serverInfo": map[string]string{"name": source},
+	}, nil
+}
+
+// LoadSample lee y decodifica un documento de ejemplo aplicando los límites por defecto
+func LoadSample(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer el documento de ejemplo: %w", err)
+	}
+	if err := limits.CheckDocument(string(data), limits.Default()); err != nil {
+		return nil, fmt.Errorf("documento de ejemplo %s: %w", path, err)
+	}
+
+	var sample interface{}
+	if err := json.Unmarshal(data, &sample); err != nil {
+		return nil, fmt.Errorf("documento de ejemplo %s: JSON inválido: %w", path, err)
+	}
+	return sample, nil
+}
+
+// queryLine es una línea del documento que contiene una consulta
+type queryLine struct {
+	line   int    // número de línea desde 0
+	text   string // texto completo de la línea, sin el fin de línea
+	start  int    // offset en bytes del inicio de la consulta dentro de la línea
+	source string // consulta sin espacios alrededor
+}
+
+// queries separa el documento en líneas de consulta
+func queries(text string) []queryLine {
+	var result []queryLine
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		result = append(result, queryLine{
+			line:   i,
+			text:   line,
+			start:  strings.Index(line, trimmed),
+			source: trimmed,
+		})
+	}
+	return result
+}
+
+// queryAt retorna la consulta de una línea, si la hay
+func queryAt(text string, line int) (queryLine, bool) {
+	for _, q := range queries(text) {
+		if q.line == line {
+			return q, true
+		}
+	}
+	return queryLine{}, false
+}
+
+// position convierte un offset en bytes de la consulta en una posición LSP
+func (q queryLine) position(offset int) Position {
+	return Position{Line: q.line, Character: utf16Length(q.text[:q.start+offset])}
+}
+
+// lintQuery analiza una consulta con la estructura del ejemplo si existe
+func (s *server) lintQuery(query string) lint.Result {
+	if s.inferred != nil {
+		return lint.LintWithSchema(query, s.inferred)
+	}
+	return lint.Lint(query)
+}
+
+// publishDiagnostics analiza cada consulta del documento y publica los diagnósticos
+func (s *server) publishDiagnostics(document *TextDocumentItem) *responseError {
+	diagnostics := []Diagnostic{}
+	for _, q := range queries(document.Text) {
+		for _, d := range s.lintQuery(q.source).Diagnostics {
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    Range{Start: q.position(d.Span.Start.Offset), End: q.position(d.Span.End.Offset)},
+				Severity: severity(d.Severity),
+				Code:     d.Rule,
+				Source:   source,
+				Message:  d.Message,
+			})
+		}
+	}
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         document.URI,
+		Version:     document.Version,
+		Diagnostics: diagnostics,
+	})
+}
+
+// severity traduce la gravedad del lint a la del protocolo
+func severity(value lint.Severity) int {
+	switch value {
+	case lint.SeverityError:
+		return SeverityError
+	case lint.SeverityWarning:
+		return SeverityWarning
+	default:
+		return SeverityInformation
+	}
+}
+
+// cursor ubica una posición LSP dentro de la consulta de su línea.
+// Retorna el offset en bytes relativo a la consulta, limitado a sus extremos.
+func (s *server) cursor(params TextDocumentPositionParams) (queryLine, int, bool) {
+	document, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return queryLine{}, 0, false
+	}
+	q, ok := queryAt(document.Text, params.Position.Line)
+	if !ok {
+		return queryLine{}, 0, false
+	}
+
+	offset := byteOffsetUTF16(q.text, params.Position.Character) - q.start
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(q.source) {
+		offset = len(q.source)
+	}
+	return q, offset, true
+}
+
+// completion propone los segmentos siguientes según el documento de ejemplo
+func (s *server) completion(params TextDocumentPositionParams) CompletionList {
+	list := CompletionList{Items: []CompletionItem{}}
+	q, offset, ok := s.cursor(params)
+	if !ok || s.sample == nil {
+		return list
+	}
+
+	result := completion.Complete(q.source, utf8.RuneCountInString(q.source[:offset]), s.sample)
+	replace := Range{Start: q.position(result.Replace.Start.Offset), End: q.position(result.Replace.End.Offset)}
+	for _, candidate := range result.Candidates {
+		kind := CompletionKindField
+		if candidate.Kind == completion.KindIndex {
+			kind = CompletionKindValue
+		}
+		list.Items = append(list.Items, CompletionItem{
+			Label:    candidate.Label,
+			Kind:     kind,
+			Detail:   candidate.Type + " " + candidate.Detail,
+			TextEdit: &TextEdit{Range: replace, NewText: candidate.InsertText},
+		})
+	}
+	list.IsIncomplete = result.Truncated
+	return list
+}
+
+// hover describe el segmento bajo el cursor: su ruta canónica y, con un documento
+// de ejemplo, el tipo del valor al que resuelve
+func (s *server) hover(params TextDocumentPositionParams) *Hover {
+	q, offset, ok := s.cursor(params)
+	if !ok {
+		return nil
+	}
+	query, err := parser.Parse(q.source)
+	if err != nil {
+		return nil
+	}
+
+	for i, segment := range query.Segments {
+		if offset < segment.Span.Start.Offset || offset > segment.Span.End.Offset {
+			continue
+		}
+
+		path := query.Keys()[:i+1]
+		text := fmt.Sprintf("`%s`", parser.FormatKeys(path))
+		if s.sample != nil {
+			if value, found := completion.Resolve(s.sample, path); found {
+				text += fmt.Sprintf(": **%s**\n\n`%s`", completion.TypeName(value), completion.Detail(value))
+			} else {
+				text += ": no existe en el documento de ejemplo"
+			}
+		}
+
+		return &Hover{
+			Contents: MarkupContent{Kind: "markdown", Value: text},
+			Range:    &Range{Start: q.position(segment.Span.Start.Offset), End: q.position(segment.Span.End.Offset)},
+		}
+	}
+	return nil
+}
+
+// formatting reescribe en forma canónica las consultas válidas del documento
+func (s *server) formatting(params FormattingParams) []TextEdit {
+	edits := []TextEdit{}
+	document, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return edits
+	}
+
+	for _, q := range queries(document.Text) {
+		query, err := parser.Parse(q.source)
+		if err != nil {
+			continue
+		}
+		if formatted := parser.Format(query); formatted != q.source {
+			edits = append(edits, TextEdit{
+				Range:   Range{Start: q.position(0), End: q.position(len(q.source))},
+				NewText: formatted,
+			})
+		}
+	}
+	return edits
+}
+
+// utf16Length cuenta las unidades UTF-16 de un texto
+func utf16Length(text string) int {
+	length := 0
+	for _, r := range text {
+		length += utf16.RuneLen(r)
+	}
+	return length
+}
+
+// byteOffsetUTF16 convierte un desplazamiento en unidades UTF-16 en un offset en bytes
+func byteOffsetUTF16(text string, character int) int {
+	units := 0
+	for i, r := range text {
+		if units >= character {
+			return i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(text)
+}
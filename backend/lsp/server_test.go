@@ -0,0 +1,354 @@
+package lsp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"procesador-consultas/lsp"
+)
+
+// sample es el documento de ejemplo de la sesión
+const sample = `{"usuario": {"nombre": "Ana", "año": 30, "tags": ["a", "b"]}, "items": [{"id": 1}]}`
+
+// document tiene una consulta por línea; la última usa un carácter fuera del plano
+// básico para verificar las columnas en unidades UTF-16
+const document = "# consultas\n" +
+	"usuario.nombr\n" +
+	"  usuario . tags[0]\n" +
+	"usuario..x\n" +
+	`"😀".x`
+
+// message es un mensaje JSON-RPC visto desde el cliente
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int            `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// client envía peticiones y guarda las notificaciones que recibe mientras espera
+type client struct {
+	in            *textproto.Reader
+	out           io.Writer
+	nextID        int
+	notifications []json.RawMessage
+}
+
+// send escribe un mensaje con su encabezado Content-Length
+func (c *client) send(msg message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// receive lee el siguiente mensaje del servidor
+func (c *client) receive() (json.RawMessage, error) {
+	header, err := c.in.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("Content-Length inválido: %w", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.in.R, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// request envía una petición y espera su respuesta
+func (c *client) request(method string, params interface{}) (*message, error) {
+	c.nextID++
+	id := c.nextID
+	if err := c.send(message{ID: &id, Method: method, Params: params}); err != nil {
+		return nil, err
+	}
+
+	for {
+		body, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return nil, err
+		}
+		if msg.ID != nil && *msg.ID == id {
+			return &msg, nil
+		}
+		c.notifications = append(c.notifications, body)
+	}
+}
+
+// notify envía una notificación
+func (c *client) notify(method string, params interface{}) error {
+	return c.send(message{Method: method, Params: params})
+}
+
+// diagnostics espera la siguiente publicación de diagnósticos
+func (c *client) diagnostics() (*lsp.PublishDiagnosticsParams, error) {
+	for {
+		var body json.RawMessage
+		if len(c.notifications) > 0 {
+			body, c.notifications = c.notifications[0], c.notifications[1:]
+		} else {
+			var err error
+			if body, err = c.receive(); err != nil {
+				return nil, err
+			}
+		}
+
+		var msg struct {
+			Method string                       `json:"method"`
+			Params lsp.PublishDiagnosticsParams `json:"params"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return nil, err
+		}
+		if msg.Method == "textDocument/publishDiagnostics" {
+			return &msg.Params, nil
+		}
+	}
+}
+
+// check registra una verificación fallida sin detener la sesión
+func check(t *testing.T, ok bool, name string, format string, args ...interface{}) {
+	t.Helper()
+	if !ok {
+		t.Errorf("%s: %s", name, fmt.Sprintf(format, args...))
+	}
+}
+
+// position crea una posición LSP
+func position(line, character int) map[string]int {
+	return map[string]int{"line": line, "character": character}
+}
+
+// findDiagnostic busca el diagnóstico de una regla en una línea
+func findDiagnostic(diagnostics []lsp.Diagnostic, line int, code string) *lsp.Diagnostic {
+	for i := range diagnostics {
+		if diagnostics[i].Range.Start.Line == line && diagnostics[i].Code == code {
+			return &diagnostics[i]
+		}
+	}
+	return nil
+}
+
+// TestServeSession conecta un cliente con el servidor a través de tuberías en memoria
+// y recorre una sesión completa: inicialización, diagnósticos al abrir y cambiar un
+// documento, completion, hover, formatting y cierre
+func TestServeSession(t *testing.T) {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(sample), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() {
+		err := lsp.Serve(ctx, serverIn, serverOut, lsp.Options{Sample: decoded})
+		serverOut.Close()
+		served <- err
+	}()
+
+	// Si la sesión se interrumpe, cerrar las tuberías libera al servidor y al cliente
+	c := &client{in: textproto.NewReader(bufio.NewReader(clientIn)), out: clientOut}
+	if err := run(t, c); err != nil {
+		clientOut.Close()
+		clientIn.Close()
+		t.Fatalf("sesión: %v", err)
+	}
+
+	select {
+	case err := <-served:
+		check(t, err == nil, "exit", "Serve retornó %v", err)
+	case <-ctx.Done():
+		t.Fatal("exit: el servidor no terminó tras exit")
+	}
+}
+
+// run recorre la sesión
+func run(t *testing.T, c *client) error {
+	uri := "file:///consultas.q"
+	textDocument := map[string]string{"uri": uri}
+
+	// Antes de initialize
+	response, err := c.request("textDocument/hover", map[string]interface{}{
+		"textDocument": textDocument, "position": position(0, 0),
+	})
+	if err != nil {
+		return err
+	}
+	check(t, response.Error != nil && response.Error.Code == -32002, "no inicializado",
+		"se esperaba el error -32002, se obtuvo %+v", response.Error)
+
+	// initialize
+	response, err = c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	if err != nil {
+		return err
+	}
+	var initialized struct {
+		Capabilities struct {
+			TextDocumentSync   int  `json:"textDocumentSync"`
+			HoverProvider      bool `json:"hoverProvider"`
+			FormattingProvider bool `json:"documentFormattingProvider"`
+			CompletionProvider struct {
+				TriggerCharacters []string `json:"triggerCharacters"`
+			} `json:"completionProvider"`
+		} `json:"capabilities"`
+	}
+	json.Unmarshal(response.Result, &initialized)
+	capabilities := initialized.Capabilities
+	check(t, capabilities.TextDocumentSync == 1 && capabilities.HoverProvider && capabilities.FormattingProvider &&
+		len(capabilities.CompletionProvider.TriggerCharacters) > 0, "initialize", "capacidades: %s", response.Result)
+	if err := c.notify("initialized", map[string]interface{}{}); err != nil {
+		return err
+	}
+
+	// didOpen publica los diagnósticos
+	if err := c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "consulta", "version": 1, "text": document},
+	}); err != nil {
+		return err
+	}
+	published, err := c.diagnostics()
+	if err != nil {
+		return err
+	}
+	check(t, published.URI == uri && published.Version == 1, "didOpen", "publicación: %+v", published)
+
+	unknown := findDiagnostic(published.Diagnostics, 1, "unknown_key")
+	check(t, unknown != nil && unknown.Severity == lsp.SeverityWarning &&
+		unknown.Range.Start.Character == 8 && unknown.Range.End.Character == 13 &&
+		strings.Contains(unknown.Message, "nombre"),
+		"diagnóstico unknown_key", "%+v", published.Diagnostics)
+
+	nonCanonical := findDiagnostic(published.Diagnostics, 2, "non_canonical")
+	check(t, nonCanonical != nil && nonCanonical.Range.Start.Character == 2,
+		"diagnóstico non_canonical con sangría", "%+v", published.Diagnostics)
+
+	syntax := findDiagnostic(published.Diagnostics, 3, "syntax")
+	check(t, syntax != nil && syntax.Severity == lsp.SeverityError && syntax.Range.Start.Character == 8,
+		"diagnóstico de sintaxis", "%+v", published.Diagnostics)
+
+	// "😀" ocupa dos unidades UTF-16: la cadena va de 0 a 4 y .x empieza en 5
+	emoji := findDiagnostic(published.Diagnostics, 4, "unknown_key")
+	check(t, emoji != nil && emoji.Range.Start.Character == 0 && emoji.Range.End.Character == 4,
+		"columnas UTF-16", "%+v", published.Diagnostics)
+	check(t, findDiagnostic(published.Diagnostics, 0, "syntax") == nil, "comentarios", "%+v", published.Diagnostics)
+
+	// completion al final de usuario.nombr
+	response, err = c.request("textDocument/completion", map[string]interface{}{
+		"textDocument": textDocument, "position": position(1, 13),
+	})
+	if err != nil {
+		return err
+	}
+	var list lsp.CompletionList
+	json.Unmarshal(response.Result, &list)
+	check(t, len(list.Items) == 1 && list.Items[0].Label == "nombre" && list.Items[0].TextEdit != nil &&
+		list.Items[0].TextEdit.Range.Start.Character == 8 && list.Items[0].TextEdit.NewText == "nombre",
+		"completion", "%s", response.Result)
+
+	// completion después de un punto lista todas las claves
+	response, err = c.request("textDocument/completion", map[string]interface{}{
+		"textDocument": textDocument, "position": position(2, 12),
+	})
+	if err != nil {
+		return err
+	}
+	list = lsp.CompletionList{}
+	json.Unmarshal(response.Result, &list)
+	check(t, len(list.Items) == 3 && list.Items[0].Label == "año", "completion tras punto", "%s", response.Result)
+
+	// hover sobre tags
+	response, err = c.request("textDocument/hover", map[string]interface{}{
+		"textDocument": textDocument, "position": position(2, 14),
+	})
+	if err != nil {
+		return err
+	}
+	var hover lsp.Hover
+	json.Unmarshal(response.Result, &hover)
+	check(t, strings.Contains(hover.Contents.Value, "usuario.tags") && strings.Contains(hover.Contents.Value, "array") &&
+		hover.Range != nil && hover.Range.Start.Character == 12 && hover.Range.End.Character == 16,
+		"hover", "%s", response.Result)
+
+	// hover sobre el índice
+	response, err = c.request("textDocument/hover", map[string]interface{}{
+		"textDocument": textDocument, "position": position(2, 17),
+	})
+	if err != nil {
+		return err
+	}
+	hover = lsp.Hover{}
+	json.Unmarshal(response.Result, &hover)
+	check(t, strings.Contains(hover.Contents.Value, "usuario.tags[0]") && strings.Contains(hover.Contents.Value, "string"),
+		"hover sobre índice", "%s", response.Result)
+
+	// formatting reescribe solo la línea no canónica
+	response, err = c.request("textDocument/formatting", map[string]interface{}{
+		"textDocument": textDocument, "options": map[string]interface{}{"tabSize": 2, "insertSpaces": true},
+	})
+	if err != nil {
+		return err
+	}
+	var edits []lsp.TextEdit
+	json.Unmarshal(response.Result, &edits)
+	check(t, len(edits) == 1 && edits[0].NewText == "usuario.tags[0]" && edits[0].Range.Start.Line == 2 &&
+		edits[0].Range.Start.Character == 2 && edits[0].Range.End.Character == 19,
+		"formatting", "%s", response.Result)
+
+	// didChange con el documento corregido deja los diagnósticos vacíos
+	if err := c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": "usuario.nombre\nitems[0].id\n"}},
+	}); err != nil {
+		return err
+	}
+	published, err = c.diagnostics()
+	if err != nil {
+		return err
+	}
+	check(t, published.Version == 2 && len(published.Diagnostics) == 0, "didChange", "publicación: %+v", published)
+
+	// Métodos desconocidos
+	response, err = c.request("textDocument/definition", map[string]interface{}{
+		"textDocument": textDocument, "position": position(0, 0),
+	})
+	if err != nil {
+		return err
+	}
+	check(t, response.Error != nil && response.Error.Code == -32601, "método desconocido", "%+v", response.Error)
+
+	// Cierre
+	response, err = c.request("shutdown", nil)
+	if err != nil {
+		return err
+	}
+	check(t, response.Error == nil, "shutdown", "%+v", response.Error)
+	return c.notify("exit", nil)
+}
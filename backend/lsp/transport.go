@@ -0,0 +1,108 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxMessageBytes limita el tamaño de un mensaje entrante
+const maxMessageBytes = 64 * 1024 * 1024
+
+// message es un mensaje JSON-RPC 2.0: petición, notificación o respuesta
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+// isNotification indica si el mensaje no espera respuesta
+func (m *message) isNotification() bool {
+	return len(m.ID) == 0
+}
+
+// responseError es el error de una respuesta JSON-RPC
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Códigos de error de JSON-RPC y LSP
+const (
+	codeParseError           = -32700
+	codeInvalidParams        = -32602
+	codeMethodNotFound       = -32601
+	codeServerNotInitialized = -32002
+	codeInvalidRequest       = -32600
+)
+
+// reader lee mensajes con el encabezado Content-Length del protocolo base de LSP
+type reader struct {
+	r *textproto.Reader
+}
+
+// newReader crea un lector de mensajes
+func newReader(r io.Reader) *reader {
+	return &reader{r: textproto.NewReader(bufio.NewReader(r))}
+}
+
+// read lee el siguiente mensaje; retorna io.EOF cuando la entrada termina
+func (r *reader) read() (*message, error) {
+	header, err := r.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || (len(header) == 0 && strings.Contains(err.Error(), "EOF")) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("encabezado inválido: %w", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("Content-Length inválido: %q", header.Get("Content-Length"))
+	}
+	if length > maxMessageBytes {
+		return nil, fmt.Errorf("mensaje de %d bytes excede el máximo de %d", length, maxMessageBytes)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.r.R, body); err != nil {
+		return nil, fmt.Errorf("cuerpo incompleto: %w", err)
+	}
+
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return &message{Error: &responseError{Code: codeParseError, Message: err.Error()}}, nil
+	}
+	return &msg, nil
+}
+
+// writer escribe mensajes con su encabezado; es seguro para uso concurrente
+type writer struct {
+	mux sync.Mutex
+	w   io.Writer
+}
+
+// write serializa y envía un mensaje
+func (w *writer) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if _, err := fmt.Fprintf(w.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.w.Write(body)
+	return err
+}
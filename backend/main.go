@@ -1,14 +1,23 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"procesador-consultas/engine"
+	"procesador-consultas/limits"
+	"procesador-consultas/optimizer"
 	"procesador-consultas/parser"
+	"procesador-consultas/queryerr"
+	"procesador-consultas/schema"
+	"procesador-consultas/validator"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -20,6 +29,53 @@ var (
 	engineMutex     sync.RWMutex
 )
 
+// Límites de recursos del servidor, configurables por variables de entorno
+var serverLimits = limits.FromEnv()
+
+// Política del cache de planes, configurable con QUERY_PLAN_CACHE_POLICY
+var planCachePolicy = planCachePolicyFromEnv()
+
+// planCachePolicyFromEnv lee la política del cache de planes; un valor desconocido
+// se ignora y se usa la política por consulta
+func planCachePolicyFromEnv() optimizer.PlanCachePolicy {
+	policy, err := optimizer.ParsePlanCachePolicy(os.Getenv("QUERY_PLAN_CACHE_POLICY"))
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return optimizer.PlanCacheByQuery
+	}
+	return policy
+}
+
+// Pipeline de pases del optimizador, configurable con QUERY_OPTIMIZER_PASSES y
+// QUERY_OPTIMIZER_MAX_ITERATIONS; nil usa el nivel de optimización
+var optimizerPipeline = pipelineFromEnv()
+
+// pipelineFromEnv lee el pipeline de pases; sin QUERY_OPTIMIZER_PASSES o con un valor
+// inválido se usa el pipeline del nivel de optimización
+func pipelineFromEnv() *optimizer.Pipeline {
+	spec := os.Getenv("QUERY_OPTIMIZER_PASSES")
+	if spec == "" {
+		return nil
+	}
+
+	iterations := 1
+	if value := os.Getenv("QUERY_OPTIMIZER_MAX_ITERATIONS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("⚠️  QUERY_OPTIMIZER_MAX_ITERATIONS inválido: %q", value)
+		} else {
+			iterations = parsed
+		}
+	}
+
+	pipeline, err := optimizer.ParsePipeline(spec, iterations)
+	if err != nil {
+		log.Printf("⚠️  QUERY_OPTIMIZER_PASSES inválido: %v", err)
+		return nil
+	}
+	return &pipeline
+}
+
 // getOptimizedEngine retorna el motor optimizado global
 func getOptimizedEngine() *engine.OptimizedEngine {
 	engineMutex.RLock()
@@ -33,29 +89,99 @@ func getOptimizedEngine() *engine.OptimizedEngine {
 	defer engineMutex.Unlock()
 
 	if optimizedEngine == nil {
-		optimizedEngine = engine.NewOptimizedEngine()
+		config := engine.DefaultOptimizationConfig()
+		config.PlanCache = planCachePolicy
+		config.Pipeline = optimizerPipeline
+		optimizedEngine = engine.NewOptimizedEngineWithConfig(serverLimits, config)
 	}
 	return optimizedEngine
 }
 
-// QueryRequest representa la solicitud de consulta
+const (
+	// defaultQueryTimeout es el plazo máximo de ejecución de una petición
+	defaultQueryTimeout = 10 * time.Second
+	// statusClientClosedRequest es el código (no estándar) para clientes que abandonan la petición
+	statusClientClosedRequest = 499
+)
+
+// QueryRequest representa la solicitud de consulta. Si incluye un esquema, el
+// documento se valida antes de consultar y las violaciones se reportan con 422.
 type QueryRequest struct {
-	JSON  string `json:"json" binding:"required"`
-	Query string `json:"query" binding:"required"`
+	JSON   string             `json:"json" binding:"required"`
+	Query  string             `json:"query" binding:"required"`
+	Schema *schema.JSONSchema `json:"schema,omitempty"`
+}
+
+// CompareRequest representa la solicitud de comparación de rendimiento
+type CompareRequest struct {
+	QueryRequest
+	Mode      string                  `json:"mode"`
+	Benchmark *engine.BenchmarkConfig `json:"benchmark,omitempty"`
+	Execution engine.ExecutionOptions `json:"execution"`
+}
+
+// ExplainRequest representa la solicitud de explicación de un plan. Con mode
+// "analyze" también ejecuta el plan paso a paso; con pipeline construye el plan con
+// esos pases en lugar de los del servidor.
+type ExplainRequest struct {
+	QueryRequest
+	Mode     string              `json:"mode"`
+	Pipeline *optimizer.Pipeline `json:"pipeline,omitempty"`
 }
 
+// GraphRequest representa la solicitud del grafo del plan de una consulta ("plan",
+// por defecto) o del AST del documento ("ast") en formato "dot" (por defecto) o
+// "mermaid". MaxDepth y MaxWidth acotan el AST; cero desactiva el límite.
+type GraphRequest struct {
+	JSON     string `json:"json" binding:"required"`
+	Query    string `json:"query"`
+	Graph    string `json:"graph"`
+	Format   string `json:"format"`
+	MaxDepth *int   `json:"max_depth"`
+	MaxWidth *int   `json:"max_width"`
+}
+
+// Límites por defecto del grafo del AST
+const (
+	defaultGraphDepth = 4
+	defaultGraphWidth = 10
+)
+
 // QueryResponse representa la respuesta de consulta
 type QueryResponse struct {
 	Success           bool                          `json:"success"`
 	Data              map[string]interface{}        `json:"data,omitempty"`
 	Error             string                        `json:"error,omitempty"`
+	ErrorCode         queryerr.Code                 `json:"error_code,omitempty"`
+	ErrorDetail       *queryerr.Error               `json:"error_detail,omitempty"`
+	Diagnostics       []queryerr.SyntaxDiagnostic   `json:"diagnostics,omitempty"`
+	Violations        []validator.Violation         `json:"violations,omitempty"`
 	Results           map[string]engine.QueryResult `json:"results,omitempty"`
 	OptimizationStats *engine.OptimizedEngineStats  `json:"optimization_stats,omitempty"`
+	Comparison        *engine.ComparisonResponse    `json:"comparison,omitempty"`
+	Execution         *engine.ExecutionOptions      `json:"execution,omitempty"`
 }
 
 func main() {
 	// Configurar Gin
 	gin.SetMode(gin.ReleaseMode)
+	r := setupRouter()
+
+	// Configurar servidor
+	srv := &http.Server{
+		Addr:         ":8080",
+		Handler:      r,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	log.Println("🚀 Servidor iniciado en http://localhost:8080")
+	log.Fatal(srv.ListenAndServe())
+}
+
+// setupRouter crea el router con el middleware y las rutas del servidor
+func setupRouter() *gin.Engine {
 	r := gin.Default()
 
 	// Configurar CORS
@@ -64,6 +190,8 @@ func main() {
 	config.AllowMethods = []string{"GET", "POST", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept"}
 	r.Use(cors.New(config))
+	r.Use(queryDeadline(defaultQueryTimeout))
+	r.Use(limitBody(serverLimits.MaxBodyBytes))
 
 	// Rutas
 	r.GET("/health", healthCheck)
@@ -71,33 +199,145 @@ func main() {
 	r.POST("/query/compare", handleQueryCompare)
 	r.POST("/query/optimized", handleOptimizedQuery)
 	r.POST("/query/optimized/compare", handleOptimizedQueryCompare)
+	r.POST("/query/explain", handleQueryExplain)
+	r.POST("/query/graph", handleQueryGraph)
 	r.GET("/optimization/stats", handleOptimizationStats)
+	r.GET("/optimization/passes", handleOptimizationPasses)
 	r.POST("/query/update-stats", handleUpdateStats)
-
-	// Ruta principal - redirigir al frontend
+	r.POST("/query/format", handleQueryFormat)
+	r.POST("/query/lint", handleQueryLint)
+	r.POST("/query/complete", handleQueryComplete)
+	r.POST("/query/tokens", handleQueryTokens)
+	r.POST("/schema/infer", handleSchemaInfer)
+	r.POST("/validate", handleValidate)
+
+	// Ruta principal - redirigir al frontend. Los endpoints se listan a partir de las
+	// rutas registradas, así que incluyen cualquier ruta nueva.
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"message": "Procesador de Consultas JSON API",
-			"endpoints": []string{
-				"GET /health",
-				"POST /query",
-				"POST /query/compare",
-			},
-			"frontend": "http://localhost:3000",
+			"message":   "Procesador de Consultas JSON API",
+			"endpoints": listEndpoints(r.Routes()),
+			"frontend":  "http://localhost:3000",
 		})
 	})
 
-	// Configurar servidor
-	srv := &http.Server{
-		Addr:         ":8080",
-		Handler:      r,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	return r
+}
+
+// listEndpoints retorna las rutas como "MÉTODO /ruta", ordenadas por ruta y método
+func listEndpoints(routes gin.RoutesInfo) []string {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	endpoints := make([]string, len(routes))
+	for i, route := range routes {
+		endpoints[i] = route.Method + " " + route.Path
 	}
+	return endpoints
+}
 
-	log.Println("🚀 Servidor iniciado en http://localhost:8080")
-	log.Fatal(srv.ListenAndServe())
+// queryDeadline aplica un plazo a cada petición; el cliente puede acortarlo con ?timeout=500ms
+func queryDeadline(max time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := max
+		if raw := c.Query("timeout"); raw != "" {
+			if d, err := time.ParseDuration(raw); err == nil && d > 0 && d < max {
+				timeout = d
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// limitBody limita el tamaño del cuerpo de las peticiones
+func limitBody(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if max > 0 && c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		}
+		c.Next()
+	}
+}
+
+// respondBindError responde a una solicitud que no se pudo decodificar
+func respondBindError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		// El tamaño real solo se conoce si el cliente envió Content-Length
+		actual := c.Request.ContentLength
+		if actual < 0 {
+			actual = 0
+		}
+		respondError(c, &limits.Error{Kind: limits.KindBodySize, Limit: maxBytesErr.Limit, Actual: actual})
+		return
+	}
+
+	respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "Datos de entrada inválidos: %v", err))
+}
+
+// statusFor retorna el código HTTP de un error tipado
+func statusFor(err *queryerr.Error) int {
+	switch {
+	case err.Code == queryerr.CodePathNotFound:
+		return http.StatusNotFound
+	case err.Code == queryerr.CodeLimitBodySize:
+		return http.StatusRequestEntityTooLarge
+	case err.Code.IsLimit(), err.Code == queryerr.CodeValidation:
+		return http.StatusUnprocessableEntity
+	case err.Code == queryerr.CodeCanceled:
+		if errors.Is(err, context.DeadlineExceeded) {
+			return http.StatusGatewayTimeout
+		}
+		return statusClientClosedRequest
+	case err.Code == queryerr.CodeInternal:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// respondError responde con el código HTTP y el detalle que corresponden al error tipado
+func respondError(c *gin.Context, err error) {
+	queryErr := queryerr.From(err)
+
+	message := queryErr.Message
+	switch queryErr.Code {
+	case queryerr.CodeSyntax:
+		message = "Error parseando consulta: " + message
+	case queryerr.CodeCanceled:
+		message = "La consulta fue cancelada por el cliente"
+		if errors.Is(queryErr, context.DeadlineExceeded) {
+			message = "La consulta excedió el tiempo máximo de ejecución"
+		}
+	}
+
+	c.JSON(statusFor(queryErr), QueryResponse{
+		Success:     false,
+		Error:       message,
+		ErrorCode:   queryErr.Code,
+		ErrorDetail: queryErr,
+		Diagnostics: queryErr.Diagnostics,
+	})
+}
+
+// respondEngineError responde a los errores del motor que invalidan toda la petición
+// (cancelación y límites de recursos). Retorna false si el error no es de esos tipos.
+func respondEngineError(c *gin.Context, err error) bool {
+	code := queryerr.CodeOf(err)
+	if code != queryerr.CodeCanceled && !code.IsLimit() {
+		return false
+	}
+	respondError(c, err)
+	return true
 }
 
 // healthCheck verifica el estado del servidor
@@ -113,20 +353,18 @@ func healthCheck(c *gin.Context) {
 func handleQuery(c *gin.Context) {
 	var req QueryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Datos de entrada inválidos: " + err.Error(),
-		})
+		respondBindError(c, err)
 		return
 	}
 
 	// Parsear la consulta
 	keys, err := parser.ParseQueryString(req.Query)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Error parseando consulta: " + err.Error(),
-		})
+		respondError(c, err)
+		return
+	}
+
+	if !validateBeforeQuery(c, req) {
 		return
 	}
 
@@ -141,18 +379,18 @@ func handleQuery(c *gin.Context) {
 	}
 
 	// Usar motor optimizado
-	result = eng.QueryWithOptimization(req.JSON, keys, library)
+	result = eng.QueryWithOptimization(c.Request.Context(), req.JSON, keys, library)
+	if respondEngineError(c, result.Err) {
+		return
+	}
 
 	// Asegurar tiempos mínimos (solo para motor no optimizado)
 	if eng.Engine != nil {
 		eng.EnsureMinimumTimes(&result)
 	}
 
-	if result.Error != "" {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   result.Error,
-		})
+	if result.Err != nil {
+		respondError(c, result.Err)
 		return
 	}
 
@@ -170,57 +408,99 @@ func handleQuery(c *gin.Context) {
 
 // handleQueryCompare maneja una consulta con comparación de rendimiento
 func handleQueryCompare(c *gin.Context) {
-	var req QueryRequest
+	var req CompareRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Datos de entrada inválidos: " + err.Error(),
-		})
+		respondBindError(c, err)
 		return
 	}
 
 	// Validar que el JSON sea válido
 	if req.JSON == "" {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "JSON de entrada no puede estar vacío",
-		})
+		respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "JSON de entrada no puede estar vacío"))
 		return
 	}
 
 	// Validar que la consulta no esté vacía
 	if req.Query == "" {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Consulta no puede estar vacía",
-		})
+		respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "Consulta no puede estar vacía"))
 		return
 	}
 
 	// Parsear la consulta
 	keys, err := parser.ParseQueryString(req.Query)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Error parseando consulta: " + err.Error(),
-		})
+		respondError(c, err)
+		return
+	}
+
+	if !validateBeforeQuery(c, req.QueryRequest) {
 		return
 	}
 
+	// Los campos ausentes en benchmark ya tienen su valor por defecto
+	// (BenchmarkConfig.UnmarshalJSON); solo se validan los enviados
+	if req.Benchmark != nil {
+		if err := req.Benchmark.Validate(); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
 	// Ejecutar consulta con motor optimizado para actualizar estadísticas
 	optimizedEng := getOptimizedEngine()
 
 	// Ejecutar una consulta optimizada para actualizar estadísticas
-	optimizedEng.QueryWithOptimization(req.JSON, keys, "standard")
+	if result := optimizedEng.QueryWithOptimization(c.Request.Context(), req.JSON, keys, "standard"); respondEngineError(c, result.Err) {
+		return
+	}
 
 	// Ejecutar comparación con motor original
-	eng := engine.NewEngine()
-	results := eng.ComparePerformance(req.JSON, keys)
+	eng := engine.NewEngineWithLimits(serverLimits)
+
+	// Modo benchmark: varias iteraciones con estadísticas por librería
+	if req.Mode == "benchmark" || req.Benchmark != nil {
+		config := engine.DefaultBenchmarkConfig()
+		if req.Benchmark != nil {
+			config = *req.Benchmark
+		}
+
+		comparison, err := eng.BenchmarkPerformance(c.Request.Context(), req.JSON, keys, config)
+		if respondEngineError(c, err) {
+			return
+		}
+		if len(comparison.Ranking) == 0 {
+			c.JSON(http.StatusBadRequest, QueryResponse{
+				Success:    false,
+				Error:      "Error procesando JSON con todas las librerías",
+				Comparison: comparison,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, QueryResponse{
+			Success:    true,
+			Comparison: comparison,
+		})
+		return
+	}
+
+	results, execution := eng.ComparePerformanceWithOptions(c.Request.Context(), req.JSON, keys, req.Execution)
+	if err := c.Request.Context().Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+	for _, result := range results {
+		if respondEngineError(c, result.Err) {
+			return
+		}
+	}
 
 	// Limpiar errores de "no encontrado" de los resultados
 	for key, result := range results {
-		if result.Error == fmt.Sprintf("no se encontró el valor para la ruta: %v", keys) {
+		if result.ErrorCode == queryerr.CodePathNotFound {
 			result.Error = ""
+			result.ErrorCode = ""
+			result.Err = nil
 			results[key] = result
 		}
 	}
@@ -236,16 +516,18 @@ func handleQueryCompare(c *gin.Context) {
 
 	if hasErrors {
 		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Error procesando JSON con una o más librerías",
-			Results: results,
+			Success:   false,
+			Error:     "Error procesando JSON con una o más librerías",
+			Results:   results,
+			Execution: &execution,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, QueryResponse{
-		Success: true,
-		Results: results,
+		Success:   true,
+		Results:   results,
+		Execution: &execution,
 	})
 }
 
@@ -253,20 +535,18 @@ func handleQueryCompare(c *gin.Context) {
 func handleOptimizedQuery(c *gin.Context) {
 	var req QueryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Datos de entrada inválidos: " + err.Error(),
-		})
+		respondBindError(c, err)
 		return
 	}
 
 	// Parsear la consulta
 	keys, err := parser.ParseQueryString(req.Query)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Error parseando consulta: " + err.Error(),
-		})
+		respondError(c, err)
+		return
+	}
+
+	if !validateBeforeQuery(c, req) {
 		return
 	}
 
@@ -277,13 +557,13 @@ func handleOptimizedQuery(c *gin.Context) {
 		library = "standard"
 	}
 
-	result := eng.QueryWithOptimization(req.JSON, keys, library)
+	result := eng.QueryWithOptimization(c.Request.Context(), req.JSON, keys, library)
+	if respondEngineError(c, result.Err) {
+		return
+	}
 
-	if result.Error != "" {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   result.Error,
-		})
+	if result.Err != nil {
+		respondError(c, result.Err)
 		return
 	}
 
@@ -301,33 +581,171 @@ func handleOptimizedQuery(c *gin.Context) {
 
 // handleOptimizedQueryCompare maneja una comparación de consultas optimizadas
 func handleOptimizedQueryCompare(c *gin.Context) {
-	var req QueryRequest
+	var req CompareRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Datos de entrada inválidos: " + err.Error(),
-		})
+		respondBindError(c, err)
 		return
 	}
 
 	// Parsear la consulta
 	keys, err := parser.ParseQueryString(req.Query)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Error parseando consulta: " + err.Error(),
-		})
+		respondError(c, err)
+		return
+	}
+
+	if !validateBeforeQuery(c, req.QueryRequest) {
 		return
 	}
 
 	// Ejecutar comparación optimizada
 	eng := getOptimizedEngine()
-	results := eng.CompareOptimizedPerformance(req.JSON, keys)
+	results, execution := eng.CompareOptimizedPerformanceWithOptions(c.Request.Context(), req.JSON, keys, req.Execution)
+	if err := c.Request.Context().Err(); err != nil {
+		respondError(c, err)
+		return
+	}
+	for _, result := range results {
+		if respondEngineError(c, result.Err) {
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, QueryResponse{
 		Success:           true,
 		Results:           results,
 		OptimizationStats: eng.GetOptimizationStats(),
+		Execution:         &execution,
+	})
+}
+
+// handleQueryExplain muestra el plan de una consulta antes y después de cada pase del
+// optimizador. La librería se indica con ?library=; sin ella (o con "auto") se elige
+// la de menor tiempo estimado.
+func handleQueryExplain(c *gin.Context) {
+	var req ExplainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var analyze bool
+	switch req.Mode {
+	case "", "plan":
+	case "analyze":
+		analyze = true
+	default:
+		respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "modo desconocido: %q (se esperaba plan o analyze)", req.Mode))
+		return
+	}
+
+	// Parsear la consulta
+	keys, err := parser.ParseQueryString(req.Query)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if !validateBeforeQuery(c, req.QueryRequest) {
+		return
+	}
+
+	explanation, err := getOptimizedEngine().Explain(c.Request.Context(), req.JSON, keys, engine.ExplainOptions{
+		Library:  c.Query("library"),
+		Analyze:  analyze,
+		Pipeline: req.Pipeline,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"explain": explanation,
+		},
+	})
+}
+
+// handleQueryGraph exporta el plan de una consulta o el AST del documento como
+// grafo de Graphviz (DOT) o de Mermaid
+func handleQueryGraph(c *gin.Context) {
+	var req GraphRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if req.Format == "" {
+		req.Format = "dot"
+	}
+	if req.Format != "dot" && req.Format != "mermaid" {
+		respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "formato desconocido: %q (se esperaba dot o mermaid)", req.Format))
+		return
+	}
+
+	options := optimizer.GraphOptions{MaxDepth: defaultGraphDepth, MaxWidth: defaultGraphWidth}
+	if req.MaxDepth != nil {
+		options.MaxDepth = *req.MaxDepth
+	}
+	if req.MaxWidth != nil {
+		options.MaxWidth = *req.MaxWidth
+	}
+	if options.MaxDepth < 0 || options.MaxWidth < 0 {
+		respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "max_depth y max_width no pueden ser negativos"))
+		return
+	}
+
+	eng := getOptimizedEngine()
+	var content string
+	switch req.Graph {
+	case "", "plan":
+		req.Graph = "plan"
+		if req.Query == "" {
+			respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "Se requiere query para el grafo del plan"))
+			return
+		}
+		keys, err := parser.ParseQueryString(req.Query)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		explanation, err := eng.Explain(c.Request.Context(), req.JSON, keys, engine.ExplainOptions{Library: "standard"})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if req.Format == "mermaid" {
+			content = optimizer.PlanToMermaid(explanation.Plan)
+		} else {
+			content = optimizer.PlanToDOT(explanation.Plan)
+		}
+
+	case "ast":
+		ast, err := eng.DocumentAST(c.Request.Context(), req.JSON)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if req.Format == "mermaid" {
+			content = optimizer.ASTToMermaid(ast, options)
+		} else {
+			content = optimizer.ASTToDOT(ast, options)
+		}
+
+	default:
+		respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "grafo desconocido: %q (se esperaba plan o ast)", req.Graph))
+		return
+	}
+
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"graph":   req.Graph,
+			"format":  req.Format,
+			"content": content,
+		},
 	})
 }
 
@@ -344,39 +762,44 @@ func handleOptimizationStats(c *gin.Context) {
 	})
 }
 
+// handleOptimizationPasses retorna los pases registrados y el pipeline del motor
+func handleOptimizationPasses(c *gin.Context) {
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"passes":   optimizer.RegisteredPasses(),
+			"pipeline": getOptimizedEngine().Pipeline(),
+		},
+	})
+}
+
 // handleUpdateStats ejecuta una consulta optimizada para actualizar estadísticas
 func handleUpdateStats(c *gin.Context) {
 	var req QueryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Datos de entrada inválidos: " + err.Error(),
-		})
+		respondBindError(c, err)
 		return
 	}
 
 	// Validar entrada
 	if req.JSON == "" || req.Query == "" {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "JSON y consulta son requeridos",
-		})
+		respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "JSON y consulta son requeridos"))
 		return
 	}
 
 	// Parsear consulta
 	keys, err := parser.ParseQueryString(req.Query)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, QueryResponse{
-			Success: false,
-			Error:   "Error parseando consulta: " + err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
 	// Ejecutar consulta optimizada para actualizar estadísticas
 	eng := getOptimizedEngine()
-	result := eng.QueryWithOptimization(req.JSON, keys, "standard")
+	result := eng.QueryWithOptimization(c.Request.Context(), req.JSON, keys, "standard")
+	if respondEngineError(c, result.Err) {
+		return
+	}
 
 	c.JSON(http.StatusOK, QueryResponse{
 		Success: true,
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"procesador-consultas/engine"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+}
+
+// post envía una petición POST con el cuerpo en JSON y decodifica la respuesta
+func post(router http.Handler, path string, body interface{}) (int, QueryResponse, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return 0, QueryResponse{}, err
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+
+	var response QueryResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return recorder.Code, response, fmt.Errorf("respuesta inválida (HTTP %d): %v", recorder.Code, err)
+	}
+	return recorder.Code, response, nil
+}
+
+// TestQueryConcurrent envía peticiones simultáneas a /query con las tres librerías
+// sobre el motor global y verifica cada respuesta y las estadísticas finales. Con
+// -race también detecta carreras entre los handlers.
+func TestQueryConcurrent(t *testing.T) {
+	router := setupRouter()
+
+	document := `{"users":[{"name":"Ana","profile":{"languages":["es","en"]}},{"name":"Luis","profile":{"languages":["pt"]}}],"version":3}`
+	cases := []struct {
+		query    string
+		expected interface{}
+		status   int
+	}{
+		{"users.0.name", "Ana", http.StatusOK},
+		{"users[1].name", "Luis", http.StatusOK},
+		{"users.0.profile.languages.1", "en", http.StatusOK},
+		{"users.1.profile.languages.0", "pt", http.StatusOK},
+		{"version", float64(3), http.StatusOK},
+		{"users.2.name", nil, http.StatusNotFound},
+	}
+
+	before := getOptimizedEngine().GetOptimizationStats().TotalQueries
+
+	const workers = 16
+	requests := 600
+	if testing.Short() {
+		requests = 90
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < requests; i += workers {
+				c := cases[i%len(cases)]
+				library := engine.Libraries[(i/len(cases))%len(engine.Libraries)]
+
+				status, response, err := post(router, "/query?library="+library, QueryRequest{JSON: document, Query: c.query})
+				switch {
+				case err != nil:
+					errs <- fmt.Errorf("%s %s: %v", library, c.query, err)
+				case status != c.status:
+					errs <- fmt.Errorf("%s %s: HTTP %d, se esperaba %d (%s)", library, c.query, status, c.status, response.Error)
+				case status == http.StatusOK && response.Data["value"] != c.expected:
+					errs <- fmt.Errorf("%s %s: %#v != %#v", library, c.query, response.Data["value"], c.expected)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	stats := getOptimizedEngine().GetOptimizationStats()
+	if sent := stats.TotalQueries - before; sent != int64(requests) {
+		t.Errorf("TotalQueries aumentó en %d, se enviaron %d", sent, requests)
+	}
+	if stats.CacheHits+stats.OptimizedQueries != stats.TotalQueries {
+		t.Errorf("CacheHits (%d) + OptimizedQueries (%d) != TotalQueries (%d)",
+			stats.CacheHits, stats.OptimizedQueries, stats.TotalQueries)
+	}
+}
+
+// TestQueryCompareBenchmarkDefaults verifica que los campos ausentes de benchmark
+// conserven su valor por defecto y que los valores inválidos se rechacen
+func TestQueryCompareBenchmarkDefaults(t *testing.T) {
+	router := setupRouter()
+	request := func(benchmark string) map[string]interface{} {
+		return map[string]interface{}{
+			"json":      `{"a":{"b":1}}`,
+			"query":     "a.b",
+			"benchmark": json.RawMessage(benchmark),
+		}
+	}
+
+	status, response, err := post(router, "/query/compare", request(`{"iterations": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK || response.Comparison == nil {
+		t.Fatalf("HTTP %d: %s", status, response.Error)
+	}
+	defaults := engine.DefaultBenchmarkConfig()
+	config := response.Comparison.Config
+	if config.Iterations != 3 || config.Warmup != defaults.Warmup || config.Confidence != defaults.Confidence ||
+		config.Randomize == nil || *config.Randomize != *defaults.Randomize {
+		t.Errorf("configuración %+v: se esperaba iterations 3 y el resto por defecto (%+v)", config, defaults)
+	}
+
+	for _, benchmark := range []string{`{"iterations": 0}`, `{"warmup": -1}`, `{"confidence": 1.5}`} {
+		status, response, err := post(router, "/query/compare", request(benchmark))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != http.StatusBadRequest || response.ErrorCode != "invalid_request" {
+			t.Errorf("%s: HTTP %d, código %q; se esperaba 400 invalid_request", benchmark, status, response.ErrorCode)
+		}
+	}
+}
+
+// TestRootListsEndpoints verifica que GET / liste todas las rutas registradas
+func TestRootListsEndpoints(t *testing.T) {
+	router := setupRouter()
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	var response struct {
+		Endpoints []string `json:"endpoints"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("respuesta inválida (HTTP %d): %v", recorder.Code, err)
+	}
+
+	listed := make(map[string]bool, len(response.Endpoints))
+	for _, endpoint := range response.Endpoints {
+		listed[endpoint] = true
+	}
+	for _, route := range router.Routes() {
+		if endpoint := route.Method + " " + route.Path; !listed[endpoint] {
+			t.Errorf("GET / no lista %s", endpoint)
+		}
+	}
+	for _, endpoint := range []string{"POST /query/lint", "POST /schema/infer", "POST /validate", "POST /query/complete",
+		"POST /query/tokens", "POST /query/explain", "POST /query/graph"} {
+		if !listed[endpoint] {
+			t.Errorf("GET / no lista %s", endpoint)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package optimizer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metadatos que buildAST registra en los nodos de objetos y arreglos
+const (
+	metaSize    = "size"    // claves del objeto o elementos del arreglo
+	metaDepth   = "depth"   // contenedores que rodean al nodo
+	metaNodes   = "nodes"   // valores del subárbol, incluido el propio contenedor
+	metaObjects = "objects" // objetos del subárbol, incluido el propio contenedor
+)
+
+// metaDocument guarda las estadísticas del documento en los metadatos de la raíz
+const metaDocument = "document"
+
+// DocumentStats resume la forma de un documento a partir de su AST
+type DocumentStats struct {
+	Nodes          int `json:"nodes"`
+	MaxDepth       int `json:"max_depth"`
+	Objects        int `json:"objects"`
+	Arrays         int `json:"arrays"`
+	ObjectEntries  int `json:"object_entries"`
+	ArrayItems     int `json:"array_items"`
+	MaxObjectSize  int `json:"max_object_size"`
+	MaxArrayLength int `json:"max_array_length"`
+}
+
+// AverageObjectSize retorna el número medio de claves por objeto
+func (s DocumentStats) AverageObjectSize() float64 {
+	if s.Objects == 0 {
+		return 0
+	}
+	return float64(s.ObjectEntries) / float64(s.Objects)
+}
+
+// AverageArrayLength retorna el número medio de elementos por arreglo
+func (s DocumentStats) AverageArrayLength() float64 {
+	if s.Arrays == 0 {
+		return 0
+	}
+	return float64(s.ArrayItems) / float64(s.Arrays)
+}
+
+// Tipos de contenedor que encuentra cada segmento
+const (
+	ContainerObject = "object"
+	ContainerArray  = "array"
+	ContainerScalar = "scalar"
+)
+
+// StepStatistics describe el valor sobre el que se aplica un segmento de la ruta
+type StepStatistics struct {
+	Key       string `json:"key"`
+	Container string `json:"container"`
+	FanOut    int    `json:"fan_out"` // claves o elementos del contenedor
+	Found     bool   `json:"found"`
+}
+
+// PlanStatistics son las estadísticas del documento a lo largo de la ruta de un
+// plan: el recorrido se detiene en el primer segmento que no existe
+type PlanStatistics struct {
+	Document      DocumentStats    `json:"document"`
+	Steps         []StepStatistics `json:"steps"`
+	Found         bool             `json:"found"`
+	ResultNodes   int              `json:"result_nodes"`   // valores del subárbol encontrado
+	ResultObjects int              `json:"result_objects"` // objetos del subárbol encontrado
+}
+
+// CostProfile contiene los costos de ejecución de una librería, en nanosegundos
+type CostProfile struct {
+	BaseNanos       float64 `json:"base_nanos"`        // costo fijo por ejecución
+	ObjectStepNanos float64 `json:"object_step_nanos"` // acceso a una clave de un objeto
+	ArrayStepNanos  float64 `json:"array_step_nanos"`  // acceso a un elemento por índice
+
+	// Búsqueda lineal en objetos: costo por clave comparada antes de encontrar la
+	// buscada y por clave descartada cuando no existe (casi siempre por longitud)
+	ScanEntryNanos float64 `json:"scan_entry_nanos"`
+	MissEntryNanos float64 `json:"miss_entry_nanos"`
+
+	// Conversión del resultado a tipos de Go: por valor y por objeto (el mapa)
+	ConvertNodeNanos   float64 `json:"convert_node_nanos"`
+	ConvertObjectNanos float64 `json:"convert_object_nanos"`
+}
+
+// CostModel asocia cada librería con su perfil de costos
+type CostModel map[string]CostProfile
+
+// DefaultCostModel retorna los perfiles medidos con BenchmarkCompiledPlan sobre planes
+// compilados. encoding/json y json-iterator producen mapas de Go, cuyo acceso no
+// depende del tamaño del objeto; fastjson busca las claves de forma lineal y
+// convierte el resultado a tipos de Go, lo que depende del tamaño del subárbol.
+func DefaultCostModel() CostModel {
+	generic := CostProfile{BaseNanos: 8, ObjectStepNanos: 27, ArrayStepNanos: 8}
+	return CostModel{
+		"standard":      generic,
+		"json-iterator": generic,
+		"fastjson": CostProfile{
+			BaseNanos:          30,
+			ObjectStepNanos:    30,
+			ArrayStepNanos:     10,
+			ScanEntryNanos:     6,
+			MissEntryNanos:     1,
+			ConvertNodeNanos:   60,
+			ConvertObjectNanos: 570,
+		},
+	}
+}
+
+// profile retorna el perfil de una librería, o el de "standard" si no existe
+func (m CostModel) profile(library string) CostProfile {
+	if profile, ok := m[library]; ok {
+		return profile
+	}
+	return m["standard"]
+}
+
+// stepCosts estima el costo de cada segmento de la ruta; los segmentos posteriores
+// al primero que falla no se ejecutan y su costo es cero
+func (m CostModel) stepCosts(stats *PlanStatistics, library string, segments int) []time.Duration {
+	p := m.profile(library)
+	costs := make([]time.Duration, segments)
+	for i, step := range stats.Steps {
+		var nanos float64
+		switch step.Container {
+		case ContainerObject:
+			// Búsqueda lineal: en promedio la mitad de las claves si existe, todas si no
+			if step.Found {
+				nanos = p.ObjectStepNanos + p.ScanEntryNanos*float64(step.FanOut)/2
+			} else {
+				nanos = p.ObjectStepNanos + p.MissEntryNanos*float64(step.FanOut)
+			}
+		case ContainerArray:
+			nanos = p.ArrayStepNanos
+		}
+		costs[i] = time.Duration(nanos)
+	}
+	return costs
+}
+
+// Estimate estima el tiempo de ejecución de la ruta con una librería: el costo fijo,
+// el de cada segmento ejecutado y, si la ruta existe, el de convertir el resultado
+func (m CostModel) Estimate(stats *PlanStatistics, library string) time.Duration {
+	if stats == nil {
+		return 0
+	}
+
+	p := m.profile(library)
+	total := time.Duration(p.BaseNanos)
+	for _, cost := range m.stepCosts(stats, library, len(stats.Steps)) {
+		total += cost
+	}
+	if stats.Found {
+		total += time.Duration(p.ConvertNodeNanos*float64(stats.ResultNodes) +
+			p.ConvertObjectNanos*float64(stats.ResultObjects))
+	}
+	return total
+}
+
+// pathStatistics recorre el AST siguiendo la ruta y registra el contenedor y el
+// tamaño de cada segmento, con la misma regla de índices que el motor
+func pathStatistics(ast *ASTNode, query []string) *PlanStatistics {
+	stats := &PlanStatistics{Steps: []StepStatistics{}}
+	if document, ok := ast.Metadata[metaDocument].(DocumentStats); ok {
+		stats.Document = document
+	}
+	if len(ast.Children) == 0 {
+		return stats
+	}
+
+	current := ast.Children[0]
+	for _, key := range query {
+		step := StepStatistics{Key: key, Container: ContainerScalar}
+		var next *ASTNode
+
+		switch current.Type {
+		case NODE_OBJECT:
+			step.Container = ContainerObject
+			step.FanOut = len(current.Children)
+			for _, property := range current.Children {
+				if property.Value == key {
+					next = property.Children[0]
+					break
+				}
+			}
+		case NODE_ARRAY:
+			step.Container = ContainerArray
+			step.FanOut = len(current.Children)
+			var index int
+			if _, err := fmt.Sscanf(key, "%d", &index); err == nil && index >= 0 && index < len(current.Children) {
+				next = current.Children[index].Children[0]
+			}
+		}
+
+		step.Found = next != nil
+		stats.Steps = append(stats.Steps, step)
+		if next == nil {
+			return stats
+		}
+		current = next
+	}
+
+	stats.Found = true
+	stats.ResultNodes, stats.ResultObjects = 1, 0
+	if nodes, ok := current.Metadata[metaNodes].(int); ok {
+		stats.ResultNodes = nodes
+		stats.ResultObjects = current.Metadata[metaObjects].(int)
+	}
+	return stats
+}
@@ -0,0 +1,88 @@
+package optimizer
+
+import "context"
+
+// PassTrace registra el plan antes y después de un pase
+type PassTrace struct {
+	Pass      string      `json:"pass"`
+	Iteration int         `json:"iteration"` // iteración del pipeline, desde 1
+	Before    []QueryStep `json:"before"`
+	After     []QueryStep `json:"after"`
+	Changed   bool        `json:"changed"`           // el pase modificó algún paso
+	Changes   []string    `json:"changes,omitempty"` // cambios que describe el pase
+}
+
+// Explanation describe cómo el optimizador construyó el plan de una consulta
+type Explanation struct {
+	Initial *QueryPlan  `json:"initial_plan"` // plan sin optimizar
+	Passes  []PassTrace `json:"passes"`       // pases aplicados en cada iteración, en orden
+	Plan    *QueryPlan  `json:"plan"`         // plan final, con su costo estimado
+}
+
+// planTrace acumula los pases aplicados a un plan; un *planTrace nil no registra nada
+type planTrace struct {
+	passes []PassTrace
+}
+
+// record registra un pase
+func (t *planTrace) record(pass string, iteration int, before, after []QueryStep, changes []string) {
+	if t == nil {
+		return
+	}
+	t.passes = append(t.passes, PassTrace{
+		Pass:      pass,
+		Iteration: iteration,
+		Before:    before,
+		After:     after,
+		Changed:   !equalSteps(before, after),
+		Changes:   changes,
+	})
+}
+
+// Explain construye el plan de una consulta como OptimizeQuery, registrando el plan
+// antes y después de cada pase. No consulta ni actualiza el cache de planes ni las
+// estadísticas, así que siempre muestra los pases de la configuración actual.
+func (o *Optimizer) Explain(ctx context.Context, query []string, jsonData interface{}) (*Explanation, error) {
+	shape, err := o.ShapeFingerprint(ctx, jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, err := o.buildAST(ctx, jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := o.createQueryPlan(query, ast)
+	plan.Shape = shape
+	initial := *plan
+	initial.Optimizations = []string{}
+	initial.EstimatedCostNs = o.calculateEstimatedCost(plan)
+
+	trace := &planTrace{passes: []PassTrace{}}
+	if err := o.optimizePlan(plan, trace); err != nil {
+		return nil, err
+	}
+
+	return &Explanation{Initial: &initial, Passes: trace.passes, Plan: plan}, nil
+}
+
+// OptimizationLevel retorna el nivel de optimización configurado
+func (o *Optimizer) OptimizationLevel() int {
+	return o.config.OptimizationLevel
+}
+
+// equalSteps compara dos secuencias de pasos campo a campo
+func equalSteps(a, b []QueryStep) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Operation != b[i].Operation || a[i].Target != b[i].Target ||
+			a[i].EstimatedTime != b[i].EstimatedTime || !equalPaths(a[i].Keys, b[i].Keys) ||
+			!equalPaths(a[i].Conditions, b[i].Conditions) {
+			return false
+		}
+	}
+	return true
+}
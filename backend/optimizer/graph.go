@@ -0,0 +1,277 @@
+package optimizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// GraphOptions acota el tamaño de los grafos del AST; un valor cero desactiva el límite
+type GraphOptions struct {
+	MaxDepth int // niveles de contenedores que se expanden bajo la raíz
+	MaxWidth int // hijos que se muestran por contenedor
+}
+
+// graphValueLength es el número de caracteres que se muestran de un valor escalar
+const graphValueLength = 32
+
+// Formas de los nodos de un grafo, con su equivalente en DOT y en Mermaid
+type graphShape int
+
+const (
+	shapeBox graphShape = iota
+	shapeRounded
+	shapeCylinder
+	shapeEllipse
+	shapeNote
+)
+
+// graphNode es un nodo del grafo
+type graphNode struct {
+	id    string
+	label string
+	shape graphShape
+}
+
+// graphEdge es una arista del grafo, con una etiqueta opcional
+type graphEdge struct {
+	from, to string
+	label    string
+}
+
+// graph es la representación intermedia que comparten los formatos de salida
+type graph struct {
+	name      string
+	direction string // "LR" o "TB"
+	comment   string
+	nodes     []graphNode
+	edges     []graphEdge
+}
+
+// add agrega un nodo y retorna su identificador
+func (g *graph) add(label string, shape graphShape) string {
+	id := fmt.Sprintf("n%d", len(g.nodes))
+	g.nodes = append(g.nodes, graphNode{id: id, label: label, shape: shape})
+	return id
+}
+
+// connect agrega una arista
+func (g *graph) connect(from, to, label string) {
+	g.edges = append(g.edges, graphEdge{from: from, to: to, label: label})
+}
+
+// PlanToDOT retorna el plan como un grafo de Graphviz: un nodo por paso, del
+// documento al resultado
+func PlanToDOT(plan *QueryPlan) string {
+	return planGraph(plan).dot()
+}
+
+// PlanToMermaid retorna el plan como un diagrama de flujo de Mermaid
+func PlanToMermaid(plan *QueryPlan) string {
+	return planGraph(plan).mermaid()
+}
+
+// ASTToDOT retorna el AST del documento como un grafo de Graphviz. Las propiedades
+// se muestran como etiquetas de las aristas; los contenedores más profundos que
+// MaxDepth y los hijos que exceden MaxWidth se resumen en un nodo.
+func ASTToDOT(root *ASTNode, options GraphOptions) string {
+	return astGraph(root, options).dot()
+}
+
+// ASTToMermaid retorna el AST del documento como un diagrama de flujo de Mermaid,
+// con el mismo resumen que ASTToDOT
+func ASTToMermaid(root *ASTNode, options GraphOptions) string {
+	return astGraph(root, options).mermaid()
+}
+
+// BuildAST construye el AST de un documento decodificado con los límites de recursos
+// del optimizador
+func (o *Optimizer) BuildAST(ctx context.Context, data interface{}) (*ASTNode, error) {
+	return o.buildAST(ctx, data)
+}
+
+// planGraph construye el grafo de un plan
+func planGraph(plan *QueryPlan) *graph {
+	g := &graph{name: "plan", direction: "LR"}
+	if len(plan.Optimizations) > 0 {
+		g.comment = "optimizaciones: " + strings.Join(plan.Optimizations, ", ")
+	}
+
+	previous := g.add("documento", shapeEllipse)
+	for i, step := range plan.Steps {
+		label := fmt.Sprintf("%d. %s\n%s", i+1, step.Type, step.Target)
+		shape := shapeBox
+		switch step.Type {
+		case StepMemoization:
+			shape = shapeCylinder
+		case StepCombined:
+			shape = shapeRounded
+		}
+		if step.EstimatedTime > 0 {
+			label += "\n~" + step.EstimatedTime.String()
+		}
+
+		current := g.add(label, shape)
+		g.connect(previous, current, "")
+		previous = current
+	}
+
+	result := "resultado"
+	if plan.EstimatedCostNs > 0 {
+		result += "\n~" + time.Duration(plan.EstimatedCostNs).String()
+	}
+	g.connect(previous, g.add(result, shapeEllipse), "")
+	return g
+}
+
+// astGraph construye el grafo de un AST
+func astGraph(root *ASTNode, options GraphOptions) *graph {
+	g := &graph{name: "ast", direction: "TB"}
+	id := g.add("$", shapeEllipse)
+	for _, child := range root.Children {
+		g.astNode(child, id, "", options, 0)
+	}
+	return g
+}
+
+// astNode agrega un valor del AST unido a su padre y, hasta los límites, sus hijos;
+// depth es el número de contenedores que lo rodean
+func (g *graph) astNode(node *ASTNode, parent, key string, options GraphOptions, depth int) {
+	switch node.Type {
+	case NODE_OBJECT, NODE_ARRAY:
+	default:
+		g.connect(parent, g.add(scalarLabel(node.Value), shapeEllipse), key)
+		return
+	}
+
+	label := fmt.Sprintf("[%d]", len(node.Children))
+	properties := node.Children
+	if node.Type == NODE_OBJECT {
+		label = fmt.Sprintf("{%d}", len(node.Children))
+		// El AST conserva el orden de iteración del mapa; se ordena para que la
+		// salida sea estable
+		properties = append([]*ASTNode(nil), node.Children...)
+		sort.Slice(properties, func(i, j int) bool {
+			return fmt.Sprint(properties[i].Value) < fmt.Sprint(properties[j].Value)
+		})
+	}
+
+	if options.MaxDepth > 0 && depth >= options.MaxDepth && len(properties) > 0 {
+		if nodes, ok := node.Metadata[metaNodes].(int); ok {
+			label += fmt.Sprintf("\n… %d nodos", nodes-1)
+		}
+		g.connect(parent, g.add(label, shapeNote), key)
+		return
+	}
+
+	id := g.add(label, shapeBox)
+	g.connect(parent, id, key)
+	for i, property := range properties {
+		if options.MaxWidth > 0 && i >= options.MaxWidth {
+			g.connect(id, g.add(fmt.Sprintf("… %d más", len(properties)-i), shapeNote), "")
+			break
+		}
+		for _, child := range property.Children {
+			g.astNode(child, id, fmt.Sprint(property.Value), options, depth+1)
+		}
+	}
+}
+
+// scalarLabel retorna el valor escalar en JSON, recortado a graphValueLength caracteres
+func scalarLabel(value interface{}) string {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	label := fmt.Sprint(value)
+	if err := encoder.Encode(value); err == nil {
+		label = strings.TrimSuffix(encoded.String(), "\n")
+	}
+	if utf8.RuneCountInString(label) > graphValueLength {
+		label = string([]rune(label)[:graphValueLength-1]) + "…"
+	}
+	return label
+}
+
+// dot escribe el grafo en el lenguaje DOT de Graphviz
+func (g *graph) dot() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", g.name)
+	if g.comment != "" {
+		fmt.Fprintf(&b, "  // %s\n", strings.ReplaceAll(g.comment, "\n", " "))
+	}
+	fmt.Fprintf(&b, "  rankdir=%s;\n", g.direction)
+	b.WriteString("  node [fontname=\"Helvetica\"];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+
+	for _, node := range g.nodes {
+		fmt.Fprintf(&b, "  %s [label=\"%s\", %s];\n", node.id, dotEscape(node.label), dotShapes[node.shape])
+	}
+	for _, edge := range g.edges {
+		if edge.label == "" {
+			fmt.Fprintf(&b, "  %s -> %s;\n", edge.from, edge.to)
+		} else {
+			fmt.Fprintf(&b, "  %s -> %s [label=\"%s\"];\n", edge.from, edge.to, dotEscape(edge.label))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotShapes son los atributos de cada forma en DOT
+var dotShapes = map[graphShape]string{
+	shapeBox:      "shape=box",
+	shapeRounded:  "shape=box, style=rounded",
+	shapeCylinder: "shape=cylinder",
+	shapeEllipse:  "shape=ellipse",
+	shapeNote:     "shape=note, style=dashed",
+}
+
+// dotEscape escapa una etiqueta para una cadena entre comillas de DOT
+func dotEscape(label string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "").Replace(label)
+}
+
+// mermaid escribe el grafo como diagrama de flujo de Mermaid
+func (g *graph) mermaid() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "flowchart %s\n", g.direction)
+	if g.comment != "" {
+		fmt.Fprintf(&b, "  %%%% %s\n", strings.ReplaceAll(g.comment, "\n", " "))
+	}
+
+	for _, node := range g.nodes {
+		shape := mermaidShapes[node.shape]
+		fmt.Fprintf(&b, "  %s%s\"%s\"%s\n", node.id, shape[0], mermaidEscape(node.label), shape[1])
+	}
+	for _, edge := range g.edges {
+		if edge.label == "" {
+			fmt.Fprintf(&b, "  %s --> %s\n", edge.from, edge.to)
+		} else {
+			fmt.Fprintf(&b, "  %s -->|\"%s\"| %s\n", edge.from, mermaidEscape(edge.label), edge.to)
+		}
+	}
+	return b.String()
+}
+
+// mermaidShapes son los delimitadores de cada forma en Mermaid
+var mermaidShapes = map[graphShape][2]string{
+	shapeBox:      {"[", "]"},
+	shapeRounded:  {"(", ")"},
+	shapeCylinder: {"[(", ")]"},
+	shapeEllipse:  {"([", "])"},
+	shapeNote:     {">", "]"},
+}
+
+// mermaidEscape reemplaza los caracteres que Mermaid interpreta dentro de una
+// etiqueta por sus entidades; los saltos de línea se escriben como <br/>
+func mermaidEscape(label string) string {
+	escaped := strings.NewReplacer(
+		"#", "#35;", `"`, "#quot;", "<", "#lt;", ">", "#gt;", "|", "#124;", "`", "#96;", "\r", "",
+	).Replace(label)
+	return strings.ReplaceAll(escaped, "\n", "<br/>")
+}
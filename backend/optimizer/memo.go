@@ -0,0 +1,51 @@
+package optimizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"procesador-consultas/parser"
+)
+
+// defaultMemoizationThreshold es el costo estimado que debe acumular un prefijo de
+// la ruta desde el punto de memoización anterior para agregar uno nuevo
+const defaultMemoizationThreshold = 50 * time.Nanosecond
+
+// ContentFingerprint retorna la huella del contenido de un documento: dos
+// documentos con la misma huella tienen el mismo texto
+func ContentFingerprint(document string) string {
+	sum := sha256.Sum256([]byte(document))
+	return hex.EncodeToString(sum[:16])
+}
+
+// memoKey genera la clave de un prefijo en el cache de prefijos. Combina el espacio
+// de la librería (cada una produce valores de tipos distintos), la huella del
+// contenido del documento y la forma canónica del prefijo, así que dos consultas que
+// comparten prefijo sobre el mismo documento reutilizan el mismo nodo.
+func memoKey(namespace, fingerprint string, prefix []string) string {
+	return namespace + ":" + fingerprint + ":" + parser.CanonicalKey(prefix)
+}
+
+// MemoLookup busca, del más largo al más corto, el primer prefijo de la ruta
+// guardado entre los puntos indicados (longitudes de prefijo en orden creciente).
+// Retorna el valor y la longitud del prefijo encontrado; cuenta un acierto o un
+// fallo por búsqueda.
+func (o *Optimizer) MemoLookup(namespace, fingerprint string, path []string, points []int) (interface{}, int, bool) {
+	for i := len(points) - 1; i >= 0; i-- {
+		if value, exists := o.memo.Get(memoKey(namespace, fingerprint, path[:points[i]])); exists {
+			o.stats.memoHits.Add(1)
+			return value, points[i], true
+		}
+	}
+	o.stats.memoMisses.Add(1)
+	return nil, 0, false
+}
+
+// MemoStore guarda el valor resuelto por un prefijo con su tamaño aproximado en
+// bytes. El valor se comparte entre consultas concurrentes, así que no debe
+// modificarse después de guardarlo.
+func (o *Optimizer) MemoStore(namespace, fingerprint string, prefix []string, value interface{}, size int64) {
+	key := memoKey(namespace, fingerprint, prefix)
+	o.memo.Set(key, value, int64(len(key))+size)
+}
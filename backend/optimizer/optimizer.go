@@ -1,9 +1,13 @@
 package optimizer
 
 import (
+	"context"
 	"fmt"
-	"sync"
 	"time"
+
+	"procesador-consultas/cache"
+	"procesador-consultas/limits"
+	"procesador-consultas/parser"
 )
 
 // NodeType representa el tipo de nodo en el AST
@@ -28,44 +32,84 @@ type ASTNode struct {
 
 // QueryPlan representa un plan de consulta optimizado
 type QueryPlan struct {
-	Steps         []QueryStep
-	EstimatedCost int64
-	Optimizations []string
+	Steps           []QueryStep     `json:"steps"`
+	EstimatedCostNs int64           `json:"estimated_cost_ns"`    // nanosegundos estimados con el perfil "standard" del modelo de costos
+	Optimizations   []string        `json:"optimizations"`        // cambios aplicados, "pase: cambio"
+	Statistics      *PlanStatistics `json:"statistics,omitempty"` // estadísticas del documento a lo largo de la ruta
+	Shape           string          `json:"shape,omitempty"`      // huella estructural del documento con que se construyó el plan
 }
 
 // QueryStep representa un paso en el plan de consulta
 type QueryStep struct {
-	Type          string
-	Operation     string
-	Target        string
-	Conditions    []string
-	EstimatedTime time.Duration
+	Type          string        `json:"type"`
+	Operation     string        `json:"operation"`
+	Target        string        `json:"target"`
+	Keys          []string      `json:"keys,omitempty"` // claves que recorre el paso, en orden (ver Path)
+	Conditions    []string      `json:"conditions,omitempty"`
+	EstimatedTime time.Duration `json:"estimated_time"`
 }
 
 // Optimizer representa el optimizador de código intermedio
 type Optimizer struct {
-	cache    map[string]*QueryPlan
-	cacheMux sync.RWMutex
-	stats    *OptimizationStats
-	config   *OptimizationConfig
+	cache  *cache.Cache // planes por consulta (y forma del documento)
+	memo   *cache.Cache // valores resueltos por prefijo (ver MemoLookup)
+	stats  statsCollector
+	config *OptimizationConfig
 }
 
 // OptimizationStats contiene estadísticas de optimización
 type OptimizationStats struct {
-	TotalQueries  int64
+	TotalQueries  int64 // planes creados
 	CacheHits     int64
-	Optimizations int64
+	Optimizations int64 // cambios aplicados por los pases
 	AverageTime   time.Duration
 	TotalTime     time.Duration
+	MemoHits      int64 // búsquedas en el cache de prefijos que encontraron un valor
+	MemoMisses    int64
+	Caches        map[string]cache.Stats // métricas de cada cache, por nombre
 }
 
 // OptimizationConfig contiene configuración del optimizador
 type OptimizationConfig struct {
 	EnableCache       bool
 	EnableMemoization bool
-	MaxCacheSize      int
+	MaxCacheSize      int           // entradas de cada cache
+	MaxCacheBytes     int64         // bytes de cada cache; cero usa 64 MiB
+	CacheTTL          time.Duration // tiempo de vida de las entradas; cero usa una hora
 	EnableParallel    bool
-	OptimizationLevel int // 0=none, 1=basic, 2=aggressive
+	OptimizationLevel int // 0=none, 1=basic, 2=aggressive; ver PipelineForLevel
+	Limits            limits.Config
+	CostModel         CostModel // perfiles de costo por librería; nil usa DefaultCostModel
+
+	// MemoizationThreshold es el costo estimado entre dos puntos de memoización;
+	// cero usa 50ns
+	MemoizationThreshold time.Duration
+
+	// Pipeline define los pases y su orden; nil usa PipelineForLevel con
+	// OptimizationLevel y EnableMemoization
+	Pipeline *Pipeline
+
+	// PlanCache indica si los planes se reutilizan por consulta o por consulta y
+	// forma del documento; "" equivale a PlanCacheByQuery
+	PlanCache PlanCachePolicy
+}
+
+// Valores por defecto de los límites de los caches
+const (
+	defaultMaxCacheBytes = 64 << 20
+	defaultCacheTTL      = time.Hour
+)
+
+// CacheConfig retorna los límites de los caches según la configuración
+func (c *OptimizationConfig) CacheConfig() cache.Config {
+	config := cache.Config{MaxEntries: c.MaxCacheSize, MaxBytes: c.MaxCacheBytes, TTL: c.CacheTTL}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultMaxCacheBytes
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultCacheTTL
+	}
+	return config
 }
 
 // NewOptimizer crea un nuevo optimizador
@@ -77,82 +121,147 @@ func NewOptimizer(config *OptimizationConfig) *Optimizer {
 			MaxCacheSize:      1000,
 			EnableParallel:    true,
 			OptimizationLevel: 2,
+			Limits:            limits.Default(),
 		}
 	}
 
+	if config.CostModel == nil {
+		config.CostModel = DefaultCostModel()
+	}
+	if config.MemoizationThreshold <= 0 {
+		config.MemoizationThreshold = defaultMemoizationThreshold
+	}
+
 	return &Optimizer{
-		cache:  make(map[string]*QueryPlan),
-		stats:  &OptimizationStats{},
+		cache:  cache.New(config.CacheConfig()),
+		memo:   cache.New(config.CacheConfig()),
 		config: config,
 	}
 }
 
-// OptimizeQuery optimiza una consulta y retorna un plan optimizado
-func (o *Optimizer) OptimizeQuery(query []string, jsonData interface{}) *QueryPlan {
+// OptimizeQuery optimiza una consulta y retorna un plan optimizado.
+// Retorna el error del contexto si este termina mientras se recorre el documento,
+// un *limits.Error si el documento excede la profundidad o los nodos permitidos,
+// o un *InvariantError si un pase produjo un plan no equivalente a la consulta.
+func (o *Optimizer) OptimizeQuery(ctx context.Context, query []string, jsonData interface{}) (*QueryPlan, error) {
+	return o.OptimizeQueryWithShape(ctx, query, jsonData, "")
+}
+
+// OptimizeQueryWithShape es OptimizeQuery con la huella del documento ya calculada
+// por ShapeFingerprint; con shape vacío la calcula cuando la necesita. Evita recorrer
+// el documento de nuevo cuando quien llama ya conoce su forma.
+func (o *Optimizer) OptimizeQueryWithShape(ctx context.Context, query []string, jsonData interface{}, shape string) (*QueryPlan, error) {
 	start := time.Now()
 
-	// Generar clave de cache
+	// Generar clave de cache; con PlanCacheByShape incluye la forma del documento
 	cacheKey := o.generateCacheKey(query)
+	var err error
+	if o.config.PlanCache == PlanCacheByShape {
+		if shape == "" {
+			if shape, err = o.ShapeFingerprint(ctx, jsonData); err != nil {
+				return nil, err
+			}
+		}
+		cacheKey += "@" + shape
+	}
 
 	// Verificar cache
 	if o.config.EnableCache {
 		if cached := o.getFromCache(cacheKey); cached != nil {
-			o.stats.CacheHits++
-			return cached
+			o.stats.cacheHits.Add(1)
+			return cached, nil
+		}
+	}
+
+	// El plan registra la forma del documento con que se construye: sus estadísticas
+	// y su costo solo valen para documentos con esa forma
+	if shape == "" {
+		if shape, err = o.ShapeFingerprint(ctx, jsonData); err != nil {
+			return nil, err
 		}
 	}
 
 	// Crear AST
-	ast := o.buildAST(jsonData)
+	ast, err := o.buildAST(ctx, jsonData)
+	if err != nil {
+		return nil, err
+	}
 
 	// Aplicar optimizaciones
 	plan := o.createQueryPlan(query, ast)
-
-	// Aplicar optimizaciones según el nivel
-	switch o.config.OptimizationLevel {
-	case 1:
-		o.applyBasicOptimizations(plan)
-	case 2:
-		o.applyAggressiveOptimizations(plan)
+	plan.Shape = shape
+	if err := o.optimizePlan(plan, nil); err != nil {
+		return nil, err
 	}
 
-	// Calcular costo estimado
-	plan.EstimatedCost = o.calculateEstimatedCost(plan)
-
 	// Guardar en cache
 	if o.config.EnableCache {
 		o.saveToCache(cacheKey, plan)
 	}
 
 	// Actualizar estadísticas
-	o.stats.TotalQueries++
-	o.stats.TotalTime += time.Since(start)
-	o.stats.AverageTime = o.stats.TotalTime / time.Duration(o.stats.TotalQueries)
+	o.stats.optimizations.Add(int64(len(plan.Optimizations)))
+	o.stats.recordQuery(time.Since(start))
 
-	return plan
+	return plan, nil
 }
 
 // buildAST construye el árbol de sintaxis abstracta
-func (o *Optimizer) buildAST(data interface{}) *ASTNode {
+func (o *Optimizer) buildAST(ctx context.Context, data interface{}) (*ASTNode, error) {
 	root := &ASTNode{
 		Type:     NODE_ROOT,
 		Metadata: make(map[string]interface{}),
 	}
 
-	o.buildASTRecursive(data, root)
-	return root
+	builder := &astBuilder{ctx: ctx, limits: o.config.Limits}
+	if err := builder.build(data, root, 0); err != nil {
+		return nil, err
+	}
+
+	builder.stats.Nodes = builder.nodes
+	root.Metadata[metaDocument] = builder.stats
+	return root, nil
+}
+
+// astCheckInterval indica cada cuántos nodos se comprueba el contexto
+const astCheckInterval = 1024
+
+// astBuilder construye el AST comprobando periódicamente el contexto
+// y acotando la recursión según los límites configurados. Registra en cada
+// contenedor su tamaño, su profundidad y los valores de su subárbol, y acumula
+// las estadísticas del documento que usa el modelo de costos.
+type astBuilder struct {
+	ctx    context.Context
+	limits limits.Config
+	nodes  int
+	stats  DocumentStats
 }
 
-// buildASTRecursive construye el AST recursivamente
-func (o *Optimizer) buildASTRecursive(data interface{}, parent *ASTNode) {
+// build construye el AST recursivamente; depth es el número de contenedores que
+// rodean al valor, con la misma semántica que limits.CheckDocument
+func (b *astBuilder) build(data interface{}, parent *ASTNode, depth int) error {
+	b.nodes++
+	if b.limits.MaxNodes > 0 && b.nodes > b.limits.MaxNodes {
+		return &limits.Error{Kind: limits.KindNodeCount, Limit: int64(b.limits.MaxNodes), Actual: int64(b.nodes)}
+	}
+	if b.nodes%astCheckInterval == 0 {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+	}
+
 	switch v := data.(type) {
 	case map[string]interface{}:
+		if err := b.enter(depth); err != nil {
+			return err
+		}
 		node := &ASTNode{
 			Type:     NODE_OBJECT,
 			Parent:   parent,
 			Metadata: make(map[string]interface{}),
 		}
 		parent.Children = append(parent.Children, node)
+		first := b.mark()
 
 		for key, value := range v {
 			propNode := &ASTNode{
@@ -162,16 +271,27 @@ func (o *Optimizer) buildASTRecursive(data interface{}, parent *ASTNode) {
 				Metadata: make(map[string]interface{}),
 			}
 			node.Children = append(node.Children, propNode)
-			o.buildASTRecursive(value, propNode)
+			if err := b.build(value, propNode, depth+1); err != nil {
+				return err
+			}
 		}
 
+		b.stats.Objects++
+		b.stats.ObjectEntries += len(v)
+		b.stats.MaxObjectSize = max(b.stats.MaxObjectSize, len(v))
+		b.record(node, len(v), depth, first)
+
 	case []interface{}:
+		if err := b.enter(depth); err != nil {
+			return err
+		}
 		node := &ASTNode{
 			Type:     NODE_ARRAY,
 			Parent:   parent,
 			Metadata: make(map[string]interface{}),
 		}
 		parent.Children = append(parent.Children, node)
+		first := b.mark()
 
 		for idx, value := range v {
 			indexNode := &ASTNode{
@@ -181,9 +301,16 @@ func (o *Optimizer) buildASTRecursive(data interface{}, parent *ASTNode) {
 				Metadata: make(map[string]interface{}),
 			}
 			node.Children = append(node.Children, indexNode)
-			o.buildASTRecursive(value, indexNode)
+			if err := b.build(value, indexNode, depth+1); err != nil {
+				return err
+			}
 		}
 
+		b.stats.Arrays++
+		b.stats.ArrayItems += len(v)
+		b.stats.MaxArrayLength = max(b.stats.MaxArrayLength, len(v))
+		b.record(node, len(v), depth, first)
+
 	default:
 		valueNode := &ASTNode{
 			Type:   NODE_VALUE,
@@ -192,26 +319,61 @@ func (o *Optimizer) buildASTRecursive(data interface{}, parent *ASTNode) {
 		}
 		parent.Children = append(parent.Children, valueNode)
 	}
+
+	return nil
+}
+
+// astMark son los contadores del builder al crear un contenedor
+type astMark struct {
+	nodes   int
+	objects int
+}
+
+// mark retorna los contadores actuales; el contenedor ya está contado en nodes
+// pero todavía no en objects
+func (b *astBuilder) mark() astMark {
+	return astMark{nodes: b.nodes, objects: b.stats.Objects}
+}
+
+// record guarda los metadatos de un contenedor ya construido a partir de los
+// contadores que había al crearlo
+func (b *astBuilder) record(node *ASTNode, size, depth int, first astMark) {
+	node.Metadata[metaSize] = size
+	node.Metadata[metaDepth] = depth
+	node.Metadata[metaNodes] = b.nodes - first.nodes + 1
+	node.Metadata[metaObjects] = b.stats.Objects - first.objects
+	b.stats.MaxDepth = max(b.stats.MaxDepth, depth+1)
+}
+
+// enter verifica que abrir un nuevo contenedor no exceda la profundidad máxima
+func (b *astBuilder) enter(depth int) error {
+	if b.limits.MaxDepth > 0 && depth+1 > b.limits.MaxDepth {
+		return &limits.Error{Kind: limits.KindDepth, Limit: int64(b.limits.MaxDepth), Actual: int64(depth + 1)}
+	}
+	return nil
 }
 
-// createQueryPlan crea un plan de consulta básico
+// createQueryPlan crea un plan de consulta básico. El tiempo estimado de cada paso
+// sale del modelo de costos con las estadísticas del documento en ese segmento.
 func (o *Optimizer) createQueryPlan(query []string, ast *ASTNode) *QueryPlan {
 	plan := &QueryPlan{
-		Steps: make([]QueryStep, 0, len(query)),
+		Steps:      make([]QueryStep, 0, len(query)),
+		Statistics: pathStatistics(ast, query),
 	}
+	costs := o.config.CostModel.stepCosts(plan.Statistics, "standard", len(query))
 
-	for _, key := range query {
+	for i, key := range query {
 		step := QueryStep{
-			Type:          "navigation",
+			Type:          StepNavigation,
 			Operation:     "access",
 			Target:        key,
-			EstimatedTime: time.Microsecond * 10,
+			Keys:          []string{key},
+			EstimatedTime: costs[i],
 		}
 
 		// Optimización: si es un índice numérico, marcar como acceso directo
-		if o.isNumericIndex(key) {
-			step.Type = "direct_access"
-			step.EstimatedTime = time.Microsecond * 5
+		if isNumeric(key) {
+			step.Type = StepDirectAccess
 		}
 
 		plan.Steps = append(plan.Steps, step)
@@ -220,182 +382,121 @@ func (o *Optimizer) createQueryPlan(query []string, ast *ASTNode) *QueryPlan {
 	return plan
 }
 
-// applyBasicOptimizations aplica optimizaciones básicas
-func (o *Optimizer) applyBasicOptimizations(plan *QueryPlan) {
-	// Eliminar pasos redundantes
-	plan.Steps = o.removeRedundantSteps(plan.Steps)
-
-	// Combinar pasos consecutivos
-	plan.Steps = o.combineConsecutiveSteps(plan.Steps)
-
-	plan.Optimizations = append(plan.Optimizations, "redundant_elimination", "step_combination")
-}
-
-// applyAggressiveOptimizations aplica optimizaciones agresivas
-func (o *Optimizer) applyAggressiveOptimizations(plan *QueryPlan) {
-	// Aplicar optimizaciones básicas primero
-	o.applyBasicOptimizations(plan)
-
-	// Reordenar pasos para mejor rendimiento
-	plan.Steps = o.reorderSteps(plan.Steps)
-
-	// Aplicar memoización
-	if o.config.EnableMemoization {
-		plan.Steps = o.addMemoizationSteps(plan.Steps)
-	}
-
-	plan.Optimizations = append(plan.Optimizations, "step_reordering", "memoization")
-}
-
-// removeRedundantSteps elimina pasos redundantes
-func (o *Optimizer) removeRedundantSteps(steps []QueryStep) []QueryStep {
-	if len(steps) <= 1 {
-		return steps
+// optimizePlan aplica el pipeline de pases y calcula el costo estimado. La secuencia
+// se repite hasta que una iteración no cambia el plan o hasta MaxIterations; cada
+// pase verifica que el plan resultante sea equivalente al de entrada. Si trace no es
+// nil, registra el plan antes y después de cada pase.
+func (o *Optimizer) optimizePlan(plan *QueryPlan, trace *planTrace) error {
+	pipeline := o.Pipeline()
+	passes, err := pipeline.resolve()
+	if err != nil {
+		return err
 	}
 
-	var optimized []QueryStep
-	for i, step := range steps {
-		// Evitar pasos consecutivos del mismo tipo
-		if i > 0 && steps[i-1].Type == step.Type && steps[i-1].Target == step.Target {
-			continue
+	for iteration := 1; iteration <= max(pipeline.MaxIterations, 1); iteration++ {
+		changed := false
+		for _, pass := range passes {
+			passChanged, err := o.runPass(plan, pass, iteration, trace)
+			if err != nil {
+				return err
+			}
+			changed = changed || passChanged
+		}
+		if !changed {
+			break
 		}
-		optimized = append(optimized, step)
 	}
 
-	return optimized
+	// Calcular costo estimado
+	plan.EstimatedCostNs = o.calculateEstimatedCost(plan)
+	return nil
 }
 
-// combineConsecutiveSteps combina pasos consecutivos
-func (o *Optimizer) combineConsecutiveSteps(steps []QueryStep) []QueryStep {
-	if len(steps) <= 1 {
-		return steps
+// runPass aplica un pase al plan y verifica sus invariantes (ver checkPass). Si el
+// plan cambió, agrega a Optimizations una entrada "pase: cambio" por cada cambio que
+// describe el pase. Retorna si el plan cambió.
+func (o *Optimizer) runPass(plan *QueryPlan, pass Pass, iteration int, trace *planTrace) (bool, error) {
+	before := plan.Steps
+	after, changes := pass.Run(append([]QueryStep(nil), before...), o.config)
+	if err := checkPass(pass.Name, before, after); err != nil {
+		return false, err
 	}
 
-	var combined []QueryStep
-	for i := 0; i < len(steps); i++ {
-		if i+1 < len(steps) && steps[i].Type == "navigation" && steps[i+1].Type == "navigation" {
-			// Combinar dos pasos de navegación
-			combinedStep := QueryStep{
-				Type:          "combined_navigation",
-				Operation:     "multi_access",
-				Target:        steps[i].Target + "." + steps[i+1].Target,
-				EstimatedTime: steps[i].EstimatedTime + steps[i+1].EstimatedTime,
-			}
-			combined = append(combined, combinedStep)
-			i++ // Saltar el siguiente paso
-		} else {
-			combined = append(combined, steps[i])
-		}
+	changed := !equalSteps(before, after)
+	trace.record(pass.Name, iteration, before, after, changes)
+	if !changed {
+		return false, nil
 	}
 
-	return combined
-}
-
-// reorderSteps reordena los pasos para mejor rendimiento
-func (o *Optimizer) reorderSteps(steps []QueryStep) []QueryStep {
-	// Mover accesos directos al principio
-	var directAccess, others []QueryStep
-
-	for _, step := range steps {
-		if step.Type == "direct_access" {
-			directAccess = append(directAccess, step)
-		} else {
-			others = append(others, step)
-		}
+	plan.Steps = after
+	if len(changes) == 0 {
+		changes = []string{"modificó el plan"}
 	}
-
-	// Combinar manteniendo el orden relativo
-	return append(directAccess, others...)
-}
-
-// addMemoizationSteps agrega pasos de memoización
-func (o *Optimizer) addMemoizationSteps(steps []QueryStep) []QueryStep {
-	var memoized []QueryStep
-
-	for i, step := range steps {
-		// Agregar paso de memoización antes de operaciones costosas
-		if step.EstimatedTime > time.Microsecond*50 {
-			memoStep := QueryStep{
-				Type:          "memoization",
-				Operation:     "cache_check",
-				Target:        fmt.Sprintf("memo_%d", i),
-				EstimatedTime: time.Microsecond * 2,
-			}
-			memoized = append(memoized, memoStep)
-		}
-		memoized = append(memoized, step)
+	for _, change := range changes {
+		plan.Optimizations = append(plan.Optimizations, pass.Name+": "+change)
 	}
-
-	return memoized
+	return true, nil
 }
 
-// isNumericIndex verifica si una clave es un índice numérico
-func (o *Optimizer) isNumericIndex(key string) bool {
-	for _, ch := range key {
-		if ch < '0' || ch > '9' {
-			return false
-		}
+// Pipeline retorna el pipeline de pases del optimizador: el configurado o, si no hay
+// uno, el equivalente a OptimizationLevel
+func (o *Optimizer) Pipeline() Pipeline {
+	if o.config.Pipeline != nil {
+		return *o.config.Pipeline
 	}
-	return len(key) > 0
+	return PipelineForLevel(o.config.OptimizationLevel, o.config.EnableMemoization)
 }
 
-// generateCacheKey genera una clave única para el cache
+// generateCacheKey genera una clave única para el cache a partir de la forma canónica de la ruta
 func (o *Optimizer) generateCacheKey(query []string) string {
-	key := ""
-	for _, q := range query {
-		key += q + "."
-	}
-	return key
+	return parser.CanonicalKey(query)
 }
 
 // getFromCache obtiene un plan del cache
 func (o *Optimizer) getFromCache(key string) *QueryPlan {
-	o.cacheMux.RLock()
-	defer o.cacheMux.RUnlock()
-
-	if plan, exists := o.cache[key]; exists {
-		return plan
+	if plan, exists := o.cache.Get(key); exists {
+		return plan.(*QueryPlan)
 	}
 	return nil
 }
 
 // saveToCache guarda un plan en el cache
 func (o *Optimizer) saveToCache(key string, plan *QueryPlan) {
-	o.cacheMux.Lock()
-	defer o.cacheMux.Unlock()
-
-	// Verificar límite de cache
-	if len(o.cache) >= o.config.MaxCacheSize {
-		// Eliminar entrada más antigua (implementación simple)
-		for k := range o.cache {
-			delete(o.cache, k)
-			break
-		}
-	}
-
-	o.cache[key] = plan
+	o.cache.Set(key, plan, int64(len(key))+plan.SizeBytes())
 }
 
-// calculateEstimatedCost calcula el costo estimado del plan
+// calculateEstimatedCost calcula el costo estimado del plan en nanosegundos con el
+// perfil "standard"; los pasos de memoización no navegan y no suman costo
 func (o *Optimizer) calculateEstimatedCost(plan *QueryPlan) int64 {
-	var cost int64
-	for _, step := range plan.Steps {
-		cost += int64(step.EstimatedTime.Microseconds())
+	return int64(o.config.CostModel.Estimate(plan.Statistics, "standard"))
+}
+
+// EstimateQueryTime estima el tiempo de ejecutar el plan con una librería
+func (o *Optimizer) EstimateQueryTime(plan *QueryPlan, library string) time.Duration {
+	return o.config.CostModel.Estimate(plan.Statistics, library)
+}
+
+// PlanCachePolicy retorna la política del cache de planes
+func (o *Optimizer) PlanCachePolicy() PlanCachePolicy {
+	if o.config.PlanCache == "" {
+		return PlanCacheByQuery
 	}
-	return cost
+	return o.config.PlanCache
 }
 
-// GetStats retorna las estadísticas de optimización
+// GetStats retorna una copia de las estadísticas de optimización, con las métricas
+// de los caches de planes ("plans") y de prefijos ("memo")
 func (o *Optimizer) GetStats() *OptimizationStats {
-	return o.stats
+	stats := o.stats.snapshot()
+	stats.Caches = map[string]cache.Stats{
+		"plans": o.cache.Stats(),
+		"memo":  o.memo.Stats(),
+	}
+	return &stats
 }
 
-// ClearCache limpia el cache
+// ClearCache limpia el cache de planes y el de prefijos
 func (o *Optimizer) ClearCache() {
-	o.cacheMux.Lock()
-	defer o.cacheMux.Unlock()
-
-	for k := range o.cache {
-		delete(o.cache, k)
-	}
+	o.cache.Clear()
+	o.memo.Clear()
 }
@@ -0,0 +1,60 @@
+package optimizer
+
+import (
+	"context"
+	"testing"
+
+	"procesador-consultas/limits"
+)
+
+// TestOptimizeQueryWithShape verifica que el plan use la huella recibida en lugar de
+// recorrer el documento, tanto en la clave del cache como en QueryPlan.Shape
+func TestOptimizeQueryWithShape(t *testing.T) {
+	ctx := context.Background()
+	query := []string{"a", "b"}
+	first := map[string]interface{}{"a": map[string]interface{}{"b": 1.0}}
+	second := map[string]interface{}{"a": map[string]interface{}{"b": "x", "c": true}}
+
+	for _, policy := range []PlanCachePolicy{PlanCacheByQuery, PlanCacheByShape} {
+		o := NewOptimizer(&OptimizationConfig{EnableCache: true, MaxCacheSize: 10, OptimizationLevel: 2,
+			Limits: limits.Default(), PlanCache: policy})
+
+		plan, err := o.OptimizeQueryWithShape(ctx, query, first, "forma")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.Shape != "forma" {
+			t.Errorf("%s: Shape = %q, se esperaba la huella recibida", policy, plan.Shape)
+		}
+
+		// Con la misma huella, otro documento reutiliza el plan aunque su forma real difiera
+		again, err := o.OptimizeQueryWithShape(ctx, query, second, "forma")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != plan {
+			t.Errorf("%s: la misma huella debería reutilizar el plan del cache", policy)
+		}
+
+		// Sin huella se calcula la del documento
+		computed, err := o.OptimizeQuery(ctx, query, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := o.ShapeFingerprint(ctx, second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch policy {
+		case PlanCacheByShape:
+			if computed == plan || computed.Shape != want {
+				t.Errorf("%s: sin huella se esperaba un plan nuevo con la forma %s, se obtuvo %q", policy, want, computed.Shape)
+			}
+		case PlanCacheByQuery:
+			// El cache por consulta no depende de la forma
+			if computed != plan {
+				t.Errorf("%s: se esperaba el plan del cache", policy)
+			}
+		}
+	}
+}
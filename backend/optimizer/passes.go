@@ -0,0 +1,261 @@
+package optimizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"procesador-consultas/parser"
+)
+
+// PassFunc reescribe los pasos de un plan. Recibe una copia que puede modificar y
+// retorna los pasos resultantes con una descripción de cada cambio realizado; un
+// pase sin efecto retorna los pasos sin cambios y ninguna descripción.
+type PassFunc func(steps []QueryStep, config *OptimizationConfig) ([]QueryStep, []string)
+
+// Pass es un pase de reescritura registrado con un nombre
+type Pass struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Run         PassFunc `json:"-"`
+}
+
+// Nombres de los pases incluidos
+const (
+	PassRedundantElimination = "redundant_elimination"
+	PassStepCombination      = "step_combination"
+	PassStepReordering       = "step_reordering"
+	PassMemoization          = "memoization"
+)
+
+// Registro de pases, compartido por todos los optimizadores
+var (
+	passMux  sync.RWMutex
+	registry = make(map[string]Pass)
+)
+
+func init() {
+	for _, pass := range []Pass{
+		{Name: PassRedundantElimination, Description: "elimina comprobaciones de memoización repetidas", Run: removeRedundantSteps},
+		{Name: PassStepCombination, Description: "combina pares de pasos de navegación consecutivos", Run: combineConsecutiveSteps},
+		{Name: PassStepReordering, Description: "reordena pasos independientes del valor actual", Run: reorderSteps},
+		{Name: PassMemoization, Description: "marca los prefijos costosos para el cache de prefijos", Run: addMemoizationSteps},
+	} {
+		if err := RegisterPass(pass); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterPass agrega un pase al registro para usarlo por nombre en un Pipeline.
+// Retorna un error si el nombre está vacío o ya registrado, o si el pase no tiene
+// función. Los pases se verifican al aplicarse igual que los incluidos (ver checkPass).
+func RegisterPass(pass Pass) error {
+	if pass.Name == "" || pass.Run == nil {
+		return fmt.Errorf("el pase debe tener nombre y función")
+	}
+
+	passMux.Lock()
+	defer passMux.Unlock()
+	if _, exists := registry[pass.Name]; exists {
+		return fmt.Errorf("el pase %q ya está registrado", pass.Name)
+	}
+	registry[pass.Name] = pass
+	return nil
+}
+
+// LookupPass busca un pase registrado por nombre
+func LookupPass(name string) (Pass, bool) {
+	passMux.RLock()
+	defer passMux.RUnlock()
+	pass, exists := registry[name]
+	return pass, exists
+}
+
+// RegisteredPasses retorna los pases registrados ordenados por nombre
+func RegisteredPasses() []Pass {
+	passMux.RLock()
+	defer passMux.RUnlock()
+	passes := make([]Pass, 0, len(registry))
+	for _, pass := range registry {
+		passes = append(passes, pass)
+	}
+	sort.Slice(passes, func(i, j int) bool { return passes[i].Name < passes[j].Name })
+	return passes
+}
+
+// Pipeline es la secuencia de pases que aplica el optimizador. La secuencia se
+// repite hasta que una iteración completa no cambia el plan (punto fijo) o hasta
+// MaxIterations.
+type Pipeline struct {
+	Passes        []string        `json:"passes"`             // nombres en orden de aplicación
+	Disabled      map[string]bool `json:"disabled,omitempty"` // pases de Passes que no se aplican
+	MaxIterations int             `json:"max_iterations"`     // cero aplica la secuencia una vez
+}
+
+// PipelineForLevel retorna el pipeline equivalente a un nivel de optimización:
+// ninguno en el nivel 0, eliminación de redundancias y combinación en el 1, y además
+// reordenamiento y memoización (si está habilitada) en el 2. Aplica la secuencia una vez.
+func PipelineForLevel(level int, memoization bool) Pipeline {
+	pipeline := Pipeline{Passes: []string{}, MaxIterations: 1}
+	if level >= 1 {
+		pipeline.Passes = append(pipeline.Passes, PassRedundantElimination, PassStepCombination)
+	}
+	if level >= 2 {
+		pipeline.Passes = append(pipeline.Passes, PassStepReordering)
+		if memoization {
+			pipeline.Passes = append(pipeline.Passes, PassMemoization)
+		}
+	}
+	return pipeline
+}
+
+// ParsePipeline convierte una lista de pases separados por comas; un nombre con el
+// prefijo "-" queda en la secuencia pero deshabilitado. Verifica que los pases existan.
+func ParsePipeline(spec string, maxIterations int) (Pipeline, error) {
+	pipeline := Pipeline{Passes: []string{}, Disabled: make(map[string]bool), MaxIterations: maxIterations}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if disabled := strings.TrimPrefix(name, "-"); disabled != name {
+			name = disabled
+			pipeline.Disabled[name] = true
+		}
+		pipeline.Passes = append(pipeline.Passes, name)
+	}
+	return pipeline, pipeline.Validate()
+}
+
+// Validate verifica que los pases del pipeline estén registrados
+func (p Pipeline) Validate() error {
+	if p.MaxIterations < 0 {
+		return fmt.Errorf("MaxIterations no puede ser negativo: %d", p.MaxIterations)
+	}
+	_, err := p.resolve()
+	return err
+}
+
+// resolve retorna los pases habilitados en orden
+func (p Pipeline) resolve() ([]Pass, error) {
+	passes := make([]Pass, 0, len(p.Passes))
+	for _, name := range p.Passes {
+		pass, exists := LookupPass(name)
+		if !exists {
+			return nil, fmt.Errorf("pase desconocido: %q", name)
+		}
+		if !p.Disabled[name] {
+			passes = append(passes, pass)
+		}
+	}
+	return passes, nil
+}
+
+// removeRedundantSteps elimina pasos sin efecto sobre el resultado: comprobaciones
+// de memoización repetidas sin navegación entre ellas. Los pasos de navegación nunca
+// son redundantes, aunque se repitan (a.a accede a la clave a dos veces).
+func removeRedundantSteps(steps []QueryStep, _ *OptimizationConfig) ([]QueryStep, []string) {
+	if len(steps) <= 1 {
+		return steps, nil
+	}
+
+	var optimized []QueryStep
+	var changes []string
+	for i, step := range steps {
+		if i > 0 && step.Type == StepMemoization && steps[i-1].Type == StepMemoization {
+			changes = append(changes, fmt.Sprintf("eliminó la memoización repetida de %s", step.Target))
+			continue
+		}
+		optimized = append(optimized, step)
+	}
+
+	return optimized, changes
+}
+
+// combineConsecutiveSteps combina pasos consecutivos
+func combineConsecutiveSteps(steps []QueryStep, _ *OptimizationConfig) ([]QueryStep, []string) {
+	if len(steps) <= 1 {
+		return steps, nil
+	}
+
+	var combined []QueryStep
+	var changes []string
+	for i := 0; i < len(steps); i++ {
+		if i+1 < len(steps) && steps[i].Type == StepNavigation && steps[i+1].Type == StepNavigation {
+			// Combinar dos pasos de navegación conservando las claves exactas
+			keys := append(append([]string{}, steps[i].Keys...), steps[i+1].Keys...)
+			combinedStep := QueryStep{
+				Type:          StepCombined,
+				Operation:     "multi_access",
+				Target:        parser.FormatKeys(keys),
+				Keys:          keys,
+				EstimatedTime: steps[i].EstimatedTime + steps[i+1].EstimatedTime,
+			}
+			combined = append(combined, combinedStep)
+			changes = append(changes, fmt.Sprintf("combinó %s y %s en %s", steps[i].Target, steps[i+1].Target, combinedStep.Target))
+			i++ // Saltar el siguiente paso
+		} else {
+			combined = append(combined, steps[i])
+		}
+	}
+
+	return combined, changes
+}
+
+// reorderSteps reordena los pasos para mejor rendimiento.
+//
+// Los pasos de navegación no se pueden reordenar entre sí: cada uno se aplica al
+// valor que produjo el anterior, así que mover los accesos a índice al principio
+// cambia la ruta (a.0.b no es 0.a.b). Los pasos de los tipos actuales conservan su
+// orden; solo un paso que no dependa del valor actual podría adelantarse.
+func reorderSteps(steps []QueryStep, _ *OptimizationConfig) ([]QueryStep, []string) {
+	return steps, nil
+}
+
+// addMemoizationSteps agrega pasos de memoización. Un paso de memoización marca un
+// prefijo de la ruta cuyo valor resuelto el motor guarda en el cache de prefijos: se
+// agrega después de un paso cuando el costo estimado acumulado desde el punto
+// anterior alcanza MemoizationThreshold, así que solo se memorizan prefijos cuya
+// resolución cuesta más que consultarlos. Target es el prefijo memorizado. No agrega
+// un punto donde ya hay uno, así que aplicarlo de nuevo no cambia el plan.
+func addMemoizationSteps(steps []QueryStep, config *OptimizationConfig) ([]QueryStep, []string) {
+	var memoized []QueryStep
+	var changes []string
+	var prefix []string
+	var accumulated time.Duration
+
+	for i, step := range steps {
+		memoized = append(memoized, step)
+		if step.Type == StepMemoization {
+			accumulated = 0
+			continue
+		}
+
+		prefix = append(prefix, step.Keys...)
+		accumulated += step.EstimatedTime
+		if accumulated >= config.MemoizationThreshold && (i+1 == len(steps) || steps[i+1].Type != StepMemoization) {
+			target := parser.FormatKeys(prefix)
+			memoized = append(memoized, QueryStep{
+				Type:      StepMemoization,
+				Operation: "cache_check",
+				Target:    target,
+			})
+			changes = append(changes, fmt.Sprintf("memoriza %s (%v estimados)", target, accumulated))
+			accumulated = 0
+		}
+	}
+
+	return memoized, changes
+}
+
+// WithPipeline retorna un optimizador con la misma configuración y otro pipeline,
+// con caches y estadísticas propios; permite comparar pipelines sobre las mismas
+// consultas
+func (o *Optimizer) WithPipeline(pipeline Pipeline) *Optimizer {
+	config := *o.config
+	config.Pipeline = &pipeline
+	return NewOptimizer(&config)
+}
@@ -0,0 +1,135 @@
+package optimizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tipos de paso del plan.
+//
+// Un plan es una secuencia de pasos que se ejecuta sobre el documento partiendo de
+// la raíz. Los pasos de navegación consumen el valor actual y producen el siguiente,
+// por lo que la ruta que recorre el plan es la concatenación de las claves de sus
+// pasos en orden (Path). Los demás pasos no cambian el valor actual.
+const (
+	StepNavigation   = "navigation"          // accede a una clave u índice: Keys tiene un elemento
+	StepDirectAccess = "direct_access"       // accede a un índice numérico: Keys tiene un elemento
+	StepCombined     = "combined_navigation" // accede a varias claves seguidas: Keys tiene dos o más
+	StepMemoization  = "memoization"         // comprueba el cache de resultados: sin claves
+)
+
+// Path retorna la ruta que recorre el plan: las claves de sus pasos de navegación en orden
+func (p *QueryPlan) Path() []string {
+	return planPath(p.Steps)
+}
+
+// SizeBytes retorna el tamaño aproximado del plan en memoria, usado para acotar
+// los caches
+func (p *QueryPlan) SizeBytes() int64 {
+	size := int64(64)
+	for _, step := range p.Steps {
+		size += 96 + int64(len(step.Type)+len(step.Operation)+len(step.Target))
+		for _, key := range step.Keys {
+			size += 16 + int64(len(key))
+		}
+	}
+	for _, name := range p.Optimizations {
+		size += 16 + int64(len(name))
+	}
+	if p.Statistics != nil {
+		size += 96
+		for _, step := range p.Statistics.Steps {
+			size += 48 + int64(len(step.Key))
+		}
+	}
+	return size
+}
+
+// planPath concatena las claves de los pasos
+func planPath(steps []QueryStep) []string {
+	path := []string{}
+	for _, step := range steps {
+		path = append(path, step.Keys...)
+	}
+	return path
+}
+
+// InvariantError indica que un pase de optimización produjo un plan inválido o no
+// equivalente al de entrada. Es un error del optimizador, no de la consulta.
+type InvariantError struct {
+	Pass   string
+	Reason string
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("el pase %s rompió una invariante del plan: %s", e.Pass, e.Reason)
+}
+
+// validateSteps verifica las invariantes estructurales de cada paso según su tipo
+func validateSteps(steps []QueryStep) error {
+	for i, step := range steps {
+		switch step.Type {
+		case StepNavigation:
+			if len(step.Keys) != 1 {
+				return fmt.Errorf("paso %d (%s) tiene %d claves, se esperaba 1", i, step.Type, len(step.Keys))
+			}
+		case StepDirectAccess:
+			if len(step.Keys) != 1 || !isNumeric(step.Keys[0]) {
+				return fmt.Errorf("paso %d (%s) debe tener un único índice numérico: %q", i, step.Type, step.Keys)
+			}
+		case StepCombined:
+			if len(step.Keys) < 2 {
+				return fmt.Errorf("paso %d (%s) tiene %d claves, se esperaban al menos 2", i, step.Type, len(step.Keys))
+			}
+		case StepMemoization:
+			if len(step.Keys) != 0 {
+				return fmt.Errorf("paso %d (%s) no debe navegar: %q", i, step.Type, step.Keys)
+			}
+		default:
+			return fmt.Errorf("paso %d tiene un tipo desconocido %q", i, step.Type)
+		}
+	}
+	return nil
+}
+
+// checkPass verifica las invariantes de un pase: el plan resultante es válido y
+// recorre exactamente la misma ruta que el de entrada. Como cada paso de navegación
+// depende solo del valor que produjo el anterior, dos planes con la misma ruta
+// producen el mismo resultado sobre cualquier documento.
+func checkPass(pass string, before, after []QueryStep) error {
+	if err := validateSteps(after); err != nil {
+		return &InvariantError{Pass: pass, Reason: err.Error()}
+	}
+
+	beforePath, afterPath := planPath(before), planPath(after)
+	if !equalPaths(beforePath, afterPath) {
+		return &InvariantError{
+			Pass:   pass,
+			Reason: fmt.Sprintf("la ruta cambió de [%s] a [%s]", strings.Join(beforePath, " "), strings.Join(afterPath, " ")),
+		}
+	}
+	return nil
+}
+
+// equalPaths compara dos rutas segmento a segmento
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isNumeric verifica si una clave está formada solo por dígitos ASCII
+func isNumeric(key string) bool {
+	for _, ch := range key {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return len(key) > 0
+}
@@ -0,0 +1,141 @@
+package optimizer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"procesador-consultas/limits"
+)
+
+// PlanCachePolicy indica qué identifica a un plan en el cache del optimizador
+type PlanCachePolicy string
+
+const (
+	// PlanCacheByQuery reutiliza el plan de una consulta con cualquier documento: la
+	// ruta que recorre no depende del documento, pero sus estadísticas, su costo y
+	// sus puntos de memoización corresponden al documento con que se creó
+	PlanCacheByQuery PlanCachePolicy = "query"
+	// PlanCacheByShape crea un plan por consulta y forma del documento (ver
+	// ShapeFingerprint), a cambio de recorrer el documento en cada búsqueda
+	PlanCacheByShape PlanCachePolicy = "shape"
+)
+
+// ParsePlanCachePolicy convierte el nombre de una política; "" es PlanCacheByQuery
+func ParsePlanCachePolicy(name string) (PlanCachePolicy, error) {
+	switch PlanCachePolicy(name) {
+	case "", PlanCacheByQuery:
+		return PlanCacheByQuery, nil
+	case PlanCacheByShape:
+		return PlanCacheByShape, nil
+	}
+	return "", fmt.Errorf("política de cache de planes desconocida: %q (se esperaba %q o %q)", name, PlanCacheByQuery, PlanCacheByShape)
+}
+
+// Huellas de los valores escalares, por tipo
+var scalarShapes = map[string][sha256.Size]byte{
+	"null":    sha256.Sum256([]byte("null")),
+	"boolean": sha256.Sum256([]byte("boolean")),
+	"number":  sha256.Sum256([]byte("number")),
+	"string":  sha256.Sum256([]byte("string")),
+}
+
+// ShapeFingerprint retorna la huella estructural de un documento decodificado:
+// depende de las claves de los objetos y de los tipos de los valores, no de los
+// valores. Los elementos de un arreglo aportan el conjunto de sus formas, sin
+// importar cuántos hay ni su orden, así que {"a":[1,2]} y {"a":[3]} tienen la misma
+// huella y {"a":["x"]} no. Aplica los mismos límites de recursos que el AST.
+func (o *Optimizer) ShapeFingerprint(ctx context.Context, data interface{}) (string, error) {
+	hasher := &shapeHasher{astBuilder: astBuilder{ctx: ctx, limits: o.config.Limits}}
+	sum, err := hasher.hash(data, 0)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// shapeHasher calcula la huella de cada subárbol a partir de las de sus hijos,
+// contando nodos y profundidad como astBuilder
+type shapeHasher struct {
+	astBuilder
+}
+
+// hash retorna la huella del valor
+func (h *shapeHasher) hash(data interface{}, depth int) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	h.nodes++
+	if h.limits.MaxNodes > 0 && h.nodes > h.limits.MaxNodes {
+		return sum, &limits.Error{Kind: limits.KindNodeCount, Limit: int64(h.limits.MaxNodes), Actual: int64(h.nodes)}
+	}
+	if h.nodes%astCheckInterval == 0 {
+		if err := h.ctx.Err(); err != nil {
+			return sum, err
+		}
+	}
+
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if err := h.enter(depth); err != nil {
+			return sum, err
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		digest := sha256.New()
+		digest.Write([]byte("object"))
+		for _, key := range keys {
+			child, err := h.hash(v[key], depth+1)
+			if err != nil {
+				return sum, err
+			}
+			fmt.Fprintf(digest, "%d:%s", len(key), key)
+			digest.Write(child[:])
+		}
+		copy(sum[:], digest.Sum(nil))
+
+	case []interface{}:
+		if err := h.enter(depth); err != nil {
+			return sum, err
+		}
+		// Conjunto de formas de los elementos, ordenado
+		var children [][sha256.Size]byte
+		seen := make(map[[sha256.Size]byte]bool)
+		for _, item := range v {
+			child, err := h.hash(item, depth+1)
+			if err != nil {
+				return sum, err
+			}
+			if !seen[child] {
+				seen[child] = true
+				children = append(children, child)
+			}
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return bytes.Compare(children[i][:], children[j][:]) < 0
+		})
+
+		digest := sha256.New()
+		digest.Write([]byte("array"))
+		for _, child := range children {
+			digest.Write(child[:])
+		}
+		copy(sum[:], digest.Sum(nil))
+
+	case nil:
+		sum = scalarShapes["null"]
+	case bool:
+		sum = scalarShapes["boolean"]
+	case string:
+		sum = scalarShapes["string"]
+	default:
+		sum = scalarShapes["number"]
+	}
+
+	return sum, nil
+}
@@ -0,0 +1,41 @@
+package optimizer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// statsCollector acumula las estadísticas del optimizador con contadores atómicos:
+// las consultas concurrentes los actualizan sin bloquearse y GetStats retorna una
+// copia (snapshot) que no cambia después de retornarse
+type statsCollector struct {
+	totalQueries  atomic.Int64
+	cacheHits     atomic.Int64
+	optimizations atomic.Int64
+	totalTime     atomic.Int64 // nanosegundos
+	memoHits      atomic.Int64
+	memoMisses    atomic.Int64
+}
+
+// recordQuery registra un plan creado y el tiempo que tomó
+func (s *statsCollector) recordQuery(elapsed time.Duration) {
+	s.totalQueries.Add(1)
+	s.totalTime.Add(int64(elapsed))
+}
+
+// snapshot retorna una copia de las estadísticas. Cada contador se lee de forma
+// atómica; el promedio se calcula con los valores leídos.
+func (s *statsCollector) snapshot() OptimizationStats {
+	stats := OptimizationStats{
+		TotalQueries:  s.totalQueries.Load(),
+		CacheHits:     s.cacheHits.Load(),
+		Optimizations: s.optimizations.Load(),
+		TotalTime:     time.Duration(s.totalTime.Load()),
+		MemoHits:      s.memoHits.Load(),
+		MemoMisses:    s.memoMisses.Load(),
+	}
+	if stats.TotalQueries > 0 {
+		stats.AverageTime = stats.TotalTime / time.Duration(stats.TotalQueries)
+	}
+	return stats
+}
@@ -0,0 +1,34 @@
+package parser
+
+import "procesador-consultas/queryerr"
+
+// SegmentKind indica cómo se escribió un segmento de la ruta
+type SegmentKind string
+
+const (
+	// SegmentName es una clave: identificador o cadena entre comillas
+	SegmentName SegmentKind = "name"
+	// SegmentIndex es un índice numérico: a.0 o a[0]
+	SegmentIndex SegmentKind = "index"
+)
+
+// Segment es un paso de la ruta con su ubicación en la consulta
+type Segment struct {
+	Key  string        `json:"key"`
+	Kind SegmentKind   `json:"kind"`
+	Span queryerr.Span `json:"span"`
+}
+
+// Query es el árbol sintáctico de una consulta: la ruta de segmentos a recorrer
+type Query struct {
+	Segments []Segment `json:"segments"`
+}
+
+// Keys retorna las claves de la ruta en el formato que usan los motores
+func (q *Query) Keys() []string {
+	keys := make([]string, len(q.Segments))
+	for i, segment := range q.Segments {
+		keys[i] = segment.Key
+	}
+	return keys
+}
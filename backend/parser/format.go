@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"procesador-consultas/lexer"
+)
+
+// Format retorna la forma canónica de una consulta:
+//
+//   - sin espacios en blanco;
+//   - las claves que cumplen la regla de identificadores se escriben sin comillas
+//     y separadas por punto (usuario.nombre);
+//   - los segmentos formados solo por dígitos se escriben como índice (items[0]),
+//     ya que los motores los resuelven igual que a.0 o a["0"];
+//   - el resto de las claves se escriben entre comillas con los escapes de JSON
+//     (config."a.b", datos."con espacio").
+//
+// Dos consultas que recorren la misma ruta tienen la misma forma canónica y
+// Parse(Format(q)) produce las mismas claves que q.
+func Format(query *Query) string {
+	return FormatKeys(query.Keys())
+}
+
+// FormatKeys retorna la forma canónica de una ruta ya parseada
+func FormatKeys(keys []string) string {
+	var b strings.Builder
+	for i, key := range keys {
+		if isIndex(key) {
+			b.WriteString("[" + key + "]")
+			continue
+		}
+
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		if lexer.IsIdentifier(key) {
+			b.WriteString(key)
+		} else {
+			b.WriteString(quote(key))
+		}
+	}
+	return b.String()
+}
+
+// CanonicalKey retorna la clave con la que se identifican las rutas en caches y pools.
+// A diferencia de unir las claves con ".", no colisiona para claves que contienen puntos.
+func CanonicalKey(keys []string) string {
+	return FormatKeys(keys)
+}
+
+// isIndex verifica si la clave está formada solo por dígitos ASCII
+func isIndex(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '0' || key[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// quote escribe la clave como cadena JSON sin escapar caracteres HTML
+func quote(key string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(key)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
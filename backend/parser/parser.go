@@ -2,15 +2,20 @@ package parser
 
 import (
 	"fmt"
+	"strings"
+	"unicode/utf8"
+
 	"procesador-consultas/lexer"
+	"procesador-consultas/queryerr"
 )
 
 // Parser representa el analizador sintáctico
 type Parser struct {
-	l         *lexer.Lexer
-	curToken  lexer.Token
-	peekToken lexer.Token
-	errors    []string
+	l           *lexer.Lexer
+	curToken    lexer.Token
+	peekToken   lexer.Token
+	errors      []string
+	diagnostics []queryerr.SyntaxDiagnostic
 }
 
 // NewParser crea un nuevo analizador sintáctico
@@ -56,9 +61,7 @@ func (p *Parser) expectPeek(t lexer.TokenType) bool {
 
 // peekError agrega un error de parsing
 func (p *Parser) peekError(t lexer.TokenType) {
-	msg := fmt.Sprintf("se esperaba el siguiente token %v, se obtuvo %v en línea %d, columna %d",
-		t, p.peekToken.Type, p.peekToken.Line, p.peekToken.Column)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, []lexer.TokenType{t})
 }
 
 // Errors retorna los errores de parsing
@@ -66,41 +69,233 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
-// ParseQuery parsea una consulta y retorna una lista de claves
-func (p *Parser) ParseQuery() ([]string, error) {
-	var keys []string
+// Diagnostics retorna los errores de parsing con su ubicación y los tokens esperados
+func (p *Parser) Diagnostics() []queryerr.SyntaxDiagnostic {
+	return p.diagnostics
+}
+
+// position retorna la posición de un token en la consulta
+func position(tok lexer.Token) queryerr.Position {
+	return queryerr.Position{Offset: tok.Offset, Line: tok.Line, Column: tok.Column}
+}
+
+// span retorna el fragmento de la consulta que ocupa un token
+func span(tok lexer.Token) queryerr.Span {
+	end := position(tok)
+	end.Offset += len(tok.Literal)
+	end.Column += utf8.RuneCountInString(tok.Literal)
+	return queryerr.Span{Start: position(tok), End: end}
+}
 
-	// La consulta debe empezar con un identificador
-	if !p.curTokenIs(lexer.TOKEN_IDENTIFIER) {
-		return nil, fmt.Errorf("se esperaba un identificador, se obtuvo %v", p.curToken.Type)
+// describeToken retorna el nombre legible de un tipo de token
+func describeToken(t lexer.TokenType) string {
+	switch t {
+	case lexer.TOKEN_IDENTIFIER:
+		return "identificador"
+	case lexer.TOKEN_DOT:
+		return "'.'"
+	case lexer.TOKEN_NUMBER:
+		return "número"
+	case lexer.TOKEN_EOF:
+		return "fin de la consulta"
+	case lexer.TOKEN_STRING:
+		return "cadena"
+	case lexer.TOKEN_LBRACKET:
+		return "'['"
+	case lexer.TOKEN_RBRACKET:
+		return "']'"
+	default:
+		return "carácter inválido"
 	}
+}
 
-	// Agregar el primer identificador
-	keys = append(keys, p.curToken.Literal)
+// describeFound retorna cómo se menciona en los mensajes el token encontrado
+func describeFound(tok lexer.Token) string {
+	switch tok.Type {
+	case lexer.TOKEN_IDENTIFIER, lexer.TOKEN_NUMBER:
+		return fmt.Sprintf("%s %q", describeToken(tok.Type), tok.Literal)
+	case lexer.TOKEN_STRING:
+		return fmt.Sprintf("%s %s", describeToken(tok.Type), tok.Literal)
+	}
+	return describeToken(tok.Type)
+}
 
-	// Continuar mientras haya puntos seguidos de identificadores o números
-	for p.peekTokenIs(lexer.TOKEN_DOT) {
-		// Consumir el punto
-		p.nextToken()
+// addError registra un token inesperado junto con el conjunto de tokens esperados
+func (p *Parser) addError(tok lexer.Token, expected []lexer.TokenType) {
+	names := make([]string, len(expected))
+	for i, t := range expected {
+		names[i] = describeToken(t)
+	}
+
+	alternatives := names[len(names)-1]
+	if len(names) > 1 {
+		alternatives = strings.Join(names[:len(names)-1], ", ") + " o " + alternatives
+	}
+
+	message := fmt.Sprintf("se esperaba %s, se obtuvo %s en línea %d, columna %d",
+		alternatives, describeFound(tok), tok.Line, tok.Column)
+	p.errors = append(p.errors, message)
+	p.diagnostics = append(p.diagnostics, queryerr.SyntaxDiagnostic{
+		Message:  message,
+		Span:     span(tok),
+		Expected: names,
+		Found:    describeFound(tok),
+	})
+}
+
+// addLexerError registra un token inválido del lexer. Los caracteres inválidos
+// consecutivos se agrupan en un único diagnóstico.
+func (p *Parser) addLexerError(tok lexer.Token) {
+	if n := len(p.diagnostics); n > 0 {
+		last := &p.diagnostics[n-1]
+		if last.Found == describeToken(lexer.TOKEN_ERROR) && last.Span.End.Offset == tok.Offset {
+			last.Span.End = span(tok).End
+			last.Message = fmt.Sprintf("caracteres inesperados %q en línea %d, columna %d",
+				p.l.Slice(last.Span.Start.Offset, last.Span.End.Offset), last.Span.Start.Line, last.Span.Start.Column)
+			p.errors[len(p.errors)-1] = last.Message
+			return
+		}
+	}
+
+	message := fmt.Sprintf("%s en línea %d, columna %d", tok.Message, tok.Line, tok.Column)
+	p.errors = append(p.errors, message)
+	p.diagnostics = append(p.diagnostics, queryerr.SyntaxDiagnostic{
+		Message: message,
+		Span:    span(tok),
+		Found:   describeToken(lexer.TOKEN_ERROR),
+	})
+}
+
+// ParseQuery parsea una consulta y retorna una lista de claves.
+// Los errores retornados son de tipo *queryerr.Error con código syntax_error y
+// la lista completa en Diagnostics.
+func (p *Parser) ParseQuery() ([]string, error) {
+	query, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return query.Keys(), nil
+}
+
+// Parse parsea una consulta y retorna su árbol sintáctico. La gramática es:
+//
+//	consulta  = primero { acceso }
+//	primero   = IDENTIFICADOR | CADENA | corchetes
+//	acceso    = "." ( IDENTIFICADOR | NÚMERO | CADENA ) | corchetes
+//	corchetes = "[" ( NÚMERO | CADENA ) "]"
+//
+// El parser se recupera de los errores para reportarlos todos en una sola pasada:
+// los caracteres inválidos se descartan, un punto sin segmento se ignora y dos
+// segmentos sin punto entre ellos se tratan como si el punto estuviera presente.
+// Aun con errores, la consulta retornada contiene los segmentos recuperados.
+func (p *Parser) Parse() (*Query, error) {
+	query := &Query{}
+
+	// Al inicio solo se acepta un identificador o cadena; después de un punto, también números
+	expectSegment := true
+	segmentTypes := []lexer.TokenType{lexer.TOKEN_IDENTIFIER, lexer.TOKEN_STRING, lexer.TOKEN_LBRACKET}
 
-		// Verificar que después del punto haya un identificador o número
-		if !p.peekTokenIs(lexer.TOKEN_IDENTIFIER) && !p.peekTokenIs(lexer.TOKEN_NUMBER) {
-			return nil, fmt.Errorf("se esperaba un identificador o número después del punto")
+	for ; !p.curTokenIs(lexer.TOKEN_EOF); p.nextToken() {
+		tok := p.curToken
+
+		if tok.Type == lexer.TOKEN_ERROR {
+			p.addLexerError(tok)
+			continue
+		}
+
+		if tok.Type == lexer.TOKEN_LBRACKET {
+			if expectSegment && len(query.Segments) > 0 {
+				// "a.[0]": el punto sobra
+				p.addError(tok, segmentTypes)
+			}
+			if p.parseBrackets(query) {
+				expectSegment = false
+			}
+			continue
+		}
+
+		if expectSegment {
+			isSegment := tok.Type == lexer.TOKEN_IDENTIFIER || tok.Type == lexer.TOKEN_STRING ||
+				(tok.Type == lexer.TOKEN_NUMBER && len(query.Segments) > 0)
+			if !isSegment {
+				p.addError(tok, segmentTypes)
+			}
+			if isSegment || tok.Type == lexer.TOKEN_NUMBER {
+				// Un número al inicio se conserva como segmento para seguir analizando
+				p.addSegment(query, tok)
+				expectSegment = false
+			}
+			continue
+		}
+
+		switch tok.Type {
+		case lexer.TOKEN_DOT:
+			expectSegment = true
+			segmentTypes = []lexer.TokenType{lexer.TOKEN_IDENTIFIER, lexer.TOKEN_NUMBER, lexer.TOKEN_STRING}
+		case lexer.TOKEN_IDENTIFIER, lexer.TOKEN_NUMBER, lexer.TOKEN_STRING:
+			// Falta el punto entre dos segmentos
+			p.addError(tok, []lexer.TokenType{lexer.TOKEN_DOT, lexer.TOKEN_LBRACKET, lexer.TOKEN_EOF})
+			p.addSegment(query, tok)
+		default:
+			p.addError(tok, []lexer.TokenType{lexer.TOKEN_DOT, lexer.TOKEN_LBRACKET, lexer.TOKEN_EOF})
 		}
+	}
 
-		// Consumir el identificador o número
+	// La consulta no puede terminar esperando un segmento (vacía o con punto final)
+	if expectSegment {
+		p.addError(p.curToken, segmentTypes)
+	}
+
+	if len(p.diagnostics) > 0 {
+		return query, queryerr.SyntaxErrors(p.diagnostics)
+	}
+
+	return query, nil
+}
+
+// parseBrackets parsea "[" ( NÚMERO | CADENA ) "]" con curToken en el corchete de
+// apertura. Retorna true si se pudo agregar el segmento.
+func (p *Parser) parseBrackets(query *Query) bool {
+	skipped := false
+	for p.peekTokenIs(lexer.TOKEN_ERROR) {
 		p.nextToken()
+		p.addLexerError(p.curToken)
+		skipped = true
+	}
 
-		// Agregar el identificador o número
-		keys = append(keys, p.curToken.Literal)
+	if !p.peekTokenIs(lexer.TOKEN_NUMBER) && !p.peekTokenIs(lexer.TOKEN_STRING) {
+		// Si el contenido ya se reportó como inválido, no repetir el error
+		if !skipped || !p.peekTokenIs(lexer.TOKEN_RBRACKET) {
+			p.addError(p.peekToken, []lexer.TokenType{lexer.TOKEN_NUMBER, lexer.TOKEN_STRING})
+		}
+		if p.peekTokenIs(lexer.TOKEN_RBRACKET) {
+			p.nextToken()
+		}
+		return false
 	}
 
-	// Verificar que terminamos con EOF
-	if !p.peekTokenIs(lexer.TOKEN_EOF) {
-		return nil, fmt.Errorf("caracteres inesperados al final de la consulta")
+	p.nextToken()
+	p.addSegment(query, p.curToken)
+
+	if p.peekTokenIs(lexer.TOKEN_RBRACKET) {
+		p.nextToken()
+	} else {
+		p.addError(p.peekToken, []lexer.TokenType{lexer.TOKEN_RBRACKET})
 	}
+	return true
+}
 
-	return keys, nil
+// addSegment agrega a la consulta el segmento que representa un token
+func (p *Parser) addSegment(query *Query, tok lexer.Token) {
+	segment := Segment{Key: tok.Literal, Kind: SegmentName, Span: span(tok)}
+	switch tok.Type {
+	case lexer.TOKEN_NUMBER:
+		segment.Kind = SegmentIndex
+	case lexer.TOKEN_STRING:
+		// El lexer ya validó la cadena
+		segment.Key, _ = lexer.Unquote(tok.Literal)
+	}
+	query.Segments = append(query.Segments, segment)
 }
 
 // ParseQueryString parsea una cadena de consulta directamente
@@ -113,9 +308,10 @@ func ParseQueryString(query string) ([]string, error) {
 		return nil, err
 	}
 
-	if len(p.errors) > 0 {
-		return nil, fmt.Errorf("errores de parsing: %v", p.errors)
-	}
-
 	return keys, nil
 }
+
+// Parse parsea una cadena de consulta y retorna su árbol sintáctico
+func Parse(query string) (*Query, error) {
+	return NewParser(lexer.NewLexer(query)).Parse()
+}
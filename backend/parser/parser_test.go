@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+// validQueries son formas de consulta que el parser acepta: claves entre comillas
+// con escapes, corchetes, identificadores Unicode, índices con ceros a la izquierda,
+// claves vacías y espacios entre segmentos
+var validQueries = []string{
+	"a", "usuario.nombre", "a.b.c.d.e", "items.0", "items[0]", "items[0][1]", "a.b.0",
+	`config."a.b"`, `datos["a.b"]`, `a . "b" [0]`, "a\n.\tb", " a ", "a[01]", "a.007",
+	`"".x`, `x[""]`, `["k"]`, "[0]", `"a"`, `a["0"]`, `a."\"x\""`, `a["\u00f1"]`, `a["\n\t\\\/"]`,
+	`a["x y"]`, `a["<&>"]`, "usuario.año", "número.名前", "é́", "x٣", "_", "_a1", "a.a",
+}
+
+// invalidQueries son formas de consulta que el parser rechaza: separadores sin
+// segmento, corchetes sin abrir o sin cerrar, cadenas sin terminar, escapes
+// inválidos y bytes fuera de la gramática
+var invalidQueries = []string{
+	"", " ", "a..b", ".a", "a.", "a[", "a[0", "a]", "a[]", "a[-1]", "a[x]", "a.[0]",
+	`a["b`, `"a`, `a."\x"`, `a["\u00g1"]`, "a.\"\x01\"", "a b", "a$", "a-b", "🙂", "٣",
+	"\x00", "a\xff", "a.\xc3", "a[0]]", "a[[0]]",
+}
+
+// TestSeedQueries verifica que el corpus inicial de FuzzParser esté bien clasificado
+func TestSeedQueries(t *testing.T) {
+	for _, input := range validQueries {
+		if _, err := Parse(input); err != nil {
+			t.Errorf("%q debería ser válida: %v", input, err)
+		}
+	}
+	for _, input := range invalidQueries {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%q debería ser inválida", input)
+		}
+	}
+}
+
+// FuzzParser verifica que la forma canónica de las consultas válidas sea estable:
+// parsear Format(q) produce las mismas claves y la misma forma canónica, y
+// ParseQueryString retorna las claves del árbol sintáctico. Sin -fuzz ejecuta solo
+// el corpus inicial.
+//
+//	go test ./parser -fuzz FuzzParser -fuzztime 30s
+func FuzzParser(f *testing.F) {
+	for _, input := range validQueries {
+		f.Add(input)
+	}
+	for _, input := range invalidQueries {
+		f.Add(input)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		query, err := Parse(input)
+		if err != nil {
+			if _, err := ParseQueryString(input); err == nil {
+				t.Fatalf("entrada %q: Parse falló y ParseQueryString no", input)
+			}
+			return
+		}
+
+		keys, err := ParseQueryString(input)
+		if err != nil || !reflect.DeepEqual(keys, query.Keys()) {
+			t.Fatalf("entrada %q: ParseQueryString retornó %q (%v), el árbol %q", input, keys, err, query.Keys())
+		}
+
+		canonical := Format(query)
+		again, err := Parse(canonical)
+		if err != nil {
+			t.Fatalf("entrada %q: la forma canónica %q no se puede parsear: %v", input, canonical, err)
+		}
+		if !reflect.DeepEqual(query.Keys(), again.Keys()) || Format(again) != canonical {
+			t.Fatalf("entrada %q: la forma canónica %q cambia las claves %q por %q o se formatea como %q",
+				input, canonical, query.Keys(), again.Keys(), Format(again))
+		}
+	})
+}
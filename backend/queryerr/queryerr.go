@@ -0,0 +1,209 @@
+package queryerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"procesador-consultas/limits"
+)
+
+// Code es el código de error legible por máquina
+type Code string
+
+const (
+	CodeInvalidRequest  Code = "invalid_request"
+	CodeSyntax          Code = "syntax_error"
+	CodeInvalidDocument Code = "invalid_document"
+	CodePathNotFound    Code = "path_not_found"
+	CodeCanceled        Code = "canceled"
+	CodeInternal        Code = "internal_error"
+	CodeInvalidSchema   Code = "invalid_schema"
+	CodeValidation      Code = "validation_failed"
+
+	// Códigos de límites de recursos (ver limits.Kind)
+	CodeLimitBodySize   Code = "limit_body_size"
+	CodeLimitDepth      Code = "limit_depth"
+	CodeLimitNodeCount  Code = "limit_node_count"
+	CodeLimitResultSize Code = "limit_result_size"
+)
+
+// IsLimit indica si el código corresponde a un límite de recursos excedido
+// (limit_body_size, limit_depth, limit_node_count o limit_result_size)
+func (c Code) IsLimit() bool {
+	return strings.HasPrefix(string(c), "limit_")
+}
+
+// Position ubica un error dentro de la consulta o del documento
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Span delimita un fragmento de la consulta; End apunta justo después del último carácter
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// SyntaxDiagnostic describe un problema de sintaxis de la consulta
+type SyntaxDiagnostic struct {
+	Message  string   `json:"message"`
+	Span     Span     `json:"span"`
+	Expected []string `json:"expected,omitempty"`
+	Found    string   `json:"found,omitempty"`
+}
+
+// PathDiagnostic describe hasta dónde se resolvió una ruta inexistente
+type PathDiagnostic struct {
+	ResolvedPrefix []string `json:"resolved_prefix"`
+	FailedSegment  int      `json:"failed_segment"`
+	Segment        string   `json:"segment"`
+	FoundType      string   `json:"found_type"`
+	Reason         string   `json:"reason"`
+	ArrayLength    *int     `json:"array_length,omitempty"`
+	Suggestions    []string `json:"suggestions,omitempty"`
+}
+
+// Razones por las que un segmento no se pudo resolver
+const (
+	ReasonMissingKey       = "missing_key"
+	ReasonIndexOutOfRange  = "index_out_of_range"
+	ReasonNotAnIndex       = "not_an_index"
+	ReasonNotAContainer    = "not_a_container"
+	ReasonUnknownStructure = "unknown_structure"
+)
+
+// Error representa un error tipado de consulta
+type Error struct {
+	Code        Code               `json:"code"`
+	Message     string             `json:"message"`
+	Position    *Position          `json:"position,omitempty"`
+	Segment     *int               `json:"segment,omitempty"`
+	Path        []string           `json:"path,omitempty"`
+	Diagnostic  *PathDiagnostic    `json:"diagnostic,omitempty"`
+	Diagnostics []SyntaxDiagnostic `json:"-"` // se exponen en la respuesta HTTP como "diagnostics"
+	Limit       *limits.Error      `json:"limit,omitempty"`
+	Cause       error              `json:"-"`
+}
+
+// Error implementa la interfaz error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap permite inspeccionar la causa con errors.Is y errors.As
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// New crea un error con código y mensaje
+func New(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Syntax crea un error de sintaxis en la posición indicada de la consulta
+func Syntax(pos Position, format string, args ...interface{}) *Error {
+	return &Error{Code: CodeSyntax, Message: fmt.Sprintf(format, args...), Position: &pos}
+}
+
+// SyntaxErrors agrupa todos los problemas de sintaxis encontrados en una consulta.
+// La posición del error es la del primer diagnóstico.
+func SyntaxErrors(diagnostics []SyntaxDiagnostic) *Error {
+	if len(diagnostics) == 0 {
+		return nil
+	}
+
+	first := diagnostics[0]
+	message := first.Message
+	if len(diagnostics) > 1 {
+		messages := make([]string, len(diagnostics))
+		for i, diagnostic := range diagnostics {
+			messages[i] = diagnostic.Message
+		}
+		message = fmt.Sprintf("%d errores de sintaxis: %s", len(diagnostics), strings.Join(messages, "; "))
+	}
+
+	start := first.Span.Start
+	return &Error{Code: CodeSyntax, Message: message, Position: &start, Diagnostics: diagnostics}
+}
+
+// InvalidDocument crea un error de documento JSON inválido
+func InvalidDocument(cause error) *Error {
+	return &Error{
+		Code:    CodeInvalidDocument,
+		Message: fmt.Sprintf("error parseando JSON: %v", cause),
+		Cause:   cause,
+	}
+}
+
+// PathNotFound crea un error de ruta inexistente indicando el segmento que falló
+func PathNotFound(path []string, segment int) *Error {
+	return &Error{
+		Code:    CodePathNotFound,
+		Message: fmt.Sprintf("no se encontró el valor para la ruta: %v", path),
+		Segment: &segment,
+		Path:    path,
+	}
+}
+
+// WithDiagnostic agrega el diagnóstico de ruta parcial y menciona la primera sugerencia en el mensaje
+func (e *Error) WithDiagnostic(diagnostic *PathDiagnostic) *Error {
+	e.Diagnostic = diagnostic
+	if diagnostic != nil && len(diagnostic.Suggestions) > 0 {
+		e.Message = fmt.Sprintf("%s (¿quisiste decir %q?)", e.Message, diagnostic.Suggestions[0])
+	}
+	return e
+}
+
+// From convierte cualquier error en un *Error, reconociendo los errores de límites
+// y de contexto. Los errores desconocidos se reportan como internos.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var queryErr *Error
+	if errors.As(err, &queryErr) {
+		return queryErr
+	}
+	if limitErr, ok := limits.AsError(err); ok {
+		return &Error{Code: Code(limitErr.Code()), Message: limitErr.Error(), Limit: limitErr, Cause: err}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Code: CodeCanceled, Message: err.Error(), Cause: err}
+	}
+
+	return &Error{Code: CodeInternal, Message: err.Error(), Cause: err}
+}
+
+// CodeOf retorna el código de un error, o una cadena vacía si no hay error
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	return From(err).Code
+}
+
+// PositionAt calcula línea y columna (empezando en 1) de un offset en bytes
+func PositionAt(text string, offset int) Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	line, column := 1, 1
+	for _, ch := range text[:offset] {
+		if ch == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return Position{Offset: offset, Line: line, Column: column}
+}
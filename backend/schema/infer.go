@@ -0,0 +1,211 @@
+package schema
+
+import (
+	"context"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// Nombres de los tipos inferidos (los de JSON Schema)
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeNull    = "null"
+)
+
+// inferCheckInterval indica cada cuántos valores se comprueba el contexto
+const inferCheckInterval = 1024
+
+// IntRange es el rango observado de una longitud (strings y arreglos)
+type IntRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// NumberRange es el rango observado de los valores numéricos
+type NumberRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Schema resume los valores observados en una posición de uno o varios documentos.
+// Los elementos de un arreglo se combinan en un único Items, y las claves de los
+// objetos que aparecen en todos los objetos observados son obligatorias.
+type Schema struct {
+	Types      map[string]int     `json:"types"`
+	Count      int                `json:"count"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Optional   []string           `json:"optional,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	ItemCount  *IntRange          `json:"item_count,omitempty"`
+	Length     *IntRange          `json:"length,omitempty"`
+	Range      *NumberRange       `json:"range,omitempty"`
+}
+
+// Infer resume uno o varios documentos decodificados con encoding/json
+func Infer(samples ...interface{}) *Schema {
+	s, _ := InferContext(context.Background(), samples...)
+	return s
+}
+
+// InferContext resume los documentos comprobando periódicamente el contexto.
+// Retorna el error del contexto si este termina durante el recorrido.
+func InferContext(ctx context.Context, samples ...interface{}) (*Schema, error) {
+	inf := &inferrer{ctx: ctx}
+	root := newSchema()
+	for _, sample := range samples {
+		if err := inf.add(root, sample); err != nil {
+			return nil, err
+		}
+	}
+	root.finish()
+	return root, nil
+}
+
+// inferrer recorre los documentos contando los valores visitados
+type inferrer struct {
+	ctx    context.Context
+	values int
+}
+
+// newSchema crea un resumen vacío
+func newSchema() *Schema {
+	return &Schema{Types: map[string]int{}}
+}
+
+// add combina un valor en el resumen
+func (inf *inferrer) add(s *Schema, value interface{}) error {
+	inf.values++
+	if inf.values%inferCheckInterval == 0 {
+		if err := inf.ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	s.Count++
+	switch v := value.(type) {
+	case map[string]interface{}:
+		s.Types[TypeObject]++
+		if s.Properties == nil {
+			s.Properties = map[string]*Schema{}
+		}
+		for key, child := range v {
+			property, exists := s.Properties[key]
+			if !exists {
+				property = newSchema()
+				s.Properties[key] = property
+			}
+			if err := inf.add(property, child); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		s.Types[TypeArray]++
+		s.ItemCount = widenInt(s.ItemCount, len(v))
+		if s.Items == nil && len(v) > 0 {
+			s.Items = newSchema()
+		}
+		for _, item := range v {
+			if err := inf.add(s.Items, item); err != nil {
+				return err
+			}
+		}
+
+	case string:
+		s.Types[TypeString]++
+		s.Length = widenInt(s.Length, utf8.RuneCountInString(v))
+
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			s.Types[TypeInteger]++
+		} else {
+			s.Types[TypeNumber]++
+		}
+		if s.Range == nil {
+			s.Range = &NumberRange{Min: v, Max: v}
+		}
+		s.Range.Min = math.Min(s.Range.Min, v)
+		s.Range.Max = math.Max(s.Range.Max, v)
+
+	case bool:
+		s.Types[TypeBoolean]++
+
+	case nil:
+		s.Types[TypeNull]++
+	}
+
+	return nil
+}
+
+// widenInt amplía un rango de enteros con un nuevo valor
+func widenInt(r *IntRange, value int) *IntRange {
+	if r == nil {
+		return &IntRange{Min: value, Max: value}
+	}
+	r.Min = min(r.Min, value)
+	r.Max = max(r.Max, value)
+	return r
+}
+
+// finish calcula las claves obligatorias y opcionales de cada objeto
+func (s *Schema) finish() {
+	if s == nil {
+		return
+	}
+
+	objects := s.Types[TypeObject]
+	s.Required, s.Optional = nil, nil
+	for key, property := range s.Properties {
+		if property.Count == objects {
+			s.Required = append(s.Required, key)
+		} else {
+			s.Optional = append(s.Optional, key)
+		}
+		property.finish()
+	}
+	sort.Strings(s.Required)
+	sort.Strings(s.Optional)
+
+	s.Items.finish()
+}
+
+// Has indica si se observó el tipo en esta posición. TypeNumber incluye los enteros.
+func (s *Schema) Has(typeName string) bool {
+	if typeName == TypeNumber && s.Types[TypeInteger] > 0 {
+		return true
+	}
+	return s.Types[typeName] > 0
+}
+
+// TypeNames retorna los tipos observados ordenados alfabéticamente
+func (s *Schema) TypeNames() []string {
+	names := make([]string, 0, len(s.Types))
+	for name := range s.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Keys retorna las claves observadas en los objetos, ordenadas alfabéticamente
+func (s *Schema) Keys() []string {
+	keys := make([]string, 0, len(s.Properties))
+	for key := range s.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IsRequired indica si la clave aparece en todos los objetos observados
+func (s *Schema) IsRequired(key string) bool {
+	i := sort.SearchStrings(s.Required, key)
+	return i < len(s.Required) && s.Required[i] == key
+}
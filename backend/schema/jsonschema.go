@@ -0,0 +1,115 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Draft2020 es el identificador del dialecto de JSON Schema que se exporta
+const Draft2020 = "https://json-schema.org/draft/2020-12/schema"
+
+// TypeList es el valor de la palabra clave "type": un tipo o una lista de tipos
+type TypeList []string
+
+// MarshalJSON escribe un único tipo como cadena y varios como arreglo
+func (t TypeList) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON acepta tanto "string" como ["string", "null"]
+func (t *TypeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = TypeList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type debe ser una cadena o un arreglo de cadenas")
+	}
+	*t = list
+	return nil
+}
+
+// JSONSchema es un documento de JSON Schema con las palabras clave que se exportan
+// y validan: type, properties, required, items, enum, rangos y pattern
+type JSONSchema struct {
+	Schema     string                 `json:"$schema,omitempty"`
+	Type       TypeList               `json:"type,omitempty"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *JSONSchema            `json:"items,omitempty"`
+	Enum       []interface{}          `json:"enum,omitempty"`
+	Minimum    *float64               `json:"minimum,omitempty"`
+	Maximum    *float64               `json:"maximum,omitempty"`
+	MinLength  *int                   `json:"minLength,omitempty"`
+	MaxLength  *int                   `json:"maxLength,omitempty"`
+	MinItems   *int                   `json:"minItems,omitempty"`
+	MaxItems   *int                   `json:"maxItems,omitempty"`
+	Pattern    string                 `json:"pattern,omitempty"`
+}
+
+// ExportOptions configura la exportación a JSON Schema
+type ExportOptions struct {
+	// Ranges exporta los rangos observados como minimum/maximum, minLength/maxLength
+	// y minItems/maxItems. Sin ellos el esquema solo restringe tipos y claves.
+	Ranges bool
+}
+
+// JSONSchema exporta el resumen como JSON Schema draft 2020-12
+func (s *Schema) JSONSchema(options ExportOptions) *JSONSchema {
+	exported := s.export(options)
+	exported.Schema = Draft2020
+	return exported
+}
+
+// export convierte recursivamente el resumen en un esquema
+func (s *Schema) export(options ExportOptions) *JSONSchema {
+	exported := &JSONSchema{Type: s.jsonTypes()}
+
+	if s.Has(TypeObject) {
+		exported.Properties = make(map[string]*JSONSchema, len(s.Properties))
+		for key, property := range s.Properties {
+			exported.Properties[key] = property.export(options)
+		}
+		exported.Required = s.Required
+	}
+
+	if s.Has(TypeArray) && s.Items != nil {
+		exported.Items = s.Items.export(options)
+	}
+
+	if options.Ranges {
+		if s.Range != nil {
+			minimum, maximum := s.Range.Min, s.Range.Max
+			exported.Minimum, exported.Maximum = &minimum, &maximum
+		}
+		if s.Length != nil {
+			minLength, maxLength := s.Length.Min, s.Length.Max
+			exported.MinLength, exported.MaxLength = &minLength, &maxLength
+		}
+		if s.ItemCount != nil {
+			minItems, maxItems := s.ItemCount.Min, s.ItemCount.Max
+			exported.MinItems, exported.MaxItems = &minItems, &maxItems
+		}
+	}
+
+	return exported
+}
+
+// jsonTypes retorna los tipos observados; "integer" se omite si también hay "number"
+// porque en JSON Schema los enteros ya son números
+func (s *Schema) jsonTypes() TypeList {
+	var types TypeList
+	for _, name := range s.TypeNames() {
+		if name == TypeInteger && s.Types[TypeNumber] > 0 {
+			continue
+		}
+		types = append(types, name)
+	}
+	return types
+}
@@ -0,0 +1,181 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// decodeAll decodifica documentos de prueba como lo hacen los handlers
+func decodeAll(t *testing.T, raws ...string) []interface{} {
+	t.Helper()
+	samples := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		if err := json.Unmarshal([]byte(raw), &samples[i]); err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+	}
+	return samples
+}
+
+// assertJSON compara la serialización de got con el JSON esperado, sin importar el
+// orden de las claves
+func assertJSON(t *testing.T, got interface{}, want string) {
+	t.Helper()
+	raw, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(raw, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("JSON esperado inválido: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("se obtuvo\n  %s\nse esperaba\n  %s", raw, want)
+	}
+}
+
+// TestInfer verifica el resumen inferido: tipos, conteos, claves obligatorias y
+// opcionales y rangos
+func TestInfer(t *testing.T) {
+	cases := []struct {
+		name    string
+		samples []string
+		want    string
+	}{
+		{
+			"claves obligatorias y opcionales entre elementos",
+			[]string{`[{"a": 1, "b": "x"}, {"a": 2}]`},
+			`{"types": {"array": 1}, "count": 1, "item_count": {"min": 2, "max": 2},
+			  "items": {"types": {"object": 2}, "count": 2, "required": ["a"], "optional": ["b"], "properties": {
+			    "a": {"types": {"integer": 2}, "count": 2, "range": {"min": 1, "max": 2}},
+			    "b": {"types": {"string": 1}, "count": 1, "length": {"min": 1, "max": 1}}}}}`,
+		},
+		{
+			"elementos de tipos mezclados",
+			[]string{`[1, 2.5, "ñandú", null, true, {"k": []}]`},
+			`{"types": {"array": 1}, "count": 1, "item_count": {"min": 6, "max": 6},
+			  "items": {"types": {"integer": 1, "number": 1, "string": 1, "null": 1, "boolean": 1, "object": 1}, "count": 6,
+			    "range": {"min": 1, "max": 2.5}, "length": {"min": 5, "max": 5}, "required": ["k"], "properties": {
+			    "k": {"types": {"array": 1}, "count": 1, "item_count": {"min": 0, "max": 0}}}}}`,
+		},
+		{
+			"varias muestras",
+			[]string{`{"a": 1}`, `{"a": "x", "b": null}`},
+			`{"types": {"object": 2}, "count": 2, "required": ["a"], "optional": ["b"], "properties": {
+			    "a": {"types": {"integer": 1, "string": 1}, "count": 2, "range": {"min": 1, "max": 1}, "length": {"min": 1, "max": 1}},
+			    "b": {"types": {"null": 1}, "count": 1}}}`,
+		},
+		{
+			"arreglos anidados",
+			[]string{`{"m": [[1, 2], []]}`},
+			`{"types": {"object": 1}, "count": 1, "required": ["m"], "properties": {
+			    "m": {"types": {"array": 1}, "count": 1, "item_count": {"min": 2, "max": 2}, "items": {
+			      "types": {"array": 2}, "count": 2, "item_count": {"min": 0, "max": 2}, "items": {
+			        "types": {"integer": 2}, "count": 2, "range": {"min": 1, "max": 2}}}}}}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertJSON(t, Infer(decodeAll(t, tc.samples...)...), tc.want)
+		})
+	}
+}
+
+// TestJSONSchema verifica el esquema exportado con y sin rangos
+func TestJSONSchema(t *testing.T) {
+	cases := []struct {
+		name    string
+		samples []string
+		ranges  bool
+		want    string
+	}{
+		{
+			"objetos en un arreglo",
+			[]string{`[{"a": 1, "b": "x"}, {"a": 2}]`},
+			false,
+			`{"$schema": "` + Draft2020 + `", "type": "array", "items": {"type": "object", "required": ["a"], "properties": {
+			    "a": {"type": "integer"}, "b": {"type": "string"}}}}`,
+		},
+		{
+			"objetos en un arreglo con rangos",
+			[]string{`[{"a": 1, "b": "x"}, {"a": 2}]`},
+			true,
+			`{"$schema": "` + Draft2020 + `", "type": "array", "minItems": 2, "maxItems": 2, "items": {"type": "object", "required": ["a"], "properties": {
+			    "a": {"type": "integer", "minimum": 1, "maximum": 2}, "b": {"type": "string", "minLength": 1, "maxLength": 1}}}}`,
+		},
+		{
+			// integer se omite porque number ya lo incluye
+			"tipos mezclados",
+			[]string{`[1, 2.5, "x", null, {"k": true}]`},
+			false,
+			`{"$schema": "` + Draft2020 + `", "type": "array", "items": {"type": ["null", "number", "object", "string"],
+			    "required": ["k"], "properties": {"k": {"type": "boolean"}}}}`,
+		},
+		{
+			"arreglo vacío y objeto vacío",
+			[]string{`{"vacio": [], "obj": {}}`},
+			false,
+			`{"$schema": "` + Draft2020 + `", "type": "object", "required": ["obj", "vacio"], "properties": {
+			    "obj": {"type": "object"}, "vacio": {"type": "array"}}}`,
+		},
+		{
+			"clave opcional entre muestras",
+			[]string{`{"id": 1, "nota": "x"}`, `{"id": 2.5}`},
+			false,
+			`{"$schema": "` + Draft2020 + `", "type": "object", "required": ["id"], "properties": {
+			    "id": {"type": "number"}, "nota": {"type": "string"}}}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			exported := Infer(decodeAll(t, tc.samples...)...).JSONSchema(ExportOptions{Ranges: tc.ranges})
+			assertJSON(t, exported, tc.want)
+
+			// El esquema exportado se puede leer de nuevo
+			raw, err := json.Marshal(exported)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded JSONSchema
+			if err := json.Unmarshal(raw, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, &decoded, tc.want)
+		})
+	}
+}
+
+// TestTypeList verifica que type acepte una cadena o un arreglo y se escriba igual
+func TestTypeList(t *testing.T) {
+	for _, raw := range []string{`"string"`, `["string","null"]`} {
+		var types TypeList
+		if err := json.Unmarshal([]byte(raw), &types); err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if encoded, err := json.Marshal(types); err != nil || string(encoded) != raw {
+			t.Errorf("%s se escribe como %s (%v)", raw, encoded, err)
+		}
+	}
+
+	var types TypeList
+	if err := json.Unmarshal([]byte(`1`), &types); err == nil {
+		t.Error("type numérico debería rechazarse")
+	}
+}
+
+// TestInferContextCanceled verifica que la inferencia se detenga al cancelar el contexto
+func TestInferContextCanceled(t *testing.T) {
+	document := make([]interface{}, 4*inferCheckInterval)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if s, err := InferContext(ctx, document); err != context.Canceled || s != nil {
+		t.Errorf("se esperaba context.Canceled sin resumen, se obtuvo %v (%v)", err, s)
+	}
+}
@@ -0,0 +1,98 @@
+package suggest
+
+import (
+	"sort"
+	"strings"
+)
+
+// MaxSuggestions es el número máximo de claves sugeridas
+const MaxSuggestions = 5
+
+// Keys retorna las claves candidatas más parecidas al segmento según la distancia de
+// edición, sin distinguir mayúsculas, ordenadas de la más cercana a la más lejana
+func Keys(segment string, candidates []string) []string {
+	type scored struct {
+		key      string
+		distance int
+	}
+
+	threshold := suggestionThreshold(segment)
+	lowered := strings.ToLower(segment)
+
+	var matches []scored
+	for _, candidate := range candidates {
+		distance := EditDistance(lowered, strings.ToLower(candidate))
+		if distance <= threshold {
+			matches = append(matches, scored{key: candidate, distance: distance})
+		}
+	}
+
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].distance != matches[b].distance {
+			return matches[a].distance < matches[b].distance
+		}
+		return matches[a].key < matches[b].key
+	})
+
+	if len(matches) > MaxSuggestions {
+		matches = matches[:MaxSuggestions]
+	}
+
+	suggestions := make([]string, 0, len(matches))
+	for _, match := range matches {
+		suggestions = append(suggestions, match.key)
+	}
+	return suggestions
+}
+
+// suggestionThreshold retorna la distancia máxima aceptada según la longitud del segmento
+func suggestionThreshold(segment string) int {
+	length := len([]rune(segment))
+	switch {
+	case length <= 4:
+		return 1
+	case length <= 8:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// EditDistance calcula la distancia de Damerau-Levenshtein restringida (alineamiento
+// óptimo de cadenas) entre dos cadenas, contando como una sola edición la
+// transposición de dos caracteres adyacentes ("nmae" -> "name")
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+	if len(rb) == 0 {
+		return len(ra)
+	}
+
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := 0; j <= len(rb); j++ {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			best := min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				best = min(best, rows[i-2][j-2]+1)
+			}
+			rows[i][j] = best
+		}
+	}
+
+	return rows[len(ra)][len(rb)]
+}
@@ -0,0 +1,58 @@
+package suggest
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestEditDistance verifica la distancia con inserciones, borrados, sustituciones
+// y transposiciones, contando caracteres y no bytes
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"name", "name", 0},
+		{"nmae", "name", 1},
+		{"nam", "name", 1},
+		{"names", "name", 1},
+		{"nane", "name", 1},
+		{"año", "ano", 1},
+		{"ca", "abc", 3}, // alineamiento óptimo: la transposición no se combina con otra edición
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tc := range cases {
+		if got := EditDistance(tc.a, tc.b); got != tc.want {
+			t.Errorf("EditDistance(%q, %q) = %d, se esperaba %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+// TestKeys verifica el umbral por longitud, el orden y el máximo de sugerencias
+func TestKeys(t *testing.T) {
+	cases := []struct {
+		segment    string
+		candidates []string
+		want       []string
+	}{
+		{"nmae", []string{"name", "age", "email"}, []string{"name"}},
+		{"NAME", []string{"name"}, []string{"name"}},
+		// Hasta 4 caracteres se acepta una edición; hasta 8, dos; más, tres
+		{"ab", []string{"abcd"}, []string{}},
+		{"nombr", []string{"nombre", "numero"}, []string{"nombre"}},
+		{"direcion_pa", []string{"direccion_pais", "direccion"}, []string{"direccion_pais"}},
+		// Ordenadas por distancia y luego alfabéticamente
+		{"item", []string{"items", "iter", "item_", "stop"}, []string{"item_", "items", "iter"}},
+		{"k", []string{"a", "b", "c", "d", "e", "f", "k"}, []string{"k", "a", "b", "c", "d"}},
+		{"x", nil, []string{}},
+	}
+
+	for _, tc := range cases {
+		if got := Keys(tc.segment, tc.candidates); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Keys(%q, %q) = %q, se esperaba %q", tc.segment, tc.candidates, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"procesador-consultas/completion"
+	"procesador-consultas/lexer"
+	"procesador-consultas/limits"
+	"procesador-consultas/lint"
+	"procesador-consultas/parser"
+	"procesador-consultas/queryerr"
+	"procesador-consultas/schema"
+	"procesador-consultas/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FormatRequest representa la solicitud de formateo de una o varias consultas
+type FormatRequest struct {
+	Query   string   `json:"query"`
+	Queries []string `json:"queries"`
+}
+
+// FormattedQuery es el resultado de formatear una consulta
+type FormattedQuery struct {
+	Query       string                      `json:"query"`
+	Canonical   string                      `json:"canonical,omitempty"`
+	Segments    []parser.Segment            `json:"segments,omitempty"`
+	Error       string                      `json:"error,omitempty"`
+	Diagnostics []queryerr.SyntaxDiagnostic `json:"diagnostics,omitempty"`
+}
+
+// formatQuery parsea una consulta y calcula su forma canónica
+func formatQuery(query string) (FormattedQuery, error) {
+	parsed, err := parser.Parse(query)
+	if err != nil {
+		queryErr := queryerr.From(err)
+		return FormattedQuery{Query: query, Error: queryErr.Message, Diagnostics: queryErr.Diagnostics}, err
+	}
+
+	return FormattedQuery{Query: query, Canonical: parser.Format(parsed), Segments: parsed.Segments}, nil
+}
+
+// handleQueryFormat retorna la forma canónica de las consultas. Con "queries"
+// también agrupa las consultas equivalentes (misma forma canónica).
+func handleQueryFormat(c *gin.Context) {
+	var req FormatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if len(req.Queries) == 0 {
+		if req.Query == "" {
+			respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "Se requiere query o queries"))
+			return
+		}
+
+		formatted, err := formatQuery(req.Query)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, QueryResponse{
+			Success: true,
+			Data: map[string]interface{}{
+				"query":     formatted.Query,
+				"canonical": formatted.Canonical,
+				"segments":  formatted.Segments,
+			},
+		})
+		return
+	}
+
+	results := make([]FormattedQuery, len(req.Queries))
+	groups := make(map[string][]int)
+	var order []string
+	for i, query := range req.Queries {
+		results[i], _ = formatQuery(query)
+		if canonical := results[i].Canonical; canonical != "" {
+			if _, seen := groups[canonical]; !seen {
+				order = append(order, canonical)
+			}
+			groups[canonical] = append(groups[canonical], i)
+		}
+	}
+
+	// Índices de las consultas equivalentes, en el orden en que aparecen
+	duplicates := [][]int{}
+	for _, canonical := range order {
+		if len(groups[canonical]) > 1 {
+			duplicates = append(duplicates, groups[canonical])
+		}
+	}
+
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"formatted":  results,
+			"duplicates": duplicates,
+		},
+	})
+}
+
+// LintRequest representa la solicitud de análisis de una consulta. El documento
+// de ejemplo (o las muestras) es opcional; sin él solo se aplican las reglas de estilo.
+type LintRequest struct {
+	Query   string   `json:"query" binding:"required"`
+	JSON    string   `json:"json"`
+	Samples []string `json:"samples"`
+}
+
+// SchemaRequest representa la solicitud de inferencia de esquema de un documento o
+// de varias muestras. Ranges indica si se exportan los rangos observados (por defecto sí).
+type SchemaRequest struct {
+	JSON    string   `json:"json"`
+	Samples []string `json:"samples"`
+	Ranges  *bool    `json:"ranges"`
+}
+
+// ValidateRequest representa la solicitud de validación de un documento contra un esquema
+type ValidateRequest struct {
+	JSON   string             `json:"json" binding:"required"`
+	Schema *schema.JSONSchema `json:"schema" binding:"required"`
+}
+
+// CompleteRequest representa la solicitud de autocompletado. Cursor es la posición en
+// caracteres dentro de la consulta; si se omite, se completa al final.
+type CompleteRequest struct {
+	JSON   string `json:"json" binding:"required"`
+	Query  string `json:"query"`
+	Cursor *int   `json:"cursor"`
+}
+
+// decodeDocument valida los límites del documento y lo decodifica con encoding/json
+func decodeDocument(jsonStr string) (interface{}, error) {
+	if err := limits.CheckDocument(jsonStr, serverLimits); err != nil {
+		return nil, err
+	}
+
+	var document interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &document); err != nil {
+		return nil, queryerr.InvalidDocument(err)
+	}
+	return document, nil
+}
+
+// handleQueryLint analiza una consulta y retorna sus diagnósticos con posiciones
+func handleQueryLint(c *gin.Context) {
+	var req LintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	result := lint.Lint(req.Query)
+	samples := collectSamples(req.JSON, req.Samples)
+	if len(samples) > 0 {
+		inferred, err := inferSamples(c, samples)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		result = lint.LintWithSchema(req.Query, inferred)
+	}
+
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"canonical":     result.Canonical,
+			"diagnostics":   result.Diagnostics,
+			"with_document": len(samples) > 0,
+		},
+	})
+}
+
+// collectSamples reúne el documento y las muestras de una solicitud
+func collectSamples(jsonStr string, samples []string) []string {
+	if jsonStr == "" {
+		return samples
+	}
+	return append([]string{jsonStr}, samples...)
+}
+
+// inferSamples decodifica las muestras y resume su estructura
+func inferSamples(c *gin.Context, samples []string) (*schema.Schema, error) {
+	documents := make([]interface{}, len(samples))
+	for i, sample := range samples {
+		document, err := decodeDocument(sample)
+		if err != nil {
+			queryErr := queryerr.From(err)
+			if len(samples) > 1 {
+				queryErr.Message = fmt.Sprintf("muestra %d: %s", i, queryErr.Message)
+			}
+			return nil, queryErr
+		}
+		documents[i] = document
+	}
+
+	return schema.InferContext(c.Request.Context(), documents...)
+}
+
+// handleSchemaInfer resume uno o varios documentos y exporta el resultado como JSON Schema
+func handleSchemaInfer(c *gin.Context) {
+	var req SchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	samples := collectSamples(req.JSON, req.Samples)
+	if len(samples) == 0 {
+		respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "Se requiere json o samples"))
+		return
+	}
+
+	inferred, err := inferSamples(c, samples)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	options := schema.ExportOptions{Ranges: req.Ranges == nil || *req.Ranges}
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"samples":     len(samples),
+			"summary":     inferred,
+			"json_schema": inferred.JSONSchema(options),
+		},
+	})
+}
+
+// validateDocument compila el esquema y valida el documento
+func validateDocument(c *gin.Context, jsonStr string, jsonSchema *schema.JSONSchema) (validator.Report, error) {
+	v, err := validator.New(jsonSchema)
+	if err != nil {
+		return validator.Report{}, err
+	}
+
+	document, err := decodeDocument(jsonStr)
+	if err != nil {
+		return validator.Report{}, err
+	}
+
+	return v.Check(c.Request.Context(), document)
+}
+
+// handleValidate valida un documento y retorna todas las violaciones con su ubicación
+func handleValidate(c *gin.Context) {
+	var req ValidateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	report, err := validateDocument(c, req.JSON, req.Schema)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"valid":      len(report.Violations) == 0,
+			"count":      len(report.Violations),
+			"truncated":  report.Truncated,
+			"violations": report.Violations,
+		},
+	})
+}
+
+// validateBeforeQuery valida el documento si la solicitud incluye un esquema.
+// Retorna false si ya respondió con un error o con las violaciones encontradas.
+func validateBeforeQuery(c *gin.Context, req QueryRequest) bool {
+	if req.Schema == nil {
+		return true
+	}
+
+	report, err := validateDocument(c, req.JSON, req.Schema)
+	if err != nil {
+		respondError(c, err)
+		return false
+	}
+	violations := report.Violations
+	if len(violations) == 0 {
+		return true
+	}
+
+	queryErr := queryerr.New(queryerr.CodeValidation, "el documento no cumple el esquema (violaciones: %d)", len(violations))
+	c.JSON(statusFor(queryErr), QueryResponse{
+		Success:     false,
+		Error:       queryErr.Message,
+		ErrorCode:   queryErr.Code,
+		ErrorDetail: queryErr,
+		Violations:  violations,
+	})
+	return false
+}
+
+// handleQueryComplete propone los siguientes segmentos de una consulta parcial
+func handleQueryComplete(c *gin.Context) {
+	var req CompleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	length := utf8.RuneCountInString(req.Query)
+	cursor := length
+	if req.Cursor != nil {
+		if *req.Cursor < 0 || *req.Cursor > length {
+			respondError(c, queryerr.New(queryerr.CodeInvalidRequest, "cursor fuera de la consulta: %d (longitud %d)", *req.Cursor, length))
+			return
+		}
+		cursor = *req.Cursor
+	}
+
+	document, err := decodeDocument(req.JSON)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"completion": completion.Complete(req.Query, cursor, document),
+		},
+	})
+}
+
+// TokensRequest representa la solicitud de tokens de una consulta
+type TokensRequest struct {
+	Query string `json:"query"`
+}
+
+// QueryToken es un token de la consulta para resaltado de sintaxis. Start y End son
+// índices en caracteres (runas) desde el inicio de la consulta; End es exclusivo.
+type QueryToken struct {
+	Type    lexer.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Start   int             `json:"start"`
+	End     int             `json:"end"`
+	Span    queryerr.Span   `json:"span"`
+	Message string          `json:"message,omitempty"`
+}
+
+// queryTokens tokeniza la consulta completa, incluidos los tokens de error, sin el EOF
+func queryTokens(query string) []QueryToken {
+	tokens := []QueryToken{}
+	runes, offset := 0, 0
+	for _, tok := range lexer.NewLexer(query).Tokenize() {
+		if tok.Type == lexer.TOKEN_EOF {
+			break
+		}
+		runes += utf8.RuneCountInString(query[offset:tok.Offset])
+		length := utf8.RuneCountInString(tok.Literal)
+		end := tok.Offset + len(tok.Literal)
+
+		tokens = append(tokens, QueryToken{
+			Type:    tok.Type,
+			Literal: tok.Literal,
+			Start:   runes,
+			End:     runes + length,
+			Span: queryerr.Span{
+				Start: queryerr.Position{Offset: tok.Offset, Line: tok.Line, Column: tok.Column},
+				End:   queryerr.PositionAt(query, end),
+			},
+			Message: tok.Message,
+		})
+		runes += length
+		offset = end
+	}
+	return tokens
+}
+
+// handleQueryTokens retorna los tokens de una consulta con sus rangos para resaltarla
+func handleQueryTokens(c *gin.Context) {
+	var req TokensRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, QueryResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"tokens": queryTokens(req.Query),
+		},
+	})
+}
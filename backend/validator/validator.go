@@ -0,0 +1,304 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"procesador-consultas/queryerr"
+	"procesador-consultas/schema"
+)
+
+// MaxViolations es el número máximo de violaciones que se reportan por documento
+const MaxViolations = 1000
+
+// validateCheckInterval indica cada cuántos valores se comprueba el contexto
+const validateCheckInterval = 1024
+
+// Violation es una regla del esquema que el documento no cumple.
+// Pointer ubica el valor en el documento y SchemaPointer la regla en el esquema,
+// ambos como JSON Pointer (RFC 6901); la raíz es la cadena vacía.
+type Violation struct {
+	Pointer       string `json:"pointer"`
+	SchemaPointer string `json:"schema_pointer"`
+	Keyword       string `json:"keyword"`
+	Message       string `json:"message"`
+}
+
+// Validator valida documentos contra un esquema compilado.
+//
+// Soporta el subconjunto central de JSON Schema: type, properties, required,
+// items, enum, minimum/maximum, minLength/maxLength, minItems/maxItems y pattern.
+// Las demás palabras clave se ignoran. Los patrones usan la sintaxis RE2 de Go,
+// que coincide con la de ECMA-262 salvo en retrocesos y lookarounds.
+type Validator struct {
+	root     *schema.JSONSchema
+	patterns map[*schema.JSONSchema]*regexp.Regexp
+}
+
+// validTypes son los nombres de tipo que admite la palabra clave type
+var validTypes = map[string]bool{
+	schema.TypeObject: true, schema.TypeArray: true, schema.TypeString: true,
+	schema.TypeInteger: true, schema.TypeNumber: true, schema.TypeBoolean: true, schema.TypeNull: true,
+}
+
+// New compila el esquema. Retorna un error invalid_schema si un tipo es desconocido
+// o un patrón no es una expresión regular válida.
+func New(root *schema.JSONSchema) (*Validator, error) {
+	if root == nil {
+		root = &schema.JSONSchema{}
+	}
+
+	v := &Validator{root: root, patterns: map[*schema.JSONSchema]*regexp.Regexp{}}
+	if err := v.compile(root, ""); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// compile verifica los tipos y compila los patrones de un esquema y sus hijos
+func (v *Validator) compile(s *schema.JSONSchema, pointer string) error {
+	for _, name := range s.Type {
+		if !validTypes[name] {
+			return queryerr.New(queryerr.CodeInvalidSchema, "tipo desconocido %q en %s/type", name, pointer)
+		}
+	}
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return queryerr.New(queryerr.CodeInvalidSchema, "patrón inválido en %s/pattern: %v", pointer, err)
+		}
+		v.patterns[s] = pattern
+	}
+
+	for key, property := range s.Properties {
+		if property == nil {
+			continue
+		}
+		if err := v.compile(property, pointer+"/properties/"+escape(key)); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return v.compile(s.Items, pointer+"/items")
+	}
+	return nil
+}
+
+// Report es el resultado de validar un documento
+type Report struct {
+	Violations []Violation
+	Truncated  bool // el documento tiene más de MaxViolations violaciones
+}
+
+// Validate valida un documento decodificado con encoding/json (la misma
+// representación que usan los motores) y retorna todas las violaciones
+func (v *Validator) Validate(document interface{}) []Violation {
+	violations, _ := v.ValidateContext(context.Background(), document)
+	return violations
+}
+
+// ValidateContext valida el documento comprobando periódicamente el contexto.
+// Retorna el error del contexto si este termina durante el recorrido.
+func (v *Validator) ValidateContext(ctx context.Context, document interface{}) ([]Violation, error) {
+	report, err := v.Check(ctx, document)
+	return report.Violations, err
+}
+
+// Check valida el documento como ValidateContext e indica si se omitieron
+// violaciones por superar MaxViolations
+func (v *Validator) Check(ctx context.Context, document interface{}) (Report, error) {
+	run := &validation{validator: v, ctx: ctx, violations: []Violation{}}
+	if err := run.validate(v.root, document, "", ""); err != nil {
+		return Report{}, err
+	}
+	return Report{Violations: run.violations, Truncated: run.truncated}, nil
+}
+
+// validation acumula las violaciones de un recorrido
+type validation struct {
+	validator  *Validator
+	ctx        context.Context
+	values     int
+	violations []Violation
+	truncated  bool // se encontró una violación más allá del máximo
+}
+
+// report agrega una violación mientras no se alcance el máximo; la siguiente solo
+// marca el resultado como truncado
+func (r *validation) report(pointer, schemaPointer, keyword, format string, args ...interface{}) {
+	if len(r.violations) >= MaxViolations {
+		r.truncated = true
+		return
+	}
+	r.violations = append(r.violations, Violation{
+		Pointer:       pointer,
+		SchemaPointer: schemaPointer + "/" + keyword,
+		Keyword:       keyword,
+		Message:       fmt.Sprintf(format, args...),
+	})
+}
+
+// validate aplica las palabras clave de un esquema a un valor
+func (r *validation) validate(s *schema.JSONSchema, value interface{}, pointer, schemaPointer string) error {
+	r.values++
+	if r.values%validateCheckInterval == 0 {
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if s == nil || r.truncated {
+		return nil
+	}
+
+	if len(s.Type) > 0 && !matchesType(s.Type, value) {
+		r.report(pointer, schemaPointer, "type", "se esperaba %s, se obtuvo %s", strings.Join(s.Type, " o "), typeOf(value))
+		// Las demás palabras clave dependen del tipo
+		return nil
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		r.report(pointer, schemaPointer, "enum", "el valor no está entre los permitidos")
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return r.validateObject(s, v, pointer, schemaPointer)
+	case []interface{}:
+		return r.validateArray(s, v, pointer, schemaPointer)
+	case string:
+		r.validateString(s, v, pointer, schemaPointer)
+	case float64:
+		r.validateNumber(s, v, pointer, schemaPointer)
+	}
+	return nil
+}
+
+// validateObject aplica required y properties
+func (r *validation) validateObject(s *schema.JSONSchema, object map[string]interface{}, pointer, schemaPointer string) error {
+	for _, key := range s.Required {
+		if _, exists := object[key]; !exists {
+			r.report(pointer, schemaPointer, "required", "falta la clave obligatoria %q", key)
+		}
+	}
+
+	// Orden estable de las violaciones
+	keys := make([]string, 0, len(s.Properties))
+	for key := range s.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child, exists := object[key]
+		if !exists {
+			continue
+		}
+		err := r.validate(s.Properties[key], child, pointer+"/"+escape(key), schemaPointer+"/properties/"+escape(key))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateArray aplica minItems, maxItems e items
+func (r *validation) validateArray(s *schema.JSONSchema, array []interface{}, pointer, schemaPointer string) error {
+	if s.MinItems != nil && len(array) < *s.MinItems {
+		r.report(pointer, schemaPointer, "minItems", "el arreglo tiene %d elementos, el mínimo es %d", len(array), *s.MinItems)
+	}
+	if s.MaxItems != nil && len(array) > *s.MaxItems {
+		r.report(pointer, schemaPointer, "maxItems", "el arreglo tiene %d elementos, el máximo es %d", len(array), *s.MaxItems)
+	}
+
+	if s.Items == nil {
+		return nil
+	}
+	for i, item := range array {
+		if err := r.validate(s.Items, item, pointer+"/"+strconv.Itoa(i), schemaPointer+"/items"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateString aplica minLength, maxLength (en caracteres) y pattern
+func (r *validation) validateString(s *schema.JSONSchema, value string, pointer, schemaPointer string) {
+	length := utf8.RuneCountInString(value)
+	if s.MinLength != nil && length < *s.MinLength {
+		r.report(pointer, schemaPointer, "minLength", "el texto tiene %d caracteres, el mínimo es %d", length, *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		r.report(pointer, schemaPointer, "maxLength", "el texto tiene %d caracteres, el máximo es %d", length, *s.MaxLength)
+	}
+	if pattern := r.validator.patterns[s]; pattern != nil && !pattern.MatchString(value) {
+		r.report(pointer, schemaPointer, "pattern", "el texto no coincide con el patrón %q", s.Pattern)
+	}
+}
+
+// validateNumber aplica minimum y maximum
+func (r *validation) validateNumber(s *schema.JSONSchema, value float64, pointer, schemaPointer string) {
+	if s.Minimum != nil && value < *s.Minimum {
+		r.report(pointer, schemaPointer, "minimum", "el valor %v es menor que el mínimo %v", value, *s.Minimum)
+	}
+	if s.Maximum != nil && value > *s.Maximum {
+		r.report(pointer, schemaPointer, "maximum", "el valor %v es mayor que el máximo %v", value, *s.Maximum)
+	}
+}
+
+// matchesType indica si el valor es de alguno de los tipos; integer acepta
+// números sin parte decimal y number acepta cualquier número
+func matchesType(types schema.TypeList, value interface{}) bool {
+	actual := typeOf(value)
+	for _, name := range types {
+		if name == actual || (name == schema.TypeNumber && actual == schema.TypeInteger) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf retorna el tipo JSON Schema de un valor, distinguiendo los enteros
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return schema.TypeObject
+	case []interface{}:
+		return schema.TypeArray
+	case string:
+		return schema.TypeString
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return schema.TypeInteger
+		}
+		return schema.TypeNumber
+	case bool:
+		return schema.TypeBoolean
+	case nil:
+		return schema.TypeNull
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// inEnum compara el valor con cada alternativa con igualdad estructural
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// escape codifica un segmento de JSON Pointer (RFC 6901)
+func escape(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+}
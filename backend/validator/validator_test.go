@@ -0,0 +1,164 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"procesador-consultas/queryerr"
+	"procesador-consultas/schema"
+)
+
+// violation es la parte de una Violation que verifican las pruebas; el mensaje
+// es texto libre
+type violation struct {
+	pointer, schemaPointer, keyword string
+}
+
+// decode decodifica un documento o un esquema de prueba
+func decode(t *testing.T, raw string, target interface{}) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(raw), target); err != nil {
+		t.Fatalf("%s: %v", raw, err)
+	}
+}
+
+// TestValidate verifica cada palabra clave con documentos que la cumplen y que no
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		schema   string
+		document string
+		want     []violation
+	}{
+		{"type", `{"type": "string"}`, `1`, []violation{{"", "/type", "type"}}},
+		{"type cumplido", `{"type": "string"}`, `"x"`, nil},
+		{"varios tipos", `{"type": ["string", "null"]}`, `null`, nil},
+		{"integer con decimales", `{"type": "integer"}`, `1.5`, []violation{{"", "/type", "type"}}},
+		{"integer sin decimales", `{"type": "integer"}`, `2.0`, nil},
+		{"number acepta enteros", `{"type": "number"}`, `2`, nil},
+		{"type detiene las demás palabras clave", `{"type": "string", "minLength": 5}`, `3`, []violation{{"", "/type", "type"}}},
+
+		{"required", `{"type": "object", "required": ["a", "b"]}`, `{"a": 1}`, []violation{{"", "/required", "required"}}},
+		{"claves adicionales permitidas", `{"properties": {"a": {"type": "string"}}}`, `{"a": "x", "extra": 1}`, nil},
+		{"propiedad ausente no se valida", `{"properties": {"a": {"type": "string"}}}`, `{}`, nil},
+		{"propiedades anidadas", `{"properties": {"a": {"properties": {"b": {"type": "string"}}}}}`, `{"a": {"b": 1}}`,
+			[]violation{{"/a/b", "/properties/a/properties/b/type", "type"}}},
+		{"escape de JSON Pointer", `{"properties": {"a/b": {"type": "string"}, "m~n": {"type": "string"}}}`, `{"a/b": 1, "m~n": 2}`,
+			[]violation{{"/a~1b", "/properties/a~1b/type", "type"}, {"/m~0n", "/properties/m~0n/type", "type"}}},
+
+		{"enum número", `{"enum": [1, "x", {"k": [true]}]}`, `1`, nil},
+		{"enum objeto", `{"enum": [1, "x", {"k": [true]}]}`, `{"k": [true]}`, nil},
+		{"enum otro número", `{"enum": [1, "x"]}`, `2`, []violation{{"", "/enum", "enum"}}},
+		{"enum otro tipo", `{"enum": [1, "x"]}`, `"1"`, []violation{{"", "/enum", "enum"}}},
+
+		{"minimum", `{"minimum": 0, "maximum": 10}`, `-1`, []violation{{"", "/minimum", "minimum"}}},
+		{"maximum", `{"minimum": 0, "maximum": 10}`, `10.5`, []violation{{"", "/maximum", "maximum"}}},
+		{"límites incluidos", `{"minimum": 0, "maximum": 10}`, `10`, nil},
+
+		{"minLength en caracteres", `{"minLength": 2, "maxLength": 3}`, `"ñ"`, []violation{{"", "/minLength", "minLength"}}},
+		{"maxLength en caracteres", `{"minLength": 2, "maxLength": 3}`, `"ñññ"`, nil},
+		{"maxLength", `{"minLength": 2, "maxLength": 3}`, `"abcd"`, []violation{{"", "/maxLength", "maxLength"}}},
+		{"pattern", `{"pattern": "^[a-z]+$"}`, `"ab1"`, []violation{{"", "/pattern", "pattern"}}},
+		{"pattern cumplido", `{"pattern": "^[a-z]+$"}`, `"abc"`, nil},
+
+		{"minItems", `{"minItems": 1, "maxItems": 2, "items": {"type": "integer"}}`, `[]`, []violation{{"", "/minItems", "minItems"}}},
+		{"maxItems e items", `{"minItems": 1, "maxItems": 2, "items": {"type": "integer"}}`, `[1, "x", 3]`,
+			[]violation{{"", "/maxItems", "maxItems"}, {"/1", "/items/type", "type"}}},
+		{"palabras clave de otro tipo", `{"minLength": 5, "minimum": 3}`, `[1]`, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var s schema.JSONSchema
+			var document interface{}
+			decode(t, tc.schema, &s)
+			decode(t, tc.document, &document)
+
+			v, err := New(&s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []violation
+			for _, found := range v.Validate(document) {
+				if found.Message == "" {
+					t.Errorf("violación sin mensaje: %+v", found)
+				}
+				got = append(got, violation{found.Pointer, found.SchemaPointer, found.Keyword})
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("violaciones %+v, se esperaban %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestNewInvalidSchema verifica que los tipos desconocidos y los patrones inválidos
+// se rechacen indicando dónde están
+func TestNewInvalidSchema(t *testing.T) {
+	for raw, location := range map[string]string{
+		`{"properties": {"a": {"type": "entero"}}}`: "/properties/a/type",
+		`{"items": {"pattern": "(sin cerrar"}}`:     "/items/pattern",
+		`{"properties": {"x/y": {"pattern": "["}}}`: "/properties/x~1y/pattern",
+	} {
+		var s schema.JSONSchema
+		decode(t, raw, &s)
+		_, err := New(&s)
+		if queryerr.CodeOf(err) != queryerr.CodeInvalidSchema || !strings.Contains(err.Error(), location) {
+			t.Errorf("%s: error %v; se esperaba %s en %s", raw, err, queryerr.CodeInvalidSchema, location)
+		}
+	}
+}
+
+// TestMaxViolations verifica que se reporten como máximo MaxViolations violaciones
+// y que Truncated indique solo si se omitió alguna
+func TestMaxViolations(t *testing.T) {
+	v, err := New(&schema.JSONSchema{Items: &schema.JSONSchema{Type: schema.TypeList{schema.TypeString}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, items := range []int{MaxViolations - 1, MaxViolations, MaxViolations + 1, MaxViolations + 500} {
+		document := make([]interface{}, items)
+		for i := range document {
+			document[i] = float64(i)
+		}
+		report, err := v.Check(context.Background(), document)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, truncated := items, items > MaxViolations
+		if truncated {
+			want = MaxViolations
+		}
+		if len(report.Violations) != want || report.Truncated != truncated {
+			t.Errorf("%d elementos inválidos: %d violaciones (truncado: %v), se esperaban %d (truncado: %v)",
+				items, len(report.Violations), report.Truncated, want, truncated)
+		}
+		if last := report.Violations[len(report.Violations)-1].Pointer; last != "/"+strconv.Itoa(want-1) {
+			t.Errorf("%d elementos inválidos: la última violación es %s", items, last)
+		}
+	}
+}
+
+// TestValidateContextCanceled verifica que la validación se detenga al cancelar el contexto
+func TestValidateContextCanceled(t *testing.T) {
+	v, err := New(&schema.JSONSchema{Items: &schema.JSONSchema{Type: schema.TypeList{schema.TypeNumber}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := make([]interface{}, 4*validateCheckInterval)
+	for i := range document {
+		document[i] = float64(i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if violations, err := v.ValidateContext(ctx, document); err != context.Canceled || violations != nil {
+		t.Errorf("se esperaba context.Canceled sin violaciones, se obtuvo %v (%d violaciones)", err, len(violations))
+	}
+}
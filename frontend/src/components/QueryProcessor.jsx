@@ -1,4 +1,4 @@
-import React, { useState } from 'react';
+import React, { useEffect, useRef, useState } from 'react';
 import { Send, FileText, Search, Database } from 'lucide-react';
 import axios from 'axios';
 
@@ -27,6 +27,99 @@ const QueryProcessor = ({ onResult }) => {
   const [query, setQuery] = useState('user.address.city');
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState(null);
+  const [completion, setCompletion] = useState(null);
+  const [cursor, setCursor] = useState(null);
+  const [tokens, setTokens] = useState([]);
+  const queryInputRef = useRef(null);
+
+  // El backend cuenta el cursor en caracteres (code points); JavaScript en unidades UTF-16
+  const toCodePoints = (text, index) => Array.from(text.slice(0, index)).length;
+  const toUtf16 = (text, codePoints) => Array.from(text).slice(0, codePoints).join('').length;
+
+  // Pedir candidatos para el siguiente segmento con un pequeño retardo mientras se escribe
+  useEffect(() => {
+    if (cursor === null) {
+      return undefined;
+    }
+
+    const timer = setTimeout(async () => {
+      try {
+        const response = await axios.post('http://localhost:8080/query/complete', {
+          json: jsonInput,
+          query: query,
+          cursor: toCodePoints(query, cursor)
+        });
+        setCompletion(response.data.data.completion);
+      } catch (err) {
+        // JSON inválido o consulta incompleta: sin sugerencias
+        setCompletion(null);
+      }
+    }, 200);
+
+    return () => clearTimeout(timer);
+  }, [jsonInput, query, cursor]);
+
+  // Tokens de la consulta para resaltarla; los rangos vienen en code points
+  useEffect(() => {
+    const timer = setTimeout(async () => {
+      try {
+        const response = await axios.post('http://localhost:8080/query/tokens', { query });
+        setTokens(response.data.data.tokens);
+      } catch (err) {
+        setTokens([]);
+      }
+    }, 150);
+
+    return () => clearTimeout(timer);
+  }, [query]);
+
+  const tokenClasses = {
+    identifier: 'text-blue-700',
+    string: 'text-green-700',
+    number: 'text-purple-700',
+    dot: 'text-gray-500',
+    lbracket: 'text-gray-500',
+    rbracket: 'text-gray-500',
+    error: 'text-red-600 underline decoration-wavy'
+  };
+
+  const renderHighlighted = () => {
+    const chars = Array.from(query);
+    const parts = [];
+    let position = 0;
+    tokens.forEach((token, i) => {
+      if (token.start > position) {
+        parts.push(<span key={`ws-${i}`}>{chars.slice(position, token.start).join('')}</span>);
+      }
+      parts.push(
+        <span key={i} className={tokenClasses[token.type]} title={token.message || token.type}>
+          {chars.slice(token.start, token.end).join('')}
+        </span>
+      );
+      position = token.end;
+    });
+    if (position < chars.length) {
+      parts.push(<span key="rest">{chars.slice(position).join('')}</span>);
+    }
+    return parts;
+  };
+
+  const updateCursor = (e) => setCursor(e.target.selectionStart);
+
+  const applyCandidate = (candidate) => {
+    const start = toUtf16(query, completion.replace.start.column - 1);
+    const end = cursor ?? query.length;
+    const nextQuery = query.slice(0, start) + candidate.insert_text + query.slice(end);
+    const nextCursor = start + candidate.insert_text.length;
+
+    setQuery(nextQuery);
+    setCursor(nextCursor);
+    setCompletion(null);
+    requestAnimationFrame(() => {
+      queryInputRef.current?.focus();
+      queryInputRef.current?.setSelectionRange(nextCursor, nextCursor);
+    });
+  };
 
   const handleSubmit = async (e) => {
     e.preventDefault();
@@ -218,16 +311,47 @@ const QueryProcessor = ({ onResult }) => {
             </div>
             <input
               id="query-input"
+              ref={queryInputRef}
               type="text"
               value={query}
-              onChange={(e) => setQuery(e.target.value)}
+              onChange={(e) => {
+                setQuery(e.target.value);
+                updateCursor(e);
+              }}
+              onClick={updateCursor}
+              onKeyUp={updateCursor}
+              onFocus={updateCursor}
+              onBlur={() => setTimeout(() => setCursor(null), 150)}
+              autoComplete="off"
               className="block w-full pl-10 pr-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500"
               placeholder="ej: user.address.city"
               required
             />
           </div>
+          {cursor !== null && completion?.candidates?.length > 0 && (
+            <ul className="mt-1 max-h-48 overflow-auto border border-gray-200 rounded-md bg-white shadow-sm text-sm">
+              {completion.candidates.map((candidate) => (
+                <li key={`${candidate.kind}-${candidate.label}`}>
+                  <button
+                    type="button"
+                    onMouseDown={(e) => e.preventDefault()}
+                    onClick={() => applyCandidate(candidate)}
+                    className="w-full flex justify-between px-3 py-1 text-left hover:bg-blue-50"
+                  >
+                    <span className="font-mono text-gray-900">{candidate.label}</span>
+                    <span className="text-xs text-gray-500">{candidate.type} · {candidate.detail}</span>
+                  </button>
+                </li>
+              ))}
+            </ul>
+          )}
+          {tokens.length > 0 && (
+            <div className="mt-1 px-3 py-1 font-mono text-sm bg-gray-50 rounded-md whitespace-pre">
+              {renderHighlighted()}
+            </div>
+          )}
           <p className="mt-1 text-xs text-gray-500">
-            Usa notación de punto para navegar por el JSON (ej: propiedad.subpropiedad)
+            Usa notación de punto para navegar por el JSON (ej: propiedad.subpropiedad o lista[0])
           </p>
         </div>
 
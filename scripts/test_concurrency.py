@@ -0,0 +1,221 @@
+#!/usr/bin/env python3
+"""
+Prueba de estrés concurrente del backend compilado con el detector de carreras.
+
+Compila el servidor con `go build -race`, lo inicia y envía peticiones simultáneas a
+/query, /query/optimized, /query/optimized/compare y /optimization/stats con las
+tres librerías. Verifica que cada respuesta tenga el valor esperado, que las
+estadísticas finales cuadren con las peticiones enviadas (sin actualizaciones
+perdidas) y que el detector no haya informado ninguna carrera.
+
+Uso:
+    python scripts/test_concurrency.py [--workers 32] [--requests 2000] [--policy query|shape]
+
+Autor: Procesador de Consultas JSON
+"""
+
+import argparse
+import json
+import os
+import random
+import subprocess
+import sys
+import tempfile
+import threading
+import time
+import urllib.error
+import urllib.request
+from concurrent.futures import ThreadPoolExecutor
+from pathlib import Path
+
+BASE_URL = "http://localhost:8080"
+BACKEND_DIR = Path(__file__).resolve().parent.parent / "backend"
+LIBRARIES = ["standard", "json-iterator", "fastjson"]
+
+
+def call(path, body=None, timeout=30):
+    """Envía una petición (POST si hay cuerpo) y retorna el código HTTP y el JSON de la respuesta"""
+    data = json.dumps(body).encode() if body is not None else None
+    request = urllib.request.Request(f"{BASE_URL}{path}", data=data, headers={"Content-Type": "application/json"})
+    try:
+        with urllib.request.urlopen(request, timeout=timeout) as response:
+            return response.status, json.loads(response.read())
+    except urllib.error.HTTPError as e:
+        return e.code, json.loads(e.read() or b"{}")
+
+
+def build_documents():
+    """Crea documentos de distintas formas con las consultas y sus valores esperados"""
+    documents = []
+    for n in range(4):
+        users = [
+            {
+                "id": i,
+                "name": f"Usuario {i}",
+                "profile": {"email": f"user{i}@example.com", "preferences": {"language": "es" if i % 2 else "en"}},
+                "tags": ["a", "b", "c"][: 1 + (i + n) % 3],
+            }
+            for i in range(5 + n)
+        ]
+        document = {"users": users, "version": n}
+        if n % 2:
+            document["extra"] = {"nested": {"deep": [n, n + 1]}}
+
+        cases = [("version", n)]
+        for i, user in enumerate(users):
+            cases.append((f"users.{i}.name", user["name"]))
+            cases.append((f"users[{i}].profile.preferences.language", user["profile"]["preferences"]["language"]))
+            cases.append((f"users.{i}.profile.email", user["profile"]["email"]))
+            cases.append((f"users.{i}.tags.0", "a"))
+        if n % 2:
+            cases.append(("extra.nested.deep.1", n + 1))
+
+        documents.append((json.dumps(document), cases))
+    return documents
+
+
+class Stress:
+    """Envía peticiones concurrentes y cuenta las que actualizan las estadísticas"""
+
+    def __init__(self, documents, seed):
+        self.documents = documents
+        self.lock = threading.Lock()
+        self.engine_queries = 0  # consultas que pasan por QueryWithOptimization
+        self.failures = []
+        self.seed = seed
+
+    def fail(self, message):
+        with self.lock:
+            self.failures.append(message)
+
+    def count(self, n):
+        with self.lock:
+            self.engine_queries += n
+
+    def run_one(self, i):
+        rng = random.Random(self.seed + i)
+        document, cases = rng.choice(self.documents)
+        query, expected = rng.choice(cases)
+        library = rng.choice(LIBRARIES)
+        kind = rng.choices(["query", "optimized", "compare", "stats", "missing"], weights=[40, 30, 10, 10, 10])[0]
+
+        try:
+            if kind == "stats":
+                status, _ = call("/optimization/stats")
+                if status != 200:
+                    self.fail(f"stats: HTTP {status}")
+                return
+
+            if kind == "missing":
+                _, body = call(f"/query?library={library}", {"json": document, "query": query + ".falta"})
+                self.count(1)
+                if body.get("error_code") != "path_not_found":
+                    self.fail(f"{library} {query}.falta: se esperaba path_not_found, se obtuvo {str(body)[:200]}")
+                return
+
+            if kind == "compare":
+                _, body = call("/query/optimized/compare", {"json": document, "query": query})
+                self.count(len(LIBRARIES))  # una consulta optimizada por librería
+                results = body.get("results") or {}
+                for name, result in results.items():
+                    if result.get("value") != expected:
+                        self.fail(f"compare {name} {query}: {result.get('value')!r} != {expected!r}")
+                if not results:
+                    self.fail(f"compare {query}: respuesta sin resultados: {str(body)[:200]}")
+                return
+
+            path = "/query" if kind == "query" else "/query/optimized"
+            status, body = call(f"{path}?library={library}", {"json": document, "query": query})
+            self.count(1)
+            value = (body.get("data") or {}).get("value")
+            if status != 200 or value != expected:
+                self.fail(f"{path} {library} {query}: {value!r} != {expected!r} (HTTP {status})")
+        except Exception as e:  # noqa: BLE001 - se informa cualquier fallo de la petición
+            self.fail(f"{kind} {library} {query}: {e}")
+
+
+def wait_for_server(process):
+    """Espera a que el servidor responda en /health"""
+    for _ in range(100):
+        if process.poll() is not None:
+            return False
+        try:
+            if call("/health", timeout=1)[0] == 200:
+                return True
+        except OSError:
+            time.sleep(0.2)
+    return False
+
+
+def check_stats(stress):
+    """Verifica que las estadísticas finales cuadren con las peticiones enviadas"""
+    data = call("/optimization/stats")[1]["data"]
+    engine_stats = data["optimization_stats"]
+    optimizer_stats = data["optimizer_stats"]
+    pool = optimizer_stats["Caches"]["query_pool"]
+
+    checks = [
+        (engine_stats["TotalQueries"] == stress.engine_queries,
+         f"TotalQueries={engine_stats['TotalQueries']}, se enviaron {stress.engine_queries}"),
+        (engine_stats["CacheHits"] + engine_stats["OptimizedQueries"] == engine_stats["TotalQueries"],
+         f"CacheHits ({engine_stats['CacheHits']}) + OptimizedQueries ({engine_stats['OptimizedQueries']}) "
+         f"!= TotalQueries ({engine_stats['TotalQueries']})"),
+        (pool["Hits"] + pool["Misses"] == engine_stats["TotalQueries"],
+         f"pool: Hits ({pool['Hits']}) + Misses ({pool['Misses']}) != TotalQueries ({engine_stats['TotalQueries']})"),
+        (optimizer_stats["TotalQueries"] <= engine_stats["OptimizedQueries"],
+         f"el optimizador creó {optimizer_stats['TotalQueries']} planes para {engine_stats['OptimizedQueries']} consultas optimizadas"),
+    ]
+    return [message for ok, message in checks if not ok]
+
+
+def main():
+    parser = argparse.ArgumentParser(description="Prueba de estrés concurrente con el detector de carreras")
+    parser.add_argument("--workers", type=int, default=32, help="peticiones simultáneas")
+    parser.add_argument("--requests", type=int, default=2000, help="peticiones en total")
+    parser.add_argument("--policy", choices=["query", "shape"], default="query", help="política del cache de planes")
+    parser.add_argument("--seed", type=int, default=1, help="semilla de las peticiones")
+    args = parser.parse_args()
+
+    print("🔨 Compilando el servidor con -race...")
+    binary = Path(tempfile.mkdtemp()) / "server"
+    subprocess.run(["go", "build", "-race", "-o", str(binary), "."], cwd=BACKEND_DIR, check=True)
+
+    log = tempfile.TemporaryFile(mode="w+")
+    env = dict(os.environ, QUERY_PLAN_CACHE_POLICY=args.policy, GORACE="halt_on_error=0")
+    process = subprocess.Popen([str(binary)], cwd=BACKEND_DIR, stdout=log, stderr=subprocess.STDOUT, env=env)
+
+    failures = []
+    try:
+        if not wait_for_server(process):
+            print("❌ El servidor no respondió en :8080")
+            sys.exit(1)
+
+        stress = Stress(build_documents(), args.seed)
+        print(f"🚀 {args.requests} peticiones con {args.workers} en paralelo (política {args.policy})...")
+        start = time.time()
+        with ThreadPoolExecutor(max_workers=args.workers) as pool:
+            list(pool.map(stress.run_one, range(args.requests)))
+        print(f"⏱️  {time.time() - start:.1f}s")
+
+        failures = stress.failures + check_stats(stress)
+    finally:
+        process.terminate()
+        process.wait(timeout=10)
+
+    log.seek(0)
+    output = log.read()
+    races = output.count("WARNING: DATA RACE")
+    if races:
+        failures.append(f"el detector informó {races} carreras")
+        print(output[output.index("WARNING: DATA RACE"):][:4000])
+
+    for failure in failures[:20]:
+        print(f"❌ {failure}")
+    if failures:
+        print(f"\n❌ {len(failures)} fallos")
+        sys.exit(1)
+    print("✅ Sin carreras ni actualizaciones perdidas")
+
+
+if __name__ == "__main__":
+    main()